@@ -3,11 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"iptables-web/backend/internal/config"
 	"iptables-web/backend/internal/crypto"
 	"iptables-web/backend/internal/db"
 	"iptables-web/backend/internal/http/router"
+	"iptables-web/backend/internal/service"
+	sshx "iptables-web/backend/internal/ssh"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -43,6 +46,30 @@ func main() {
 	if err := db.Init(dsn); err != nil {
 		log.Fatalf("init db: %v", err)
 	}
+	// SSH 主机公钥校验（TOFU，持久化到 SQLite）
+	sshx.SetHostKeyStore(service.NewHostKeyService())
+	sshx.SetAgentSocket(cfg.SSHAgentSock)
+	// 跳板机链按 ID 查库
+	sshx.SetHostLookup(service.NewHostsService().Get)
+	// 进程级 SSH 连接池（<=0 取默认值）
+	sshx.DefaultPool().Configure(sshx.PoolConfig{
+		MaxPerHost:  cfg.SSHPoolMaxPerHost,
+		IdleTimeout: cfg.SSHPoolIdleTimeout,
+	})
+	// 异步作业执行器（/api/jobs），任务历史持久化到 SQLite
+	tasks := db.NewTaskStore()
+	if n, err := tasks.RecoverOrphans(); err != nil {
+		log.Fatalf("recover tasks: %v", err)
+	} else if n > 0 {
+		log.Printf("[boot] marked %d orphaned task(s) as FAILED", n)
+	}
+	tasks.StartPruner(cfg.TaskRetention, time.Hour)
+	service.StartJobs(cfg.JobWorkers, tasks)
+	// commit-confirm 默认确认窗口
+	service.SetConfirmTimeout(cfg.ConfirmTimeout)
+	// 规则集快照的保留条数与时长
+	service.SetSnapshotKeep(cfg.SnapshotKeep)
+	service.StartSnapshotPruner(cfg.SnapshotRetention, time.Hour)
 
 	// 路由
 	r := gin.New()
@@ -3,7 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,6 +13,20 @@ type Config struct {
 	SQLitePath  string
 	BindAddr    string
 	CORSOrigins []string
+	// ssh-agent socket：SSH_AGENT_SOCK 优先，其次 SSH_AUTH_SOCK
+	SSHAgentSock string
+	// SSH 连接池：每主机最大连接数、空闲回收时长
+	SSHPoolMaxPerHost  int
+	SSHPoolIdleTimeout time.Duration
+	// 异步作业（/api/jobs）并发 worker 数
+	JobWorkers int
+	// 作业历史保留时长（默认 30 天，<=0 不清理）
+	TaskRetention time.Duration
+	// 规则集快照：每台主机每个协议族保留条数（默认 200，<=0 不限）与保留时长（默认 90 天，<=0 不清理）
+	SnapshotKeep      int
+	SnapshotRetention time.Duration
+	// commit-confirm 默认确认窗口（写接口 ?confirm=true 时使用，默认 60s）
+	ConfirmTimeout time.Duration
 }
 
 func Load() Config {
@@ -28,6 +44,29 @@ func Load() Config {
 	if cfg.BindAddr == "" {
 		cfg.BindAddr = ":8088"
 	}
+	cfg.SSHAgentSock = os.Getenv("SSH_AGENT_SOCK")
+	if cfg.SSHAgentSock == "" {
+		cfg.SSHAgentSock = os.Getenv("SSH_AUTH_SOCK")
+	}
+	cfg.SSHPoolMaxPerHost, _ = strconv.Atoi(os.Getenv("SSH_POOL_MAX_PER_HOST"))
+	cfg.SSHPoolIdleTimeout, _ = time.ParseDuration(os.Getenv("SSH_POOL_IDLE_TIMEOUT"))
+	cfg.JobWorkers, _ = strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	cfg.TaskRetention = 30 * 24 * time.Hour
+	if v := os.Getenv("TASK_RETENTION"); v != "" {
+		cfg.TaskRetention, _ = time.ParseDuration(v)
+	}
+	cfg.SnapshotKeep = 200
+	if v := os.Getenv("SNAPSHOT_KEEP"); v != "" {
+		cfg.SnapshotKeep, _ = strconv.Atoi(v)
+	}
+	cfg.SnapshotRetention = 90 * 24 * time.Hour
+	if v := os.Getenv("SNAPSHOT_RETENTION"); v != "" {
+		cfg.SnapshotRetention, _ = time.ParseDuration(v)
+	}
+	cfg.ConfirmTimeout = 60 * time.Second
+	if v := os.Getenv("CONFIRM_TIMEOUT"); v != "" {
+		cfg.ConfirmTimeout, _ = time.ParseDuration(v)
+	}
 	cors := os.Getenv("CORS_ORIGINS")
 	if cors == "" {
 		cfg.CORSOrigins = []string{"http://localhost:5173"}
@@ -15,7 +15,7 @@ func Init(path string) error {
 	if err != nil {
 		return err
 	}
-	if err := db.AutoMigrate(&models.Host{}); err != nil {
+	if err := db.AutoMigrate(&models.Host{}, &models.HostKey{}, &models.TaskRecord{}, &models.RulesetSnapshot{}); err != nil {
 		return err
 	}
 	gdb = db
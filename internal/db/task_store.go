@@ -0,0 +1,207 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"iptables-web/backend/internal/models"
+	sshx "iptables-web/backend/internal/ssh"
+
+	"gorm.io/gorm"
+)
+
+// 重启时仍处于 PENDING/RUNNING 的任务不会再被执行，统一记为失败
+const orphanedError = "orphaned: server restarted while task was in flight"
+
+// TaskStore：ssh.TaskStore 的 GORM 实现（表 tasks）
+type TaskStore struct{ db *gorm.DB }
+
+var _ sshx.TaskStore = (*TaskStore)(nil)
+
+func NewTaskStore() *TaskStore { return &TaskStore{db: gdb} }
+
+func (s *TaskStore) Save(t *sshx.Task) error {
+	rec, err := toRecord(t)
+	if err != nil {
+		return err
+	}
+	return s.db.Save(rec).Error
+}
+
+func (s *TaskStore) Get(id string) (*sshx.Task, error) {
+	var rec models.TaskRecord
+	if err := s.db.First(&rec, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("not found")
+		}
+		return nil, err
+	}
+	return fromRecord(&rec)
+}
+
+func (s *TaskStore) List() ([]*sshx.Task, error) {
+	return s.Query(sshx.TaskFilter{})
+}
+
+func (s *TaskStore) Query(f sshx.TaskFilter) ([]*sshx.Task, error) {
+	q := s.db.Model(&models.TaskRecord{})
+	if f.HostID != 0 {
+		q = q.Where("host_id = ?", f.HostID)
+	}
+	if len(f.JobIDs) > 0 {
+		q = q.Where("job_id IN ?", f.JobIDs)
+	}
+	if len(f.Status) > 0 {
+		ss := make([]string, 0, len(f.Status))
+		for _, st := range f.Status {
+			ss = append(ss, string(st))
+		}
+		q = q.Where("status IN ?", ss)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	var recs []models.TaskRecord
+	if err := q.Order("created_at desc").Order("id asc").Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	out := make([]*sshx.Task, 0, len(recs))
+	for i := range recs {
+		t, err := fromRecord(&recs[i])
+		if err != nil {
+			// 单条坏记录不影响列表，跳过并留日志
+			log.Printf("[tasks] skip %s: %v", recs[i].ID, err)
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Prune：删除结束时间早于 now-retention 的任务，返回删除条数
+func (s *TaskStore) Prune(retention time.Duration) (int64, error) {
+	tx := s.db.Where("ended_at IS NOT NULL AND ended_at < ?", time.Now().Add(-retention)).
+		Delete(&models.TaskRecord{})
+	return tx.RowsAffected, tx.Error
+}
+
+// StartPruner：每隔 interval 按 retention 清理一次；retention<=0 不清理
+func (s *TaskStore) StartPruner(retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	go func() {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		for {
+			if n, err := s.Prune(retention); err != nil {
+				log.Printf("[tasks] prune: %v", err)
+			} else if n > 0 {
+				log.Printf("[tasks] pruned %d task(s) older than %s", n, retention)
+			}
+			<-tk.C
+		}
+	}()
+}
+
+// RecoverOrphans：启动时调用（执行器启动前），把上次进程遗留的 PENDING/RUNNING 任务标记为 FAILED
+func (s *TaskStore) RecoverOrphans() (int64, error) {
+	now := time.Now()
+	tx := s.db.Model(&models.TaskRecord{}).
+		Where("status IN ?", []string{string(sshx.TaskPending), string(sshx.TaskRunning)}).
+		Updates(map[string]any{
+			"status":   string(sshx.TaskFailed),
+			"error":    orphanedError,
+			"code":     -1,
+			"ended_at": now,
+		})
+	return tx.RowsAffected, tx.Error
+}
+
+// ============ Task <-> TaskRecord ============
+
+func toRecord(t *sshx.Task) (*models.TaskRecord, error) {
+	cmd, err := json.Marshal(t.Command)
+	if err != nil {
+		return nil, err
+	}
+	rec := &models.TaskRecord{
+		ID:        t.ID,
+		JobID:     t.JobID,
+		Op:        t.Op,
+		HostID:    t.Host.ID,
+		HostName:  t.Host.Name,
+		HostIP:    t.Host.IP,
+		Status:    string(t.Status),
+		CreatedAt: t.CreatedAt,
+		StartedAt: optTime(t.StartedAt),
+		EndedAt:   optTime(t.EndedAt),
+		Retry:     t.Retry,
+		MaxRetry:  t.MaxRetry,
+		BackoffMS: t.Backoff.Milliseconds(),
+		Command:   string(cmd),
+		Code:      t.Result.Code,
+		Stdout:    t.Result.Stdout,
+		Stderr:    t.Result.Stderr,
+		SpentMS:   t.Result.Spent.Milliseconds(),
+		Strategy:  t.Result.Strategy,
+	}
+	if t.Result.Err != nil {
+		rec.Error = t.Result.Err.Error()
+	}
+	return rec, nil
+}
+
+func fromRecord(rec *models.TaskRecord) (*sshx.Task, error) {
+	t := &sshx.Task{
+		ID:        rec.ID,
+		JobID:     rec.JobID,
+		Op:        rec.Op,
+		Host:      models.Host{ID: rec.HostID, Name: rec.HostName, IP: rec.HostIP},
+		Status:    sshx.TaskStatus(rec.Status),
+		CreatedAt: rec.CreatedAt,
+		Retry:     rec.Retry,
+		MaxRetry:  rec.MaxRetry,
+		Backoff:   time.Duration(rec.BackoffMS) * time.Millisecond,
+		Result: sshx.Result{
+			HostIP:   rec.HostIP,
+			Stdout:   rec.Stdout,
+			Stderr:   rec.Stderr,
+			Code:     rec.Code,
+			Spent:    time.Duration(rec.SpentMS) * time.Millisecond,
+			Strategy: rec.Strategy,
+		},
+	}
+	if rec.StartedAt != nil {
+		t.StartedAt = *rec.StartedAt
+	}
+	if rec.EndedAt != nil {
+		t.EndedAt = *rec.EndedAt
+	}
+	if rec.Error != "" {
+		t.Result.Err = errors.New(rec.Error)
+	}
+	if err := json.Unmarshal([]byte(rec.Command), &t.Command); err != nil {
+		return nil, fmt.Errorf("decode command of task %s: %w", rec.ID, err)
+	}
+	return t, nil
+}
+
+func optTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"iptables-web/backend/internal/service"
+)
+
+// ConfirmHandler：commit-confirm 的确认 / 立即回滚
+type ConfirmHandler struct{ svc *service.ConfirmService }
+
+func NewConfirmHandler() *ConfirmHandler {
+	return &ConfirmHandler{svc: service.NewConfirmService()}
+}
+
+// confirmStatus：不存在 404，窗口已过（已回滚）410，其余视为远端执行失败 502
+func confirmStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrConfirmNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConfirmExpired):
+		return http.StatusGone
+	}
+	return http.StatusBadGateway
+}
+
+// GET /api/hosts/:id/confirms
+func (h *ConfirmHandler) List(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"confirms": h.svc.List(uint(hostID))})
+}
+
+// POST /api/hosts/:id/confirms/:confirmId  （确认变更，取消回滚）
+func (h *ConfirmHandler) Confirm(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.Confirm(uint(hostID), c.Param("confirmId")); err != nil {
+		c.JSON(confirmStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DELETE /api/hosts/:id/confirms/:confirmId  （放弃变更，立即回滚）
+func (h *ConfirmHandler) Rollback(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	opt := writeOptions(c)
+	opt.Reason = changeReason(c, "rollback confirm "+c.Param("confirmId"))
+	if err := h.svc.Rollback(uint(hostID), c.Param("confirmId"), opt); err != nil {
+		c.JSON(confirmStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
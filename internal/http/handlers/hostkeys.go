@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/service"
+)
+
+type HostKeyDTO struct {
+	HostID uint `json:"host_id"`
+	// none：尚未固定（下次连接 TOFU）| pinned：已固定 | mismatch：存在待审批的新 key
+	Status string          `json:"status"`
+	Pinned *models.HostKey `json:"pinned,omitempty"`
+}
+
+type approveHostKeyReq struct {
+	Fingerprint string `json:"fingerprint" binding:"required"`
+}
+
+type importKnownHostsReq struct {
+	Content   string `json:"content" binding:"required"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+type HostKeysHandler struct{ svc *service.HostKeyService }
+
+func NewHostKeysHandler() *HostKeysHandler {
+	return &HostKeysHandler{svc: service.NewHostKeyService()}
+}
+
+func hostKeyDTO(hostID uint, k *models.HostKey) HostKeyDTO {
+	out := HostKeyDTO{HostID: hostID, Status: "none"}
+	if k == nil || k.PublicKey == "" {
+		return out
+	}
+	out.Pinned = k
+	out.Status = "pinned"
+	if k.HasPending() {
+		out.Status = "mismatch"
+	}
+	return out
+}
+
+// GET /api/hosts/:id/hostkey
+func (h *HostKeysHandler) Get(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	k, err := h.svc.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hostKeyDTO(uint(id), k))
+}
+
+// POST /api/hosts/:id/hostkey/approve  { "fingerprint": "SHA256:..." }
+func (h *HostKeysHandler) Approve(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req approveHostKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	k, err := h.svc.Approve(uint(id), req.Fingerprint)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrNoPendingHostKey) || errors.Is(err, service.ErrFingerprintMismatch) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hostKeyDTO(uint(id), k))
+}
+
+// DELETE /api/hosts/:id/hostkey  （重置，下次连接重新 TOFU）
+func (h *HostKeysHandler) Reset(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.Reset(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/hostkeys/import  { "content": "<known_hosts>", "overwrite": false }
+func (h *HostKeysHandler) ImportKnownHosts(c *gin.Context) {
+	var req importKnownHostsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.svc.ImportKnownHosts(req.Content, req.Overwrite)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -8,17 +8,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 
+	"iptables-web/backend/internal/models"
 	"iptables-web/backend/internal/service"
 )
 
 type HostDTO struct {
-	ID          uint   `json:"id"`
-	Name        string `json:"name"`
-	IP          string `json:"ip"`
-	Port        int    `json:"port"`
-	User        string `json:"user"`
-	RootUser    string `json:"root_user"`
-	LoginMethod string `json:"login_method"`
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	IP           string `json:"ip"`
+	Port         int    `json:"port"`
+	User         string `json:"user"`
+	RootUser     string `json:"root_user"`
+	LoginMethod  string `json:"login_method"`
+	AuthType     string `json:"auth_type"`
+	HasKey       bool   `json:"has_key"`
+	Certificate  string `json:"certificate,omitempty"`
+	AgentSocket  string `json:"agent_socket,omitempty"`
+	AgentForward bool   `json:"agent_forward"`
+	ViaHostID    *uint  `json:"via_host_id"`
 }
 
 // 创建
@@ -31,6 +38,16 @@ type CreateHostReq struct {
 	Password    string `json:"password" validate:"omitempty"`
 	RootUser    string `json:"root_user" validate:"omitempty"`
 	RootPass    string `json:"root_pass" validate:"omitempty"`
+
+	AuthType         string `json:"auth_type" validate:"omitempty,oneof=password key agent"`
+	PrivateKey       string `json:"private_key" validate:"omitempty"`
+	KeyPassphrase    string `json:"key_passphrase" validate:"omitempty"`
+	ClearPassphrase  bool   `json:"clear_passphrase"` // 仅修改时有效
+	Certificate      string `json:"certificate" validate:"omitempty"`
+	ClearCertificate bool   `json:"clear_certificate"` // 仅修改时有效
+	AgentSocket      string `json:"agent_socket" validate:"omitempty"`
+	AgentForward     bool   `json:"agent_forward"`
+	ViaHostID        *uint  `json:"via_host_id" validate:"omitempty,gt=0"` // 跳板机（也是已管理主机）
 }
 
 // 修改（与创建一致，但密码可留空表示不改）
@@ -45,6 +62,25 @@ func NewHostsHandler() *HostsHandler {
 	return &HostsHandler{svc: service.NewHostsService(), validate: validator.New()}
 }
 
+func hostDTO(x *models.Host) HostDTO {
+	return HostDTO{
+		ID: x.ID, Name: x.Name, IP: x.IP, Port: portOrDefault(x.Port),
+		User: x.User, RootUser: x.RootUser, LoginMethod: x.LoginMethod,
+		AuthType: x.AuthType, HasKey: x.PrivateKey != "", Certificate: x.Certificate,
+		AgentSocket: x.AgentSocket, AgentForward: x.AgentForward,
+		ViaHostID: x.ViaHostID,
+	}
+}
+
+// normAuthType：创建时 auth_type 缺省为 password；更新时留空表示不改，不走这里
+func normAuthType(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "password"
+	}
+	return s
+}
+
 // GET /api/hosts
 func (h *HostsHandler) List(c *gin.Context) {
 	hs, err := h.svc.List()
@@ -53,11 +89,8 @@ func (h *HostsHandler) List(c *gin.Context) {
 		return
 	}
 	out := make([]HostDTO, 0, len(hs))
-	for _, x := range hs {
-		out = append(out, HostDTO{
-			ID: x.ID, Name: x.Name, IP: x.IP, Port: portOrDefault(x.Port),
-			User: x.User, RootUser: x.RootUser, LoginMethod: x.LoginMethod,
-		})
+	for i := range hs {
+		out = append(out, hostDTO(&hs[i]))
 	}
 	c.JSON(http.StatusOK, out)
 }
@@ -70,11 +103,7 @@ func (h *HostsHandler) Get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	c.JSON(http.StatusOK, HostDTO{
-		ID: host.ID, Name: host.Name, IP: host.IP,
-		Port: portOrDefault(host.Port), User: host.User,
-		RootUser: host.RootUser, LoginMethod: host.LoginMethod,
-	})
+	c.JSON(http.StatusOK, hostDTO(host))
 }
 
 // POST /api/hosts
@@ -90,22 +119,29 @@ func (h *HostsHandler) Create(c *gin.Context) {
 	}
 
 	method := strings.ToLower(strings.TrimSpace(req.LoginMethod))
+	authType := normAuthType(req.AuthType)
+	// 私钥/agent 登录：登录密码不再必填（sudo 密码可选，su 仍需要 root 密码）；私钥登录必须提供私钥
+	keyAuth := authType != "password"
+	if authType == "key" && strings.TrimSpace(req.PrivateKey) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "私钥登录需要填写 私钥"})
+		return
+	}
 	// 业务校验（与前端一致）
 	switch method {
 	case "sudo":
-		if strings.TrimSpace(req.User) == "" || strings.TrimSpace(req.Password) == "" {
+		if strings.TrimSpace(req.User) == "" || (!keyAuth && strings.TrimSpace(req.Password) == "") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "sudo 登录需要填写 普通账号 与 密码"})
 			return
 		}
 		req.RootUser, req.RootPass = "", ""
 	case "root":
-		if strings.TrimSpace(req.RootUser) == "" || strings.TrimSpace(req.RootPass) == "" {
+		if strings.TrimSpace(req.RootUser) == "" || (!keyAuth && strings.TrimSpace(req.RootPass) == "") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "root 登录需要填写 root 用户 与 密码"})
 			return
 		}
 		req.User, req.Password = "", ""
 	case "user":
-		if strings.TrimSpace(req.User) == "" || strings.TrimSpace(req.Password) == "" ||
+		if strings.TrimSpace(req.User) == "" || (!keyAuth && strings.TrimSpace(req.Password) == "") ||
 			strings.TrimSpace(req.RootUser) == "" || strings.TrimSpace(req.RootPass) == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "普通账号登录需要填写 普通账号/密码 以及 root 用户/密码"})
 			return
@@ -124,15 +160,20 @@ func (h *HostsHandler) Create(c *gin.Context) {
 		Password:    req.Password,
 		RootUser:    req.RootUser,
 		RootPass:    req.RootPass,
+
+		AuthType:      authType,
+		PrivateKey:    req.PrivateKey,
+		KeyPassphrase: req.KeyPassphrase,
+		Certificate:   req.Certificate,
+		AgentSocket:   req.AgentSocket,
+		AgentForward:  req.AgentForward,
+		ViaHostID:     req.ViaHostID,
 	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, HostDTO{
-		ID: m.ID, Name: m.Name, IP: m.IP, Port: portOrDefault(m.Port),
-		User: m.User, RootUser: m.RootUser, LoginMethod: m.LoginMethod,
-	})
+	c.JSON(http.StatusOK, hostDTO(m))
 }
 
 // PUT /api/hosts/:id
@@ -148,7 +189,8 @@ func (h *HostsHandler) Update(c *gin.Context) {
 		return
 	}
 	method := strings.ToLower(strings.TrimSpace(req.LoginMethod))
-	// 与创建相同的业务校验，区别：密码可以留空表示不改
+	authType := strings.ToLower(strings.TrimSpace(req.AuthType))
+	// 与创建相同的业务校验，区别：密码/私钥/认证方式可以留空表示不改（私钥是否已存在由 service 校验）
 	switch method {
 	case "sudo":
 		if strings.TrimSpace(req.User) == "" {
@@ -182,15 +224,22 @@ func (h *HostsHandler) Update(c *gin.Context) {
 		Password:    strings.TrimSpace(req.Password), // 空串 => 不改
 		RootUser:    req.RootUser,
 		RootPass:    strings.TrimSpace(req.RootPass), // 空串 => 不改
+
+		AuthType:         authType,          // 空串 => 不改
+		PrivateKey:       req.PrivateKey,    // 空串 => 不改
+		KeyPassphrase:    req.KeyPassphrase, // 空串 => 不改
+		Certificate:      req.Certificate,   // 空串 => 不改
+		ClearPassphrase:  req.ClearPassphrase,
+		ClearCertificate: req.ClearCertificate,
+		AgentSocket:      req.AgentSocket,
+		AgentForward:     req.AgentForward,
+		ViaHostID:        req.ViaHostID,
 	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, HostDTO{
-		ID: m.ID, Name: m.Name, IP: m.IP, Port: portOrDefault(m.Port),
-		User: m.User, RootUser: m.RootUser, LoginMethod: m.LoginMethod,
-	})
+	c.JSON(http.StatusOK, hostDTO(m))
 }
 
 // DELETE /api/hosts/:id
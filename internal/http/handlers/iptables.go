@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -14,29 +15,38 @@ import (
 )
 
 type ChainDTO struct {
-	Name    string `json:"name"`
-	Policy  string `json:"policy,omitempty"`
-	Builtin bool   `json:"builtin"`
+	Name       string `json:"name"`
+	Policy     string `json:"policy,omitempty"`
+	Builtin    bool   `json:"builtin"`
+	References int    `json:"references"`
+	Packets    uint64 `json:"packets"`
+	Bytes      uint64 `json:"bytes"`
 }
 
 type RuleDTO struct {
-	ID         string   `json:"id"`
-	Num        int      `json:"num"`
-	Chain      string   `json:"chain"`
-	Table      string   `json:"table"`
-	Family     string   `json:"family"`
-	Protocol   string   `json:"protocol"`
-	SourceIP   string   `json:"sourceIp"`
-	SourcePort string   `json:"sourcePort"`
-	DestIP     string   `json:"destIp"`
-	DestPort   string   `json:"destPort"`
-	Action     string   `json:"action"`
-	State      []string `json:"state"`
-	Interface  string   `json:"interface"`
-	ToPort     string   `json:"toPort"`
-	ToSource   string   `json:"toSource"`
-	Comment    string   `json:"comment,omitempty"`
-	Spec       string   `json:"spec"`
+	ID           string                 `json:"id"`
+	Num          int                    `json:"num"`
+	Chain        string                 `json:"chain"`
+	Table        string                 `json:"table"`
+	Family       string                 `json:"family"`
+	Protocol     string                 `json:"protocol"`
+	SourceIP     string                 `json:"sourceIp"`
+	SourcePort   string                 `json:"sourcePort"`
+	DestIP       string                 `json:"destIp"`
+	DestPort     string                 `json:"destPort"`
+	Action       string                 `json:"action"`
+	State        []string               `json:"state"`
+	Interface    string                 `json:"interface"`
+	OutInterface string                 `json:"outInterface"`
+	Negate       service.RuleNegation   `json:"negate"`
+	ToPort       string                 `json:"toPort"`
+	ToSource     string                 `json:"toSource"`
+	Comment      string                 `json:"comment,omitempty"`
+	Matches      []service.MatchSpec    `json:"matches,omitempty"`
+	Target       *service.TargetOptions `json:"targetOptions,omitempty"`
+	Spec         string                 `json:"spec"`
+	Packets      uint64                 `json:"packets"`
+	Bytes        uint64                 `json:"bytes"`
 }
 
 // 请求体，与前端 src/types/iptables.ts 中的 ChainInput / RuleInput 对应
@@ -45,22 +55,45 @@ type createChainReq struct {
 }
 
 type createRuleReq struct {
-	Num        *int     `json:"num" validate:"omitempty,gte=1"`
-	Protocol   string   `json:"protocol" validate:"required"`
-	SourceIP   string   `json:"sourceIp" validate:"omitempty"`
-	SourcePort string   `json:"sourcePort" validate:"omitempty"`
-	DestIP     string   `json:"destIp" validate:"omitempty"`
-	DestPort   string   `json:"destPort" validate:"omitempty"`
-	Action     string   `json:"action" validate:"required"`
-	State      []string `json:"state" validate:"omitempty"`
-	Interface  string   `json:"interface" validate:"omitempty"`
-	ToPort     string   `json:"toPort" validate:"omitempty"`
-	ToSource   string   `json:"toSource" validate:"omitempty"`
-	Comment    string   `json:"comment" validate:"omitempty"`
+	Num          *int                   `json:"num" validate:"omitempty,gte=1"`
+	Protocol     string                 `json:"protocol" validate:"required"`
+	SourceIP     string                 `json:"sourceIp" validate:"omitempty"`
+	SourcePort   string                 `json:"sourcePort" validate:"omitempty"`
+	DestIP       string                 `json:"destIp" validate:"omitempty"`
+	DestPort     string                 `json:"destPort" validate:"omitempty"`
+	Action       string                 `json:"action" validate:"required"`
+	State        []string               `json:"state" validate:"omitempty"`
+	Interface    string                 `json:"interface" validate:"omitempty"`
+	OutInterface string                 `json:"outInterface" validate:"omitempty"`
+	Negate       service.RuleNegation   `json:"negate"`
+	ToPort       string                 `json:"toPort" validate:"omitempty"`
+	ToSource     string                 `json:"toSource" validate:"omitempty"`
+	Comment      string                 `json:"comment" validate:"omitempty"`
+	Matches      []service.MatchSpec    `json:"matches" validate:"omitempty,dive"`
+	Target       *service.TargetOptions `json:"targetOptions"`
 }
 
 type updateRuleReq = createRuleReq
 
+type setPolicyReq struct {
+	Policy string `json:"policy" validate:"required,oneof=ACCEPT DROP accept drop"`
+	Force  bool   `json:"force"` // 同 ?allowLockout=true
+}
+
+type renameChainReq struct {
+	Name string `json:"name" validate:"required,min=1,max=28"`
+}
+
+type moveRuleReq struct {
+	Position int    `json:"position" validate:"omitempty,gte=1"`
+	Before   string `json:"before"`
+	After    string `json:"after"`
+}
+
+type reorderChainReq struct {
+	Order []string `json:"order" validate:"required,min=1,dive,required"`
+}
+
 type IptablesHandler struct {
 	svc      *service.IptablesService
 	validate *validator.Validate
@@ -91,17 +124,21 @@ func (h *IptablesHandler) ListChains(c *gin.Context) {
 	family := parseFamily(c.Param("family"))
 	table := parseTable(c.Param("table"))
 
-	cs, err := h.svc.ListChains(uint(hostID), family, table)
+	cs, rev, err := h.svc.ListChains(uint(hostID), family, table)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	setETag(c, rev)
 	out := make([]ChainDTO, 0, len(cs))
 	for _, x := range cs {
 		out = append(out, ChainDTO{
-			Name:    x.Name,
-			Policy:  x.Policy,
-			Builtin: x.Builtin,
+			Name:       x.Name,
+			Policy:     x.Policy,
+			Builtin:    x.Builtin,
+			References: x.References,
+			Packets:    x.Packets,
+			Bytes:      x.Bytes,
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{"chains": out})
@@ -123,25 +160,103 @@ func (h *IptablesHandler) CreateChain(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.CreateChain(uint(hostID), family, table, service.ChainInput{Name: req.Name}); err != nil {
+	res, err := h.svc.CreateChain(uint(hostID), family, table, service.ChainInput{Name: req.Name}, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(writeStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
+
+// GET /api/hosts/:id/iptables/:family/:table/chains/graph
+func (h *IptablesHandler) ChainGraph(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+
+	g, err := h.svc.ChainGraph(uint(hostID), family, table)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	setETag(c, g.Revision)
+	c.JSON(http.StatusOK, g)
 }
 
-// DELETE /api/hosts/:id/iptables/:family/:table/chains/:chain
+// DELETE /api/hosts/:id/iptables/:family/:table/chains/:chain[?cascade=true]
+// 链被引用或非空时 409；cascade 会一并删除引用它的规则并清空该链
 func (h *IptablesHandler) DeleteChain(c *gin.Context) {
 	hostID, _ := strconv.Atoi(c.Param("id"))
 	family := parseFamily(c.Param("family"))
 	table := parseTable(c.Param("table"))
 	chainName, _ := urlDecode(c.Param("chain"))
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+
+	res, err := h.svc.DeleteChain(uint(hostID), family, table, chainName, cascade, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(chainStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
 
-	if err := h.svc.DeleteChain(uint(hostID), family, table, chainName); err != nil {
+// PUT /api/hosts/:id/iptables/:family/:table/chains/:chain/policy
+// body: {"policy": "DROP", "force": false}；改策略同样走防锁死模拟，会切断管理连接时 409，force 等同 ?allowLockout=true
+func (h *IptablesHandler) SetPolicy(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+	chainName, _ := urlDecode(c.Param("chain"))
+
+	var req setPolicyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.svc.SetPolicy(uint(hostID), family, table, chainName, service.PolicyInput{
+		Policy: req.Policy,
+		Force:  req.Force,
+	}, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(chainStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
+
+// POST /api/hosts/:id/iptables/:family/:table/chains/:chain/rename
+// body: {"name": "NEW_NAME"}；表内引用该链的 -j / -g 一并改写
+func (h *IptablesHandler) RenameChain(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+	chainName, _ := urlDecode(c.Param("chain"))
+
+	var req renameChainReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.svc.RenameChain(uint(hostID), family, table, chainName, req.Name, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(chainStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
 }
 
 // GET /api/hosts/:id/iptables/:family/:table/chains/:chain/rules
@@ -151,31 +266,38 @@ func (h *IptablesHandler) ListRules(c *gin.Context) {
 	table := parseTable(c.Param("table"))
 	chainName, _ := urlDecode(c.Param("chain"))
 
-	rs, err := h.svc.ListRules(uint(hostID), family, table, chainName)
+	rs, rev, err := h.svc.ListRules(uint(hostID), family, table, chainName)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	setETag(c, rev)
 	out := make([]RuleDTO, 0, len(rs))
 	for _, x := range rs {
 		out = append(out, RuleDTO{
-			ID:         x.ID,
-			Num:        x.Num,
-			Chain:      x.Chain,
-			Table:      x.Table,
-			Family:     string(family),
-			Protocol:   x.Protocol,
-			SourceIP:   x.SourceIP,
-			SourcePort: x.SourcePort,
-			DestIP:     x.DestIP,
-			DestPort:   x.DestPort,
-			Action:     x.Action,
-			State:      x.State,
-			Interface:  x.Interface,
-			ToPort:     x.ToPort,
-			ToSource:   x.ToSource,
-			Comment:    x.Comment,
-			Spec:       x.Spec,
+			ID:           x.ID,
+			Num:          x.Num,
+			Chain:        x.Chain,
+			Table:        x.Table,
+			Family:       string(family),
+			Protocol:     x.Protocol,
+			SourceIP:     x.SourceIP,
+			SourcePort:   x.SourcePort,
+			DestIP:       x.DestIP,
+			DestPort:     x.DestPort,
+			Action:       x.Action,
+			State:        x.State,
+			Interface:    x.Interface,
+			OutInterface: x.OutInterface,
+			Negate:       x.Negate,
+			ToPort:       x.ToPort,
+			ToSource:     x.ToSource,
+			Comment:      x.Comment,
+			Matches:      x.Matches,
+			Target:       x.Target,
+			Spec:         x.Spec,
+			Packets:      x.Packets,
+			Bytes:        x.Bytes,
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{"rules": out})
@@ -198,24 +320,30 @@ func (h *IptablesHandler) CreateRule(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.CreateRule(uint(hostID), family, table, chainName, service.RuleInput{
-		Num:        req.Num,
-		Protocol:   req.Protocol,
-		SourceIP:   req.SourceIP,
-		SourcePort: req.SourcePort,
-		DestIP:     req.DestIP,
-		DestPort:   req.DestPort,
-		Action:     req.Action,
-		State:      req.State,
-		Interface:  req.Interface,
-		ToPort:     req.ToPort,
-		ToSource:   req.ToSource,
-		Comment:    req.Comment,
-	}); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	res, err := h.svc.CreateRule(uint(hostID), family, table, chainName, service.RuleInput{
+		Num:          req.Num,
+		Protocol:     req.Protocol,
+		SourceIP:     req.SourceIP,
+		SourcePort:   req.SourcePort,
+		DestIP:       req.DestIP,
+		DestPort:     req.DestPort,
+		Action:       req.Action,
+		State:        req.State,
+		Interface:    req.Interface,
+		OutInterface: req.OutInterface,
+		Negate:       req.Negate,
+		ToPort:       req.ToPort,
+		ToSource:     req.ToSource,
+		Comment:      req.Comment,
+		Matches:      req.Matches,
+		Target:       req.Target,
+	}, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(writeStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	writeDone(c, res)
 }
 
 // PUT /api/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId
@@ -236,24 +364,30 @@ func (h *IptablesHandler) UpdateRule(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.UpdateRule(uint(hostID), family, table, chainName, ruleID, service.RuleInput{
-		Num:        req.Num,
-		Protocol:   req.Protocol,
-		SourceIP:   req.SourceIP,
-		SourcePort: req.SourcePort,
-		DestIP:     req.DestIP,
-		DestPort:   req.DestPort,
-		Action:     req.Action,
-		State:      req.State,
-		Interface:  req.Interface,
-		ToPort:     req.ToPort,
-		ToSource:   req.ToSource,
-		Comment:    req.Comment,
-	}); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	res, err := h.svc.UpdateRule(uint(hostID), family, table, chainName, ruleID, service.RuleInput{
+		Num:          req.Num,
+		Protocol:     req.Protocol,
+		SourceIP:     req.SourceIP,
+		SourcePort:   req.SourcePort,
+		DestIP:       req.DestIP,
+		DestPort:     req.DestPort,
+		Action:       req.Action,
+		State:        req.State,
+		Interface:    req.Interface,
+		OutInterface: req.OutInterface,
+		Negate:       req.Negate,
+		ToPort:       req.ToPort,
+		ToSource:     req.ToSource,
+		Comment:      req.Comment,
+		Matches:      req.Matches,
+		Target:       req.Target,
+	}, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(ruleStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	writeDone(c, res)
 }
 
 // DELETE /api/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId
@@ -264,11 +398,89 @@ func (h *IptablesHandler) DeleteRule(c *gin.Context) {
 	chainName, _ := urlDecode(c.Param("chain"))
 	ruleID, _ := urlDecode(c.Param("ruleId"))
 
-	if err := h.svc.DeleteRule(uint(hostID), family, table, chainName, ruleID); err != nil {
+	res, err := h.svc.DeleteRule(uint(hostID), family, table, chainName, ruleID, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(ruleStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
+
+// POST /api/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId/zero
+func (h *IptablesHandler) ZeroRule(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+	chainName, _ := urlDecode(c.Param("chain"))
+	ruleID, _ := urlDecode(c.Param("ruleId"))
+
+	res, err := h.svc.ZeroRule(uint(hostID), family, table, chainName, ruleID, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(ruleStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
+
+// POST /api/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId/move
+// body: {"position": 3} 或 {"before": "<ruleId>"} 或 {"after": "<ruleId>"}
+func (h *IptablesHandler) MoveRule(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+	chainName, _ := urlDecode(c.Param("chain"))
+	ruleID, _ := urlDecode(c.Param("ruleId"))
+
+	var req moveRuleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.svc.MoveRule(uint(hostID), family, table, chainName, ruleID, service.MoveInput{
+		Position: req.Position,
+		Before:   req.Before,
+		After:    req.After,
+	}, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(ruleStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
+
+// PUT /api/hosts/:id/iptables/:family/:table/chains/:chain/rules/order
+// body: {"order": ["<ruleId>", ...]}，必须是该链全部规则的一个排列
+func (h *IptablesHandler) ReorderChain(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	family := parseFamily(c.Param("family"))
+	table := parseTable(c.Param("table"))
+	chainName, _ := urlDecode(c.Param("chain"))
+
+	var req reorderChainReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.svc.ReorderChain(uint(hostID), family, table, chainName, req.Order, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(ruleStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
 }
 
 // DELETE /api/hosts/:id/iptables/:family/:table/chains/:chain/rules  （清空链）
@@ -278,11 +490,33 @@ func (h *IptablesHandler) ClearChain(c *gin.Context) {
 	table := parseTable(c.Param("table"))
 	chainName, _ := urlDecode(c.Param("chain"))
 
-	if err := h.svc.ClearChain(uint(hostID), family, table, chainName); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	res, err := h.svc.ClearChain(uint(hostID), family, table, chainName, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(writeStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
-	c.Status(http.StatusNoContent)
+	writeDone(c, res)
+}
+
+// ruleStatus：ruleId 在当前规则集中已不存在时返回 404，其余 400
+func ruleStatus(err error) int {
+	if errors.Is(err, service.ErrRuleNotFound) {
+		return http.StatusNotFound
+	}
+	return writeStatus(err, http.StatusBadRequest)
+}
+
+// chainStatus：链不存在 404，重名 / 有锁死风险 / 仍被引用 409，其余同 ruleStatus
+func chainStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrChainNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrChainExists), errors.Is(err, service.ErrLockoutRisk),
+		errors.Is(err, service.ErrChainInUse):
+		return http.StatusConflict
+	}
+	return ruleStatus(err)
 }
 
 // 小工具：对 URL path 中 encodeURIComponent 的内容解码
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"iptables-web/backend/internal/service"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+type TaskDTO struct {
+	ID        string     `json:"id"`
+	HostID    uint       `json:"host_id"`
+	HostName  string     `json:"host_name"`
+	HostIP    string     `json:"host_ip"`
+	Status    string     `json:"status"`
+	Retry     int        `json:"retry"`
+	MaxRetry  int        `json:"max_retry"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Code      int        `json:"code"`
+	Stdout    string     `json:"stdout"`
+	Stderr    string     `json:"stderr"`
+	Error     string     `json:"error,omitempty"`
+	Spent     string     `json:"spent,omitempty"`
+}
+
+type JobDTO struct {
+	ID        string     `json:"id"`
+	Op        string     `json:"op"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Tasks     []TaskDTO  `json:"tasks"`
+}
+
+type createJobReq struct {
+	HostIDs   []uint `json:"host_ids" binding:"required,min=1"`
+	Op        string `json:"op"       binding:"required,oneof=save restore append insert delete flush zero"`
+	V         string `json:"v"        binding:"omitempty,oneof=4 6"`
+	Table     string `json:"table"    binding:"omitempty,oneof=filter nat mangle raw security"`
+	Chain     string `json:"chain"`
+	Rule      string `json:"rule"`
+	Pos       int    `json:"pos"`
+	Num       int    `json:"num"`
+	Content   string `json:"content"`
+	MaxRetry  int    `json:"max_retry"  binding:"gte=0,lte=10"`
+	BackoffMS int    `json:"backoff_ms" binding:"gte=0"`
+	TimeoutS  int    `json:"timeout_s"  binding:"gte=0"`
+
+	AllowLockout bool `json:"allow_lockout"` // 防锁死模拟显示有风险时仍然执行
+
+	// 修改类作业必填：host_id -> 读接口返回的 ETag；force=true 时不校验版本号（可能覆盖并发修改）
+	Revisions map[uint]string `json:"revisions"`
+	Force     bool            `json:"force"`
+}
+
+type JobsHandler struct{ svc *service.JobsService }
+
+func NewJobsHandler() *JobsHandler { return &JobsHandler{svc: service.Jobs()} }
+
+func optTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func taskDTO(t *sshx.Task) TaskDTO {
+	out := TaskDTO{
+		ID: t.ID, HostID: t.Host.ID, HostName: t.Host.Name, HostIP: t.Host.IP,
+		Status: string(t.Status), Retry: t.Retry, MaxRetry: t.MaxRetry,
+		StartedAt: optTime(t.StartedAt), EndedAt: optTime(t.EndedAt),
+		Code: t.Result.Code, Stdout: t.Result.Stdout, Stderr: t.Result.Stderr,
+	}
+	if t.Result.Err != nil {
+		out.Error = t.Result.Err.Error()
+	}
+	if t.Result.Spent > 0 {
+		out.Spent = t.Result.Spent.String()
+	}
+	return out
+}
+
+func jobDTO(j *service.Job) JobDTO {
+	out := JobDTO{
+		ID: j.ID, Op: j.Op, Status: string(j.Status),
+		CreatedAt: j.CreatedAt, EndedAt: optTime(j.EndedAt),
+		Tasks: make([]TaskDTO, 0, len(j.Tasks)),
+	}
+	for _, t := range j.Tasks {
+		out.Tasks = append(out.Tasks, taskDTO(t))
+	}
+	return out
+}
+
+// POST /api/jobs  （异步执行，立即返回 202 + 作业）
+// 修改类作业缺少某台主机的 revisions 且未指定 force 时返回 428
+func (h *JobsHandler) Create(c *gin.Context) {
+	var req createJobReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	j, err := h.svc.Submit(service.JobInput{
+		HostIDs: req.HostIDs,
+		Op:      req.Op,
+		V6:      req.V == "6",
+		Table:   req.Table,
+		Chain:   req.Chain,
+		Rule:    req.Rule,
+		Pos:     req.Pos,
+		Num:     req.Num,
+		Content: req.Content,
+		Retry: sshx.RetryPolicy{
+			MaxRetry: req.MaxRetry,
+			Backoff:  time.Duration(req.BackoffMS) * time.Millisecond,
+		},
+		Timeout:      time.Duration(req.TimeoutS) * time.Second,
+		Author:       writeOptions(c).Author,
+		AllowLockout: req.AllowLockout,
+		Revisions:    req.Revisions,
+		Force:        req.Force,
+	})
+	if err != nil {
+		c.JSON(writeStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, jobDTO(j))
+}
+
+// GET /api/jobs?host_id=1&status=FAILED,CANCELED&since=RFC3339&until=RFC3339&limit=50
+func (h *JobsHandler) List(c *gin.Context) {
+	var f sshx.TaskFilter
+	if v := c.Query("host_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid host_id"})
+			return
+		}
+		f.HostID = uint(id)
+	}
+	for _, st := range strings.Split(c.Query("status"), ",") {
+		if st = strings.ToUpper(strings.TrimSpace(st)); st != "" {
+			f.Status = append(f.Status, sshx.TaskStatus(st))
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + " (RFC3339)"})
+				return
+			}
+			*p.dst = t
+		}
+	}
+	f.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	js, err := h.svc.List(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]JobDTO, 0, len(js))
+	for _, j := range js {
+		out = append(out, jobDTO(j))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/jobs/:id
+func (h *JobsHandler) Get(c *gin.Context) {
+	j, err := h.svc.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobDTO(j))
+}
+
+// POST /api/jobs/:id/cancel
+func (h *JobsHandler) Cancel(c *gin.Context) {
+	j, err := h.svc.Cancel(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrJobFinished):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, jobDTO(j))
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+type PoolHandler struct{ pool *sshx.Pool }
+
+func NewPoolHandler() *PoolHandler { return &PoolHandler{pool: sshx.DefaultPool()} }
+
+// GET /api/ssh/pool
+func (h *PoolHandler) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.pool.Stats())
+}
+
+// DELETE /api/ssh/pool/:hostId  （断开某主机的全部连接）
+func (h *PoolHandler) Evict(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("hostId"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hostId"})
+		return
+	}
+	h.pool.Invalidate(uint(id))
+	c.Status(http.StatusNoContent)
+}
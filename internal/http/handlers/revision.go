@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iptables-web/backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeOptions：写接口的前置条件取自 If-Match 头（值为读接口返回的 ETag）；
+// ?dryRun=true 只校验不生效；?confirm=<秒数> 或 ?confirm=true（默认窗口）开启 commit-confirm；
+// ?allowLockout=true 跳过防锁死拒绝，?protectSsh=true 自动补放行管理连接的规则；
+// 修改前快照的操作者取 X-Operator 头（缺省为客户端 IP），原因取 X-Change-Reason 头（缺省为请求方法和路径）
+func writeOptions(c *gin.Context) service.WriteOptions {
+	opt := service.WriteOptions{
+		IfMatch: c.GetHeader("If-Match"),
+		Author:  c.GetHeader("X-Operator"),
+		Reason:  changeReason(c, c.Request.Method+" "+c.Request.URL.Path),
+	}
+	if opt.Author == "" {
+		opt.Author = c.ClientIP()
+	}
+	opt.DryRun, _ = strconv.ParseBool(c.Query("dryRun"))
+	opt.AllowLockout, _ = strconv.ParseBool(c.Query("allowLockout"))
+	opt.ProtectSSH, _ = strconv.ParseBool(c.Query("protectSsh"))
+	if v := c.Query("confirm"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			opt.Confirm, opt.ConfirmTimeout = n > 0, time.Duration(n)*time.Second
+		} else {
+			opt.Confirm, _ = strconv.ParseBool(v)
+		}
+	}
+	return opt
+}
+
+func changeReason(c *gin.Context, def string) string {
+	if v := c.GetHeader("X-Change-Reason"); v != "" {
+		return v
+	}
+	return def
+}
+
+// writeDone：写成功返回 204；dry-run 时返回 200 和校验结果；
+// commit-confirm 时返回 202 和待确认信息，需在 deadline 前调用确认接口；
+// 修改前快照的 ID 放在 X-Snapshot-Id 头
+func writeDone(c *gin.Context, res service.WriteResult) {
+	if res.Snapshot != 0 {
+		c.Header("X-Snapshot-Id", strconv.FormatUint(uint64(res.Snapshot), 10))
+	}
+	switch {
+	case res.DryRun != nil:
+		c.JSON(http.StatusOK, res.DryRun)
+	case res.Confirm != nil:
+		c.JSON(http.StatusAccepted, gin.H{"revision": res.Revision, "confirm": res.Confirm, "snapshot": res.Snapshot})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// setETag：规则集版本号以强 ETag 形式返回
+func setETag(c *gin.Context, rev string) {
+	if rev != "" {
+		c.Header("ETag", `"`+rev+`"`)
+	}
+}
+
+// writeStatus：缺少 If-Match 返回 428，版本不一致返回 412，有待确认的变更或有锁死风险返回 409，
+// 修改前快照保存失败返回 500（修改未执行）；其余错误用 fallback
+func writeStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, service.ErrConfirmPending), errors.Is(err, service.ErrLockoutRisk):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, service.ErrRevisionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrSnapshotFailed):
+		return http.StatusInternalServerError
+	}
+	return fallback
+}
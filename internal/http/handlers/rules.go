@@ -31,6 +31,9 @@ func (h *RulesHandler) Current(c *gin.Context) {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	if rev, err := service.Revision(text); err == nil {
+		setETag(c, rev)
+	}
 	c.JSON(200, gin.H{"hostId": hostID, "v": v, "text": text})
 }
 
@@ -64,6 +67,9 @@ func (rh *RulesHandler) GetCurrentRules(c *gin.Context) {
 		return
 	}
 
+	if rev, err := service.Revision(text); err == nil {
+		setETag(c, rev)
+	}
 	c.JSON(http.StatusOK, rulesResp{Text: trimmed})
 }
 
@@ -75,5 +81,6 @@ func (h *RulesHandler) GetCurrentRulesView(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
+	setETag(c, view.Revision)
 	c.JSON(http.StatusOK, view)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 
@@ -21,7 +22,26 @@ type RuleOpReq struct {
 
 type RulesOpsHandler struct{ svc *service.RulesOpsService }
 
-func NewRulesOpsHandler() *RulesOpsHandler { return &RulesOpsHandler{svc: &service.RulesOpsService{}} }
+func NewRulesOpsHandler() *RulesOpsHandler {
+	return &RulesOpsHandler{svc: service.NewRulesOpsService()}
+}
+
+// opStatus：参数校验失败 400，其余视为远端执行失败 502
+func opStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidInput) {
+		return 400
+	}
+	return writeStatus(err, 502)
+}
+
+// opDone：写成功；commit-confirm 时附上待确认信息；snapshot 为修改前快照的 ID
+func opDone(c *gin.Context, res service.WriteResult) {
+	if res.Confirm != nil {
+		c.JSON(202, gin.H{"ok": true, "confirm": res.Confirm, "snapshot": res.Snapshot})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true, "snapshot": res.Snapshot})
+}
 
 func (h *RulesOpsHandler) Flush(c *gin.Context) {
 	var r RuleOpReq
@@ -33,11 +53,13 @@ func (h *RulesOpsHandler) Flush(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table required"})
 		return
 	}
-	if err := h.svc.Flush(r.HostID, r.V == "6", r.Table, r.Chain); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.Flush(r.HostID, r.V == "6", r.Table, r.Chain, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) Zero(c *gin.Context) {
 	var r RuleOpReq
@@ -49,11 +71,13 @@ func (h *RulesOpsHandler) Zero(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table required"})
 		return
 	}
-	if err := h.svc.Zero(r.HostID, r.V == "6", r.Table, r.Chain); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.Zero(r.HostID, r.V == "6", r.Table, r.Chain, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) ClearUserChains(c *gin.Context) {
 	var r RuleOpReq
@@ -65,11 +89,13 @@ func (h *RulesOpsHandler) ClearUserChains(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table required"})
 		return
 	}
-	if err := h.svc.ClearUserChains(r.HostID, r.V == "6", r.Table); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.ClearUserChains(r.HostID, r.V == "6", r.Table, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) Append(c *gin.Context) {
 	var r RuleOpReq
@@ -81,11 +107,13 @@ func (h *RulesOpsHandler) Append(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table, chain, rule required"})
 		return
 	}
-	if err := h.svc.Append(r.HostID, r.V == "6", r.Table, r.Chain, r.Rule); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.Append(r.HostID, r.V == "6", r.Table, r.Chain, r.Rule, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) Insert(c *gin.Context) {
 	var r RuleOpReq
@@ -97,11 +125,13 @@ func (h *RulesOpsHandler) Insert(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table, chain, pos, rule required"})
 		return
 	}
-	if err := h.svc.Insert(r.HostID, r.V == "6", r.Table, r.Chain, r.Pos, r.Rule); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.Insert(r.HostID, r.V == "6", r.Table, r.Chain, r.Pos, r.Rule, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) Delete(c *gin.Context) {
 	var r RuleOpReq
@@ -113,20 +143,23 @@ func (h *RulesOpsHandler) Delete(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "table, chain, num required"})
 		return
 	}
-	if err := h.svc.Delete(r.HostID, r.V == "6", r.Table, r.Chain, r.Num); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	res, err := h.svc.Delete(r.HostID, r.V == "6", r.Table, r.Chain, r.Num, writeOptions(c))
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	opDone(c, res)
 }
 func (h *RulesOpsHandler) Export(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Query("hostId"))
 	v6 := c.Query("v") == "6"
-	text, err := h.svc.Export(uint(id), v6)
+	text, rev, err := h.svc.Export(uint(id), v6)
 	if err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	setETag(c, rev)
 	c.Header("Content-Type", "text/plain; charset=utf-8")
 	c.String(200, text)
 }
@@ -135,14 +168,49 @@ func (h *RulesOpsHandler) Import(c *gin.Context) {
 		HostID  uint   `json:"hostId"`
 		V       string `json:"v"`
 		Content string `json:"content"`
+		DryRun  bool   `json:"dryRun"` // 同 ?dryRun=true
+
+		AllowLockout bool `json:"allowLockout"` // 同 ?allowLockout=true
+		ProtectSSH   bool `json:"protectSsh"`   // 同 ?protectSsh=true
 	}
 	if err := c.ShouldBindJSON(&r); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	if err := h.svc.Import(r.HostID, r.V == "6", r.Content); err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
+	opt := writeOptions(c)
+	opt.DryRun = opt.DryRun || r.DryRun
+	opt.AllowLockout = opt.AllowLockout || r.AllowLockout
+	opt.ProtectSSH = opt.ProtectSSH || r.ProtectSSH
+	res, err := h.svc.Import(r.HostID, r.V == "6", r.Content, opt)
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if res.DryRun != nil {
+		c.JSON(200, res.DryRun)
+		return
+	}
+	opDone(c, res)
+}
+
+// POST /api/hosts/:id/rules/diff
+// body: {"v": "4", "content": "<iptables-save 格式>"}；只比较 content 中出现的表
+func (h *RulesOpsHandler) Diff(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	var r struct {
+		V       string `json:"v" binding:"omitempty,oneof=4 6"`
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	d, err := h.svc.Diff(uint(hostID), r.V == "6", r.Content)
+	if err != nil {
+		c.JSON(opStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"ok": true})
+	setETag(c, d.Revision)
+	c.JSON(200, d)
 }
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"iptables-web/backend/internal/service"
+)
+
+// SnapshotHandler：规则集快照（每次修改前自动保存）的查看、比较与恢复
+type SnapshotHandler struct{ svc *service.SnapshotService }
+
+func NewSnapshotHandler() *SnapshotHandler {
+	return &SnapshotHandler{svc: service.NewSnapshotService()}
+}
+
+// snapshotStatus：不存在 404，参数错误 400，其余走 writeStatus（远端执行失败 502）
+func snapshotStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrSnapshotNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidInput):
+		return http.StatusBadRequest
+	}
+	return writeStatus(err, http.StatusBadGateway)
+}
+
+func snapshotIDs(c *gin.Context) (uint, uint, bool) {
+	hostID, err1 := strconv.ParseUint(c.Param("id"), 10, 64)
+	id, err2 := strconv.ParseUint(c.Param("snapshotId"), 10, 64)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, 0, false
+	}
+	return uint(hostID), uint(id), true
+}
+
+// GET /api/hosts/:id/snapshots?v=4|6&limit=&offset=  （不带 v 时两个协议族都返回）
+func (h *SnapshotHandler) List(c *gin.Context) {
+	hostID, _ := strconv.Atoi(c.Param("id"))
+	var v6 *bool
+	switch c.Query("v") {
+	case "4":
+		v6 = new(bool)
+	case "6":
+		v6 = new(bool)
+		*v6 = true
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	page, err := h.svc.List(uint(hostID), v6, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /api/hosts/:id/snapshots/:snapshotId  （含完整内容）
+func (h *SnapshotHandler) Get(c *gin.Context) {
+	hostID, id, ok := snapshotIDs(c)
+	if !ok {
+		return
+	}
+	snap, err := h.svc.Get(hostID, id)
+	if err != nil {
+		c.JSON(snapshotStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
+
+// GET /api/hosts/:id/snapshots/:snapshotId/diff?against=<snapshotId>
+// 不带 against 时比较线上规则集 → 快照，并返回线上版本号作为 ETag（恢复时用作 If-Match）
+func (h *SnapshotHandler) Diff(c *gin.Context) {
+	hostID, id, ok := snapshotIDs(c)
+	if !ok {
+		return
+	}
+	var against uint64
+	if v := c.Query("against"); v != "" {
+		var err error
+		if against, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid against"})
+			return
+		}
+	}
+	d, err := h.svc.Diff(hostID, id, uint(against))
+	if err != nil {
+		c.JSON(snapshotStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if against == 0 {
+		setETag(c, d.Revision)
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// POST /api/hosts/:id/snapshots/:snapshotId/restore  （If-Match 必填；支持 dryRun / confirm 等写接口参数）
+func (h *SnapshotHandler) Restore(c *gin.Context) {
+	hostID, id, ok := snapshotIDs(c)
+	if !ok {
+		return
+	}
+	opt := writeOptions(c)
+	opt.Reason = changeReason(c, "restore snapshot #"+c.Param("snapshotId"))
+	res, err := h.svc.Restore(hostID, id, opt)
+	setETag(c, res.Revision)
+	if err != nil {
+		c.JSON(snapshotStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeDone(c, res)
+}
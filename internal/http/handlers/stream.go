@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"iptables-web/backend/internal/service"
+)
+
+type streamReq struct {
+	HostIDs []uint `json:"host_ids" binding:"required,min=1"`
+	Op      string `json:"op"       binding:"required,oneof=save restore restore-test ping"`
+	V       string `json:"v"        binding:"omitempty,oneof=4 6"`
+	Content string `json:"content"`
+	Target  string `json:"target"`
+	Count   int    `json:"count"`
+
+	AllowLockout bool `json:"allow_lockout"` // restore：防锁死模拟显示有风险时仍然执行
+
+	// restore 必填：host_id -> 读接口返回的 ETag；force=true 时不校验版本号（可能覆盖并发修改）
+	Revisions map[uint]string `json:"revisions"`
+	Force     bool            `json:"force"`
+}
+
+type sseEvent struct {
+	name string
+	data any
+}
+
+type StreamHandler struct{ svc *service.StreamService }
+
+func NewStreamHandler() *StreamHandler { return &StreamHandler{svc: service.NewStreamService()} }
+
+// POST /api/exec/stream  （SSE：stdout / stderr 每行一个事件，每台主机结束发 done，全部结束发 end）
+// 客户端断开即取消，远端进程收到 SIGKILL；restore 缺少某台主机的 revisions 且未指定 force 时返回 428
+func (h *StreamHandler) Exec(c *gin.Context) {
+	var req streamReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := service.StreamInput{
+		HostIDs:      req.HostIDs,
+		Op:           req.Op,
+		V6:           req.V == "6",
+		Content:      req.Content,
+		Target:       req.Target,
+		Count:        req.Count,
+		Author:       writeOptions(c).Author,
+		AllowLockout: req.AllowLockout,
+		Revisions:    req.Revisions,
+		Force:        req.Force,
+	}
+	hs, cmd, err := h.svc.Prepare(in)
+	if err != nil {
+		status := writeStatus(err, http.StatusBadRequest)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	events := make(chan sseEvent, 256)
+	send := func(name string, data any) {
+		select {
+		case events <- sseEvent{name, data}:
+		case <-ctx.Done():
+		}
+	}
+	done := make(chan struct{})
+	failed := 0
+	go func() {
+		defer close(done)
+		h.svc.Run(ctx, in, hs, cmd,
+			func(l service.StreamLine) { send(l.Stream, l) },
+			func(d service.StreamDone) { send("done", d) },
+		)
+	}()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	emit := func(ev sseEvent) {
+		if d, ok := ev.data.(service.StreamDone); ok && (d.Error != "" || d.Code != 0) {
+			failed++
+		}
+		c.SSEvent(ev.name, ev.data)
+	}
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-events:
+			emit(ev)
+			return true
+		case <-done:
+			for {
+				select {
+				case ev := <-events:
+					emit(ev)
+				default:
+					c.SSEvent("end", gin.H{"hosts": len(hs), "failed": failed})
+					return false
+				}
+			}
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
@@ -33,6 +33,7 @@ func CORS(allowOrigins ...string) gin.HandlerFunc {
 			}
 			c.Header("Access-Control-Allow-Headers", reqHdr)
 			c.Header("Access-Control-Max-Age", "86400")
+			c.Header("Access-Control-Expose-Headers", "ETag") // 前端要读到规则集版本号
 		}
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent) // 204 预检放行
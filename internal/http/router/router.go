@@ -31,6 +31,21 @@ func Register(r *gin.Engine) {
 		api.PUT("/hosts/:id", hosts.Update)
 		api.DELETE("/hosts/:id", hosts.Delete)
 		api.POST("/hosts/batch-delete", hosts.BatchDelete)
+		hostKeys := handlers.NewHostKeysHandler()
+		api.GET("/hosts/:id/hostkey", hostKeys.Get)
+		api.POST("/hosts/:id/hostkey/approve", hostKeys.Approve)
+		api.DELETE("/hosts/:id/hostkey", hostKeys.Reset)
+		api.POST("/hostkeys/import", hostKeys.ImportKnownHosts) // 导入 OpenSSH known_hosts
+		pool := handlers.NewPoolHandler()
+		api.GET("/ssh/pool", pool.Stats)
+		api.DELETE("/ssh/pool/:hostId", pool.Evict)
+		jobs := handlers.NewJobsHandler()
+		api.POST("/jobs", jobs.Create) // 异步执行，返回 202
+		api.GET("/jobs", jobs.List)
+		api.GET("/jobs/:id", jobs.Get)
+		api.POST("/jobs/:id/cancel", jobs.Cancel)
+		stream := handlers.NewStreamHandler()
+		api.POST("/exec/stream", stream.Exec) // SSE 实时输出
 		rules := handlers.NewRulesHandler()
 		api.GET("/rules/current", rules.GetCurrentRules)
 		api.GET("/rules/currentview", rules.GetCurrentRulesView)
@@ -43,15 +58,31 @@ func Register(r *gin.Engine) {
 		api.POST("/rules/append", ops.Append)                     // -A
 		api.POST("/rules/insert", ops.Insert)                     // -I
 		api.POST("/rules/delete", ops.Delete)
+		api.POST("/hosts/:id/rules/diff", ops.Diff) // 线上规则集 vs 待导入内容
+		confirms := handlers.NewConfirmHandler()
+		api.GET("/hosts/:id/confirms", confirms.List)                   // 待确认的变更（写接口带 ?confirm=）
+		api.POST("/hosts/:id/confirms/:confirmId", confirms.Confirm)    // 确认，取消自动回滚
+		api.DELETE("/hosts/:id/confirms/:confirmId", confirms.Rollback) // 立即回滚
+		snapshots := handlers.NewSnapshotHandler()
+		api.GET("/hosts/:id/snapshots", snapshots.List)                         // 修改前自动保存的规则集快照
+		api.GET("/hosts/:id/snapshots/:snapshotId", snapshots.Get)              // 含完整内容
+		api.GET("/hosts/:id/snapshots/:snapshotId/diff", snapshots.Diff)        // 线上 vs 快照，或 ?against= 另一快照
+		api.POST("/hosts/:id/snapshots/:snapshotId/restore", snapshots.Restore) // 以导入方式恢复（If-Match）
 		ipt := handlers.NewIptablesHandler()
 		api.GET("/hosts/:id/iptables/:family/:table/chains", ipt.ListChains)
 		api.POST("/hosts/:id/iptables/:family/:table/chains", ipt.CreateChain)
+		api.GET("/hosts/:id/iptables/:family/:table/chains/graph", ipt.ChainGraph) // 链跳转关系图
 		api.DELETE("/hosts/:id/iptables/:family/:table/chains/:chain", ipt.DeleteChain)
+		api.PUT("/hosts/:id/iptables/:family/:table/chains/:chain/policy", ipt.SetPolicy)
+		api.POST("/hosts/:id/iptables/:family/:table/chains/:chain/rename", ipt.RenameChain)
 
 		api.GET("/hosts/:id/iptables/:family/:table/chains/:chain/rules", ipt.ListRules)
 		api.POST("/hosts/:id/iptables/:family/:table/chains/:chain/rules", ipt.CreateRule)
 		api.PUT("/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId", ipt.UpdateRule)
 		api.DELETE("/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId", ipt.DeleteRule)
+		api.POST("/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId/move", ipt.MoveRule)
+		api.POST("/hosts/:id/iptables/:family/:table/chains/:chain/rules/:ruleId/zero", ipt.ZeroRule) // -Z CHAIN NUM
+		api.PUT("/hosts/:id/iptables/:family/:table/chains/:chain/rules/order", ipt.ReorderChain)     // 整链重排
 		api.DELETE("/hosts/:id/iptables/:family/:table/chains/:chain/rules", ipt.ClearChain)
 
 	}
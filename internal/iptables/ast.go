@@ -0,0 +1,193 @@
+// Package iptables：iptables-save / iptables-restore 格式的解析与输出
+//
+// Parse 得到类型化的 AST（表 / 链 / 规则 / match 模块及其选项 / target 及其选项 / 计数器），
+// String 输出回 iptables-save 格式；未修改的行原样输出，保证逐字节往返。
+package iptables
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ruleset：一份完整的 iptables-save 输出
+type Ruleset struct {
+	Tables   []*Table
+	Trailing []string // 最后一个 COMMIT 之后的注释 / 空行
+
+	noEOL bool // 原文最后一行没有换行
+}
+
+// Table：*filter ... COMMIT
+// 输出时先链声明、后规则（与 iptables-save 一致）；原文若把链声明穿插在规则之间，输出顺序会被规整
+type Table struct {
+	Leading  []string // "*table" 之前的注释 / 空行
+	Name     string
+	Chains   []*Chain
+	Rules    []*Rule  // 整张表的规则，按出现顺序（各链的规则按链分组出现）
+	Trailing []string // COMMIT 之前的注释 / 空行
+
+	raw, canon string
+	commit     string
+}
+
+// Chain：:NAME POLICY [packets:bytes]；自定义链 Policy 为 "-"
+type Chain struct {
+	Leading  []string
+	Name     string
+	Policy   string
+	Counters *Counters
+
+	raw, canon string
+}
+
+func (c *Chain) Builtin() bool { return c.Policy != "-" }
+
+// Counters：[packets:bytes]
+type Counters struct {
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func (c Counters) String() string { return fmt.Sprintf("[%d:%d]", c.Packets, c.Bytes) }
+
+func parseCounters(s string) (*Counters, bool) {
+	if len(s) < 5 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, false
+	}
+	p, b, ok := strings.Cut(s[1:len(s)-1], ":")
+	if !ok {
+		return nil, false
+	}
+	pk, err1 := strconv.ParseUint(p, 10, 64)
+	by, err2 := strconv.ParseUint(b, 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+	return &Counters{Packets: pk, Bytes: by}, true
+}
+
+// Rule：[packets:bytes] -A CHAIN <params> <matches> <target>
+type Rule struct {
+	Leading  []string
+	Counters *Counters // iptables-save -c 才有
+	Chain    string
+
+	Params  []*Option // 通用参数：-p -s -d -i -o -f 等
+	Matches []*Match
+	Target  *Target // 可以没有（只计数的规则）
+
+	raw, canon string // 原行 / 解析时的规范化输出
+	rawSpec    string // 原行中 "-A CHAIN " 之后的部分
+}
+
+// Match：-m MODULE [options]；Implicit 表示由 -p tcp 之类隐式加载（输出时不写 -m）
+type Match struct {
+	Module   string
+	Implicit bool
+	Options  []*Option
+}
+
+// Target：-j NAME [options] 或 -g CHAIN
+type Target struct {
+	Goto    bool
+	Name    string
+	Options []*Option
+}
+
+// Option：[!] --name [values...]
+type Option struct {
+	Name    string
+	Negated bool
+	Values  []string
+
+	raw []string // 取值的原文（含引号），与 Values 一一对应；取值未改动时原样输出
+}
+
+// Value：第一个取值
+func (o *Option) Value() string {
+	if o == nil || len(o.Values) == 0 {
+		return ""
+	}
+	return o.Values[0]
+}
+
+// ============ 查找 ============
+
+// Table：按名字取第一张表
+func (rs *Ruleset) Table(name string) *Table {
+	for _, t := range rs.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (t *Table) Chain(name string) *Chain {
+	for _, c := range t.Chains {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// ChainRules：某条链的规则（按生效顺序）
+func (t *Table) ChainRules(chain string) []*Rule {
+	var out []*Rule
+	for _, r := range t.Rules {
+		if r.Chain == chain {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Param：通用参数（-p 与 --protocol 等长短写法都可以传）
+func (r *Rule) Param(names ...string) *Option {
+	return findOption(r.Params, names)
+}
+
+// Match：按模块名取（含隐式 match）
+func (r *Rule) Match(module string) *Match {
+	for _, m := range r.Matches {
+		if m.Module == module {
+			return m
+		}
+	}
+	return nil
+}
+
+// MatchOption：在所有 match 中找选项
+func (r *Rule) MatchOption(names ...string) *Option {
+	for _, m := range r.Matches {
+		if o := findOption(m.Options, names); o != nil {
+			return o
+		}
+	}
+	return nil
+}
+
+// Comment：-m comment --comment 的内容
+func (r *Rule) Comment() string {
+	if m := r.Match("comment"); m != nil {
+		return m.Option("--comment").Value()
+	}
+	return ""
+}
+
+func (m *Match) Option(names ...string) *Option { return findOption(m.Options, names) }
+
+func (t *Target) Option(names ...string) *Option { return findOption(t.Options, names) }
+
+func findOption(opts []*Option, names []string) *Option {
+	for _, o := range opts {
+		for _, n := range names {
+			if o.Name == n {
+				return o
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package iptables
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind：规则变更类型
+type ChangeKind string
+
+const (
+	RuleAdded    ChangeKind = "added"
+	RuleRemoved  ChangeKind = "removed"
+	RuleModified ChangeKind = "modified" // 同一位置的规则内容变了
+	RuleMoved    ChangeKind = "moved"    // 内容不变，在链中的相对顺序变了
+)
+
+// TableDiff：一张表的结构化差异；计数器、注释、引号写法不算变化
+type TableDiff struct {
+	Table         string         `json:"table"`
+	AddedChains   []string       `json:"addedChains,omitempty"`
+	RemovedChains []string       `json:"removedChains,omitempty"`
+	Policies      []PolicyChange `json:"policies,omitempty"`
+	Rules         []RuleChange   `json:"rules,omitempty"`
+}
+
+func (d *TableDiff) Empty() bool {
+	return len(d.AddedChains) == 0 && len(d.RemovedChains) == 0 && len(d.Policies) == 0 && len(d.Rules) == 0
+}
+
+// PolicyChange：内置链默认策略变化
+type PolicyChange struct {
+	Chain string `json:"chain"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// RuleChange：OldNum / NewNum 为规则在链中的位置（1..N），不适用时为 0
+type RuleChange struct {
+	Kind   ChangeKind `json:"kind"`
+	Chain  string     `json:"chain"`
+	OldNum int        `json:"oldNum,omitempty"`
+	NewNum int        `json:"newNum,omitempty"`
+	OldID  string     `json:"oldId,omitempty"`
+	NewID  string     `json:"newId,omitempty"`
+	Old    string     `json:"old,omitempty"` // "-A CHAIN ..."
+	New    string     `json:"new,omitempty"`
+}
+
+// Diff：逐表比较；只比较 next 中出现的表（iptables-restore 只替换输入里出现的表）
+func Diff(cur, next *Ruleset) []TableDiff {
+	out := []TableDiff{}
+	for _, nt := range next.Tables {
+		ct := cur.Table(nt.Name)
+		if ct == nil {
+			ct = &Table{Name: nt.Name}
+		}
+		d := diffTable(ct, nt)
+		if !d.Empty() {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func diffTable(cur, next *Table) TableDiff {
+	d := TableDiff{Table: next.Name}
+	curIDs, nextIDs := cur.RuleIDs(), next.RuleIDs()
+
+	var chains []string // 两边链名的并集，先 cur 后 next 的出现顺序
+	seen := map[string]bool{}
+	for _, t := range []*Table{cur, next} {
+		for _, c := range t.Chains {
+			if !seen[c.Name] {
+				seen[c.Name] = true
+				chains = append(chains, c.Name)
+			}
+		}
+	}
+	for _, name := range chains {
+		cc, nc := cur.Chain(name), next.Chain(name)
+		switch {
+		case cc == nil:
+			d.AddedChains = append(d.AddedChains, name)
+		case nc == nil:
+			d.RemovedChains = append(d.RemovedChains, name)
+		case cc.Policy != nc.Policy:
+			d.Policies = append(d.Policies, PolicyChange{Chain: name, From: cc.Policy, To: nc.Policy})
+		}
+		d.Rules = append(d.Rules, diffChain(name, cur.ChainRules(name), next.ChainRules(name), curIDs, nextIDs)...)
+	}
+	return d
+}
+
+// diffChain：按指纹求 LCS；LCS 之外的规则先按相同指纹配成 moved，
+// 同一段落里剩下的删除 / 新增依次配成 modified，其余为 removed / added
+func diffChain(chain string, olds, news []*Rule, oldIDs, newIDs map[*Rule]string) []RuleChange {
+	a, b := fingerprints(olds), fingerprints(news)
+
+	type gap struct{ removed, added []int }
+	var gaps []gap
+	pi, pj := -1, -1
+	for _, p := range append(lcsPairs(a, b), [2]int{len(a), len(b)}) {
+		g := gap{}
+		for i := pi + 1; i < p[0]; i++ {
+			g.removed = append(g.removed, i)
+		}
+		for j := pj + 1; j < p[1]; j++ {
+			g.added = append(g.added, j)
+		}
+		if len(g.removed)+len(g.added) > 0 {
+			gaps = append(gaps, g)
+		}
+		pi, pj = p[0], p[1]
+	}
+
+	change := func(kind ChangeKind, i, j int) RuleChange {
+		c := RuleChange{Kind: kind, Chain: chain}
+		if i >= 0 {
+			c.OldNum, c.OldID, c.Old = i+1, oldIDs[olds[i]], olds[i].Line()
+		}
+		if j >= 0 {
+			c.NewNum, c.NewID, c.New = j+1, newIDs[news[j]], news[j].Line()
+		}
+		return c
+	}
+
+	var out []RuleChange
+	// moved：整条链范围内按指纹配对
+	pending := map[string][]int{}
+	for _, g := range gaps {
+		for _, j := range g.added {
+			pending[b[j]] = append(pending[b[j]], j)
+		}
+	}
+	usedOld, usedNew := map[int]bool{}, map[int]bool{}
+	for _, g := range gaps {
+		for _, i := range g.removed {
+			if js := pending[a[i]]; len(js) > 0 {
+				pending[a[i]] = js[1:]
+				usedOld[i], usedNew[js[0]] = true, true
+				out = append(out, change(RuleMoved, i, js[0]))
+			}
+		}
+	}
+	for _, g := range gaps {
+		var rs, as []int
+		for _, i := range g.removed {
+			if !usedOld[i] {
+				rs = append(rs, i)
+			}
+		}
+		for _, j := range g.added {
+			if !usedNew[j] {
+				as = append(as, j)
+			}
+		}
+		k := 0
+		for ; k < len(rs) && k < len(as); k++ {
+			out = append(out, change(RuleModified, rs[k], as[k]))
+		}
+		for _, i := range rs[k:] {
+			out = append(out, change(RuleRemoved, i, -1))
+		}
+		for _, j := range as[k:] {
+			out = append(out, change(RuleAdded, -1, j))
+		}
+	}
+	sort.SliceStable(out, func(x, y int) bool { return changePos(out[x]) < changePos(out[y]) })
+	return out
+}
+
+// changePos：排序用，优先按新位置
+func changePos(c RuleChange) int {
+	if c.NewNum > 0 {
+		return c.NewNum
+	}
+	return c.OldNum
+}
+
+func fingerprints(rules []*Rule) []string {
+	out := make([]string, len(rules))
+	for i, r := range rules {
+		out[i] = r.Fingerprint()
+	}
+	return out
+}
+
+// maxLCSCells：去掉公共前后缀后，DP 表超过这个大小就不再求 LCS，中间整段视为替换
+const maxLCSCells = 4 << 20
+
+// lcsPairs：a、b 的最长公共子序列，返回匹配的下标对（升序）
+func lcsPairs(a, b []string) [][2]int {
+	var pairs [][2]int
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pairs = append(pairs, [2]int{pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	n, m := len(ma), len(mb)
+	if n > 0 && m > 0 && n*m <= maxLCSCells {
+		// dp[i*w+j] = LCS(ma[i:], mb[j:])
+		w := m + 1
+		dp := make([]int32, (n+1)*w)
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				switch {
+				case ma[i] == mb[j]:
+					dp[i*w+j] = dp[(i+1)*w+j+1] + 1
+				case dp[(i+1)*w+j] >= dp[i*w+j+1]:
+					dp[i*w+j] = dp[(i+1)*w+j]
+				default:
+					dp[i*w+j] = dp[i*w+j+1]
+				}
+			}
+		}
+		for i, j := 0, 0; i < n && j < m; {
+			switch {
+			case ma[i] == mb[j]:
+				pairs = append(pairs, [2]int{pre + i, pre + j})
+				i++
+				j++
+			case dp[(i+1)*w+j] >= dp[i*w+j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+	for k := suf; k > 0; k-- {
+		pairs = append(pairs, [2]int{len(a) - k, len(b) - k})
+	}
+	return pairs
+}
+
+// NormalizedLines：用于文本 diff 的规范化行（无计数器、无注释）
+func (t *Table) NormalizedLines() []string {
+	out := []string{t.header()}
+	for _, c := range t.Chains {
+		out = append(out, ":"+quoteArg(c.Name)+" "+c.Policy)
+	}
+	for _, r := range t.Rules {
+		out = append(out, r.Line())
+	}
+	return append(out, "COMMIT")
+}
+
+// UnifiedDiff：逐行比较，输出 unified 格式（context 为上下文行数）；无差异时返回 ""
+func UnifiedDiff(a, b []string, nameA, nameB string, context int) string {
+	type op struct {
+		kind byte // ' ' / '-' / '+'
+		line string
+		ai   int // 该行之前 a 已经过的行数
+		bi   int
+	}
+	var ops []op
+	ai, bi := 0, 0
+	for _, p := range append(lcsPairs(a, b), [2]int{len(a), len(b)}) {
+		for ; ai < p[0]; ai++ {
+			ops = append(ops, op{'-', a[ai], ai, bi})
+		}
+		for ; bi < p[1]; bi++ {
+			ops = append(ops, op{'+', b[bi], ai, bi})
+		}
+		if p[0] < len(a) {
+			ops = append(ops, op{' ', a[ai], ai, bi})
+			ai++
+			bi++
+		}
+	}
+
+	var b2 strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// 一个 hunk：从变更前 context 行开始，直到连续超过 2*context 行没有变更（与 diff -U 一致）
+		start := max(k-context, 0)
+		end, last := k, k
+		for end < len(ops) && end-last <= 2*context+1 {
+			if ops[end].kind != ' ' {
+				last = end
+			}
+			end++
+		}
+		end = min(last+context+1, len(ops))
+
+		na, nb := 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				na++
+			}
+			if o.kind != '-' {
+				nb++
+			}
+		}
+		if b2.Len() == 0 {
+			fmt.Fprintf(&b2, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintf(&b2, "@@ -%s +%s @@\n", hunkRange(ops[start].ai, na), hunkRange(ops[start].bi, nb))
+		for _, o := range ops[start:end] {
+			b2.WriteByte(o.kind)
+			b2.WriteString(o.line)
+			b2.WriteByte('\n')
+		}
+		k = end
+	}
+	return b2.String()
+}
+
+// hunkRange：unified 格式的 "起始行,行数"；空范围时起始行为前一行
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
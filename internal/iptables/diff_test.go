@@ -0,0 +1,169 @@
+package iptables
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// changeSummary：kind chain oldNum>newNum，便于在用例里对照
+func changeSummary(cs []RuleChange) []string {
+	var out []string
+	for _, c := range cs {
+		out = append(out, fmt.Sprintf("%s %s %d>%d", c.Kind, c.Chain, c.OldNum, c.NewNum))
+	}
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	const (
+		a = "-A INPUT -s 10.0.0.1/32 -j ACCEPT\n"
+		b = "-A INPUT -s 10.0.0.2/32 -j ACCEPT\n"
+		c = "-A INPUT -s 10.0.0.3/32 -j ACCEPT\n"
+		d = "-A INPUT -s 10.0.0.4/32 -j ACCEPT\n"
+	)
+	cases := []struct {
+		name      string
+		cur, next string // INPUT 策略与之后的内容，拼进 filter 表
+		rules     []string
+		added     []string
+		removed   []string
+		policies  []PolicyChange
+	}{
+		{"identical", "ACCEPT\n" + a + b, "ACCEPT\n" + a + b, nil, nil, nil, nil},
+		{"counters and comments ignored", "ACCEPT\n" + "[5:300] " + a, "ACCEPT\n# note\n" + a, nil, nil, nil, nil},
+		{"append", "ACCEPT\n" + a, "ACCEPT\n" + a + b, []string{"added INPUT 0>2"}, nil, nil, nil},
+		{"insert at top", "ACCEPT\n" + a + b, "ACCEPT\n" + c + a + b, []string{"added INPUT 0>1"}, nil, nil, nil},
+		{"remove middle", "ACCEPT\n" + a + b + c, "ACCEPT\n" + a + c, []string{"removed INPUT 2>0"}, nil, nil, nil},
+		{"modify in place", "ACCEPT\n" + a + b + c, "ACCEPT\n" + a + d + c, []string{"modified INPUT 2>2"}, nil, nil, nil},
+		{"move to top", "ACCEPT\n" + a + b + c, "ACCEPT\n" + c + a + b, []string{"moved INPUT 3>1"}, nil, nil, nil},
+		{"swap", "ACCEPT\n" + a + b, "ACCEPT\n" + b + a, []string{"moved INPUT 1>2"}, nil, nil, nil},
+		{"edits on both sides of an unchanged rule are not paired", "ACCEPT\n" + a + b + c, "ACCEPT\n" + c + a + d, []string{"moved INPUT 1>2", "removed INPUT 2>0", "added INPUT 0>3"}, nil, nil, nil},
+		{"policy change", "ACCEPT\n" + a, "DROP\n" + a, nil, nil, nil, []PolicyChange{{"INPUT", "ACCEPT", "DROP"}}},
+		{"new chain", "ACCEPT\n", "ACCEPT\n:WEB - [0:0]\n-A WEB -j ACCEPT\n", []string{"added WEB 0>1"}, []string{"WEB"}, nil, nil},
+		{"removed chain", "ACCEPT\n:WEB - [0:0]\n-A WEB -j ACCEPT\n", "ACCEPT\n", []string{"removed WEB 1>0"}, nil, []string{"WEB"}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cur := mustParse(t, "*filter\n:INPUT "+tc.cur+"COMMIT\n")
+			next := mustParse(t, "*filter\n:INPUT "+tc.next+"COMMIT\n")
+			ds := Diff(cur, next)
+			empty := tc.rules == nil && tc.added == nil && tc.removed == nil && tc.policies == nil
+			if empty {
+				if len(ds) != 0 {
+					t.Fatalf("Diff = %+v, want none", ds)
+				}
+				return
+			}
+			if len(ds) != 1 || ds[0].Table != "filter" {
+				t.Fatalf("Diff = %+v, want one filter diff", ds)
+			}
+			d := ds[0]
+			if got := changeSummary(d.Rules); !slices.Equal(got, tc.rules) {
+				t.Errorf("rules = %q, want %q", got, tc.rules)
+			}
+			if !slices.Equal(d.AddedChains, tc.added) || !slices.Equal(d.RemovedChains, tc.removed) {
+				t.Errorf("chains +%q -%q, want +%q -%q", d.AddedChains, d.RemovedChains, tc.added, tc.removed)
+			}
+			if !slices.Equal(d.Policies, tc.policies) {
+				t.Errorf("policies = %+v, want %+v", d.Policies, tc.policies)
+			}
+		})
+	}
+}
+
+func TestDiffRuleDetails(t *testing.T) {
+	cur := mustParse(t, "*filter\n:INPUT ACCEPT [0:0]\n-A INPUT -s 10.0.0.1/32 -j ACCEPT\nCOMMIT\n")
+	next := mustParse(t, "*filter\n:INPUT ACCEPT [0:0]\n-A INPUT -s 10.0.0.1/32 -j DROP\nCOMMIT\n")
+	ds := Diff(cur, next)
+	if len(ds) != 1 || len(ds[0].Rules) != 1 {
+		t.Fatalf("Diff = %+v", ds)
+	}
+	c := ds[0].Rules[0]
+	if c.Old != "-A INPUT -s 10.0.0.1/32 -j ACCEPT" || c.New != "-A INPUT -s 10.0.0.1/32 -j DROP" {
+		t.Errorf("old/new = %q / %q", c.Old, c.New)
+	}
+	if c.OldID != cur.Table("filter").RuleIDs()[cur.Table("filter").Rules[0]] ||
+		c.NewID != next.Table("filter").RuleIDs()[next.Table("filter").Rules[0]] {
+		t.Errorf("ids = %q / %q", c.OldID, c.NewID)
+	}
+}
+
+func TestDiffOnlyNextTables(t *testing.T) {
+	cur := mustParse(t, "*nat\n:PREROUTING ACCEPT [0:0]\n-A PREROUTING -j ACCEPT\nCOMMIT\n*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n")
+	next := mustParse(t, "*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n*raw\n:PREROUTING ACCEPT [0:0]\nCOMMIT\n")
+	ds := Diff(cur, next)
+	// nat 不在 next 中，restore 不会动它；raw 是新表，内置链算新增
+	if len(ds) != 1 || ds[0].Table != "raw" || !slices.Equal(ds[0].AddedChains, []string{"PREROUTING"}) {
+		t.Errorf("Diff = %+v", ds)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(s ...string) []string { return s }
+	cases := []struct {
+		name    string
+		a, b    []string
+		context int
+		want    string
+	}{
+		{"equal", lines("x", "y"), lines("x", "y"), 3, ""},
+		{"both empty", nil, nil, 3, ""},
+		{"from empty", nil, lines("x", "y"), 3, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n"},
+		{"to empty", lines("x"), nil, 3, "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n"},
+		{"change middle", lines("1", "2", "3"), lines("1", "X", "3"), 1,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n"},
+		{"context trimmed", lines("1", "2", "3", "4", "5"), lines("1", "2", "3", "4", "X"), 1,
+			"--- a\n+++ b\n@@ -4,2 +4,2 @@\n 4\n-5\n+X\n"},
+		{"insert with zero context", lines("1", "2"), lines("1", "N", "2"), 0,
+			"--- a\n+++ b\n@@ -1,0 +2 @@\n+N\n"},
+		{"separate hunks", lines("1", "2", "3", "4", "5", "6", "7"), lines("X", "2", "3", "4", "5", "6", "Y"), 1,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+X\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+Y\n"},
+		{"gap wider than 2*context splits", lines("1", "2", "3", "4", "5"), lines("X", "2", "3", "4", "Y"), 1,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+X\n 2\n@@ -4,2 +4,2 @@\n 4\n-5\n+Y\n"},
+		{"gap of 2*context merges", lines("1", "2", "3", "4"), lines("X", "2", "3", "Y"), 1,
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+X\n 2\n 3\n-4\n+Y\n"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := UnifiedDiff(c.a, c.b, "a", "b", c.context); got != c.want {
+				t.Errorf("got\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLCSPairs(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int // LCS 长度
+	}{
+		{"", "", 0},
+		{"abc", "", 0},
+		{"abc", "abc", 3},
+		{"abcd", "acbd", 3},
+		{"xabcy", "zabcw", 3},
+		{"abcbdab", "bdcaba", 4},
+	}
+	for _, c := range cases {
+		a, b := splitChars(c.a), splitChars(c.b)
+		pairs := lcsPairs(a, b)
+		if len(pairs) != c.want {
+			t.Errorf("lcs(%q, %q) = %v, want length %d", c.a, c.b, pairs, c.want)
+		}
+		for k, p := range pairs {
+			if a[p[0]] != b[p[1]] || k > 0 && (p[0] <= pairs[k-1][0] || p[1] <= pairs[k-1][1]) {
+				t.Errorf("lcs(%q, %q) = %v: not an increasing common subsequence", c.a, c.b, pairs)
+				break
+			}
+		}
+	}
+}
+
+func splitChars(s string) []string {
+	out := make([]string, 0, len(s))
+	for _, r := range s {
+		out = append(out, string(r))
+	}
+	return out
+}
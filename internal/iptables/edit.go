@@ -0,0 +1,129 @@
+package iptables
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ParseRuleArgs：由 argv（已去引号，如 buildIptablesArgs 的结果）构造一条规则
+// 含控制字符的取值直接报错，否则渲染成 restore 输入时会拆成多行
+func ParseRuleArgs(chain string, args []string) (*Rule, error) {
+	for _, a := range append([]string{chain}, args...) {
+		if err := CheckValue(a); err != nil {
+			return nil, &ParseError{Msg: err.Error()}
+		}
+	}
+	toks := make([]token, len(args))
+	for i, a := range args {
+		toks[i] = token{text: a, raw: quoteArg(a)}
+		// 字符串类选项的取值即使以 "-" 开头也不是选项
+		if i > 0 && stringOptions[args[i-1]] {
+			toks[i].quoted, toks[i].raw = true, SaveString(a)
+		}
+	}
+	r := &Rule{Chain: chain}
+	if err := parseSpec(r, toks); err != nil {
+		return nil, &ParseError{Msg: err.Error()}
+	}
+	return r, nil
+}
+
+func (t *Table) index(r *Rule) int { return slices.Index(t.Rules, r) }
+
+// InsertRule：插入为链中第 pos 条（从 1 开始）；pos <= 0 或超出链长时追加到链尾
+func (t *Table) InsertRule(r *Rule, pos int) {
+	rules := t.ChainRules(r.Chain)
+	idx := len(t.Rules)
+	switch {
+	case pos >= 1 && pos <= len(rules):
+		idx = t.index(rules[pos-1])
+	case len(rules) > 0:
+		idx = t.index(rules[len(rules)-1]) + 1
+	}
+	t.Rules = slices.Insert(t.Rules, idx, r)
+}
+
+// RemoveRule：删除规则；不在表中时返回 false
+func (t *Table) RemoveRule(r *Rule) bool {
+	i := t.index(r)
+	if i < 0 {
+		return false
+	}
+	t.Rules = slices.Delete(t.Rules, i, i+1)
+	return true
+}
+
+// ReplaceRule：原位替换；保留原规则前的注释，计数器随新内容清零
+func (t *Table) ReplaceRule(old, r *Rule) bool {
+	i := t.index(old)
+	if i < 0 {
+		return false
+	}
+	if r.Leading == nil {
+		r.Leading = old.Leading
+	}
+	t.Rules[i] = r
+	return true
+}
+
+// MoveRule：把规则移动为所在链的第 pos 条（从 1 开始），计数器保留
+func (t *Table) MoveRule(r *Rule, pos int) error {
+	if !t.RemoveRule(r) {
+		return fmt.Errorf("rule is not in table %s", t.Name)
+	}
+	t.InsertRule(r, pos)
+	return nil
+}
+
+// RenameChain：重命名自定义链，同时改写该链的规则以及表内所有 -j / -g 引用
+func (t *Table) RenameChain(old, name string) error {
+	c := t.Chain(old)
+	if c == nil {
+		return fmt.Errorf("chain %s not found in table %s", old, t.Name)
+	}
+	if c.Builtin() {
+		return fmt.Errorf("builtin chain %s cannot be renamed", old)
+	}
+	if t.Chain(name) != nil {
+		return fmt.Errorf("chain %s already exists in table %s", name, t.Name)
+	}
+	c.Name = name
+	for _, r := range t.Rules {
+		if r.Chain == old {
+			r.Chain = name
+		}
+		if r.Target != nil && r.Target.Name == old {
+			r.Target.Name = name
+		}
+	}
+	return nil
+}
+
+// Jumps：表内通过 -j / -g 跳到该链的规则
+func (t *Table) Jumps(chain string) []*Rule {
+	var out []*Rule
+	for _, r := range t.Rules {
+		if r.Target != nil && r.Target.Name == chain {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// FlushChain：删除链内全部规则（-F），返回删除条数
+func (t *Table) FlushChain(name string) int {
+	n := len(t.Rules)
+	t.Rules = slices.DeleteFunc(t.Rules, func(r *Rule) bool { return r.Chain == name })
+	return n - len(t.Rules)
+}
+
+// RemoveChain：删除链声明及链内全部规则；引用它的规则需调用方先处理
+func (t *Table) RemoveChain(name string) bool {
+	i := slices.IndexFunc(t.Chains, func(c *Chain) bool { return c.Name == name })
+	if i < 0 {
+		return false
+	}
+	t.Chains = slices.Delete(t.Chains, i, i+1)
+	t.FlushChain(name)
+	return true
+}
@@ -0,0 +1,71 @@
+package iptables
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Fingerprint：规则内容的指纹（链名 + 去引号后的参数），与计数器、引号写法、所在位置无关
+func (r *Rule) Fingerprint() string {
+	h := sha256.New()
+	h.Write([]byte(r.Chain))
+	for _, a := range r.Args() {
+		h.Write([]byte{0})
+		h.Write([]byte(a))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// RuleIDs：表内每条规则的稳定 ID，格式 "<指纹>-<序号>"
+// 序号是同一链中相同内容规则的第几次出现（从 0 开始），内容完全相同的规则互相可替换
+func (t *Table) RuleIDs() map[*Rule]string {
+	ids := make(map[*Rule]string, len(t.Rules))
+	seen := map[string]int{}
+	for _, r := range t.Rules {
+		fp := r.Fingerprint()
+		ids[r] = fmt.Sprintf("%s-%d", fp, seen[fp])
+		seen[fp]++
+	}
+	return ids
+}
+
+// IsRuleID：是否为 RuleIDs 生成的 ID
+func IsRuleID(id string) bool {
+	fp, occ, ok := strings.Cut(id, "-")
+	if !ok || len(fp) != 16 || occ == "" {
+		return false
+	}
+	for _, c := range fp {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	for _, c := range occ {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Revision：规则集的版本号；忽略注释（含 "# Generated by" 时间戳）、计数器和引号写法
+func (rs *Ruleset) Revision() string {
+	h := sha256.New()
+	for _, t := range rs.Tables {
+		fmt.Fprintf(h, "*%s\n", t.Name)
+		for _, c := range t.Chains {
+			fmt.Fprintf(h, ":%s %s\n", c.Name, c.Policy)
+		}
+		for _, r := range t.Rules {
+			h.Write([]byte(r.Chain))
+			for _, a := range r.Args() {
+				h.Write([]byte{0})
+				h.Write([]byte(a))
+			}
+			h.Write([]byte{'\n'})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
@@ -0,0 +1,147 @@
+package iptables
+
+import (
+	"slices"
+	"testing"
+)
+
+func mustRule(t *testing.T, line string) *Rule {
+	t.Helper()
+	r, err := ParseRule(line)
+	if err != nil {
+		t.Fatalf("ParseRule(%q): %v", line, err)
+	}
+	return r
+}
+
+func TestFingerprint(t *testing.T) {
+	base := `-A INPUT -p tcp -m tcp --dport 22 -m comment --comment ssh -j ACCEPT`
+	cases := []struct {
+		name, line string
+		same       bool
+	}{
+		{"identical", base, true},
+		{"with counters", `[42:2520] ` + base, true},
+		{"quoted comment", `-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "ssh" -j ACCEPT`, true},
+		{"extra spacing", `-A INPUT  -p tcp -m tcp --dport 22 -m comment --comment ssh   -j ACCEPT`, true},
+		{"other chain", `-A SSH -p tcp -m tcp --dport 22 -m comment --comment ssh -j ACCEPT`, false},
+		{"other port", `-A INPUT -p tcp -m tcp --dport 2222 -m comment --comment ssh -j ACCEPT`, false},
+		{"negated", `-A INPUT -p tcp -m tcp ! --dport 22 -m comment --comment ssh -j ACCEPT`, false},
+		{"other comment", `-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "ssh " -j ACCEPT`, false},
+		{"goto instead of jump", `-A INPUT -p tcp -m tcp --dport 22 -m comment --comment ssh -g ACCEPT`, false},
+	}
+	want := mustRule(t, base).Fingerprint()
+	if len(want) != 16 {
+		t.Fatalf("fingerprint %q, want 16 hex chars", want)
+	}
+	for _, c := range cases {
+		got := mustRule(t, c.line).Fingerprint()
+		if (got == want) != c.same {
+			t.Errorf("%s: fingerprint %s vs %s, want same=%v", c.name, got, want, c.same)
+		}
+	}
+}
+
+func TestRuleIDs(t *testing.T) {
+	rs := mustParse(t, `*filter
+:INPUT ACCEPT [0:0]
+:SSH - [0:0]
+[1:60] -A INPUT -p tcp -m tcp --dport 22 -j SSH
+[9:540] -A INPUT -j DROP
+[0:0] -A INPUT -p tcp -m tcp --dport 22 -j SSH
+-A INPUT -j DROP
+-A SSH -j DROP
+COMMIT
+`)
+	tb := rs.Table("filter")
+	ids := tb.RuleIDs()
+	rules := slices.Clone(tb.Rules)
+	fp := func(i int) string { return rules[i].Fingerprint() }
+	want := []string{
+		fp(0) + "-0",
+		fp(1) + "-0",
+		fp(0) + "-1", // 同一链中内容相同的规则按出现次序编号，与计数器无关
+		fp(1) + "-1",
+		fp(4) + "-0", // 其他链同样内容的规则指纹不同，序号单独计
+	}
+	for i, r := range rules {
+		if ids[r] != want[i] {
+			t.Errorf("rule %d (%s): id %s, want %s", i+1, r.Line(), ids[r], want[i])
+		}
+		if !IsRuleID(ids[r]) {
+			t.Errorf("IsRuleID(%s) = false", ids[r])
+		}
+	}
+	if fp(1) == fp(4) {
+		t.Error("same spec in different chains should not share a fingerprint")
+	}
+
+	// 删掉第一条 DROP 后，其他规则的 ID 不变，后面那条 DROP 的序号前移
+	tb.RemoveRule(rules[1])
+	after := tb.RuleIDs()
+	for _, i := range []int{0, 2, 4} {
+		if after[rules[i]] != ids[rules[i]] {
+			t.Errorf("rule %d: id changed to %s after removing an unrelated rule", i+1, after[rules[i]])
+		}
+	}
+	if got := after[rules[3]]; got != fp(1)+"-0" {
+		t.Errorf("duplicate DROP: id %s, want occurrence 0 after removal", got)
+	}
+}
+
+func TestIsRuleID(t *testing.T) {
+	cases := []struct {
+		id string
+		ok bool
+	}{
+		{"0123456789abcdef-0", true},
+		{"0123456789abcdef-12", true},
+		{"0123456789ABCDEF-0", false},
+		{"0123456789abcde-0", false},
+		{"0123456789abcdef", false},
+		{"0123456789abcdef-", false},
+		{"0123456789abcdef-x", false},
+		{"3", false},
+		{"INPUT:3", false},
+	}
+	for _, c := range cases {
+		if got := IsRuleID(c.id); got != c.ok {
+			t.Errorf("IsRuleID(%q) = %v, want %v", c.id, got, c.ok)
+		}
+	}
+}
+
+func TestRevision(t *testing.T) {
+	a := mustParse(t, saveV4)
+	// 计数器、时间戳注释、引号写法都不影响版本号
+	b := mustParse(t, `# Generated by iptables-save v1.8.7 on Sat Oct 17 00:00:00 2026
+*nat
+:PREROUTING ACCEPT [0:0]
+:INPUT ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+-A PREROUTING -i eth0 -p tcp -m tcp --dport 2222 -j DNAT --to-destination "10.0.0.2:22"
+-A POSTROUTING -s 10.0.0.0/24 -o eth0 -j MASQUERADE
+COMMIT
+*filter
+:INPUT DROP [0:0]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [0:0]
+:SSH - [0:0]
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -i lo -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "allow \"ops\" ssh" -g SSH
+-A INPUT ! -s 10.0.0.0/8 -p tcp -m multiport --dports 80,443 -j ACCEPT
+-A INPUT -p tcp -m tcp ! --dport 8080 -j LOG --log-prefix "in: "
+-A SSH -s 192.168.1.0/24 -j ACCEPT
+-A SSH -j DROP
+COMMIT
+`)
+	if a.Revision() != b.Revision() {
+		t.Error("revision should ignore counters, comments and quoting")
+	}
+	b.Table("filter").Chain("INPUT").Policy = "ACCEPT"
+	if a.Revision() == b.Revision() {
+		t.Error("revision should change with the policy")
+	}
+}
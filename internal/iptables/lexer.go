@@ -0,0 +1,152 @@
+package iptables
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// token：一个参数；与 iptables-restore 的切分规则一致：
+//   - 空格 / Tab 分隔
+//   - 只有双引号是引号，引号内 \ 转义下一个字符；单引号是普通字符
+//   - 右引号总是结束当前参数（"ab"cd 是两个参数）
+type token struct {
+	text       string // 去掉引号与转义后的值
+	raw        string // 原文
+	quoted     bool
+	start, end int // raw 在行内的位置
+}
+
+var errUnterminated = errors.New("unterminated quoted string")
+
+func tokenize(line string) ([]token, error) {
+	var (
+		out     []token
+		buf     strings.Builder
+		inTok   bool
+		quoted  bool
+		open    bool
+		escaped bool
+		start   int
+	)
+	emit := func(end int) {
+		out = append(out, token{
+			text:   buf.String(),
+			raw:    line[start:end],
+			quoted: quoted,
+			start:  start,
+			end:    end,
+		})
+		buf.Reset()
+		inTok, quoted = false, false
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		if open {
+			switch {
+			case escaped:
+				buf.WriteByte(ch)
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				open = false
+				emit(i + 1)
+			default:
+				buf.WriteByte(ch)
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			if !inTok {
+				start = i
+				inTok = true
+			}
+			open, quoted = true, true
+		case ' ', '\t', '\n', '\r':
+			if inTok {
+				emit(i)
+			}
+		default:
+			if !inTok {
+				start = i
+				inTok = true
+			}
+			buf.WriteByte(ch)
+		}
+	}
+	if open {
+		return nil, errUnterminated
+	}
+	if inTok {
+		emit(len(line))
+	}
+	return out, nil
+}
+
+// isOption：形如 -p / --dport 的选项；带引号的、以及 -1 这类负数都算取值
+func (t token) isOption() bool {
+	if t.quoted || len(t.text) < 2 || t.text[0] != '-' {
+		return false
+	}
+	return t.text[1] < '0' || t.text[1] > '9'
+}
+
+func (t token) is(s string) bool { return !t.quoted && t.text == s }
+
+// ============ 输出时的引号 ============
+
+// 与 xtables_save_string 相同：只含这些字符时不加引号
+const noQuoteChars = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// SaveString：按 iptables-save 的规则输出字符串类取值（--comment / --log-prefix 等）
+func SaveString(v string) string {
+	if v != "" && strings.Trim(v, noQuoteChars) == "" {
+		return v
+	}
+	return quote(v)
+}
+
+// CheckValue：取值里不能有控制字符；restore 输入按行解析，换行无法转义，会被当成新的一行
+func CheckValue(v string) error {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] == 0x7f {
+			return fmt.Errorf("value %q contains control characters", v)
+		}
+	}
+	return nil
+}
+
+// Quote：只在 iptables-restore 切分会出错时加引号（空串、空白、双引号、反斜杠、单引号）
+// 含控制字符的取值无法写进 restore 输入，返回错误
+func Quote(v string) (string, error) {
+	if err := CheckValue(v); err != nil {
+		return "", err
+	}
+	return quoteArg(v), nil
+}
+
+// quoteArg：同 Quote，不做检查；AST 中的取值来自按行解析或 ParseRuleArgs，不会含换行
+func quoteArg(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\r\n\"\\'") {
+		return quote(v)
+	}
+	return v
+}
+
+// quote：与 xtables_save_string 一致，只转义双引号和反斜杠
+func quote(v string) string {
+	var b strings.Builder
+	b.Grow(len(v) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if strings.IndexByte(`"\`, v[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
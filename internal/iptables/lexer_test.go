@@ -0,0 +1,128 @@
+package iptables
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"", `""`},
+		{"ssh", "ssh"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"a.b:c", "a.b:c"},
+		{"allow ssh", `"allow ssh"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`},
+		{"it's", `"it's"`},
+	}
+	for _, c := range cases {
+		got, err := Quote(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("Quote(%q) = %s, %v, want %s", c.in, got, err, c.want)
+		}
+	}
+	// 换行会在 restore 输入里变成新的一行，引号也挡不住
+	for _, v := range []string{"a\nb", "a\r\n-A INPUT -j DROP", "a\x00", "a\tb"} {
+		if got, err := Quote(v); err == nil {
+			t.Errorf("Quote(%q) = %s, want error", v, got)
+		}
+	}
+}
+
+func TestSaveString(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"", `""`},
+		{"ssh", "ssh"},
+		{"allow_ssh-22", "allow_ssh-22"},
+		// 与 xtables_save_string 一致：字母数字和 _- 以外的字符都要加引号
+		{"a.b", `"a.b"`},
+		{"in: ", `"in: "`},
+		{`allow "ops" ssh`, `"allow \"ops\" ssh"`},
+		{`back\slash`, `"back\\slash"`},
+		{"it's ops", `"it's ops"`},
+	}
+	for _, c := range cases {
+		if got := SaveString(c.in); got != c.want {
+			t.Errorf("SaveString(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+// quoteArg / SaveString 的输出经 iptables-restore 切分后必须还原成同一个值
+func TestQuoteTokenizeRoundTrip(t *testing.T) {
+	values := []string{"", "ssh", "a b", `"`, `\`, `'`, `a"b\c'd`, "x\ty", "trailing ", "-1"}
+	for _, v := range values {
+		for name, q := range map[string]func(string) string{"quoteArg": quoteArg, "SaveString": SaveString} {
+			toks, err := tokenize(q(v))
+			if err != nil {
+				t.Errorf("%s(%q): tokenize: %v", name, v, err)
+				continue
+			}
+			if len(toks) != 1 || toks[0].text != v {
+				t.Errorf("%s(%q) = %s, tokenized back to %+v", name, v, q(v), toks)
+			}
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{`-A INPUT -j ACCEPT`, []string{"-A", "INPUT", "-j", "ACCEPT"}},
+		{"a\t b  c", []string{"a", "b", "c"}},
+		{`--comment "a \"b\" c"`, []string{"--comment", `a "b" c`}},
+		{`--comment 'a b'`, []string{"--comment", "'a", "b'"}},
+		{`"ab"cd`, []string{"ab", "cd"}},
+		{`""`, []string{""}},
+	}
+	for _, c := range cases {
+		toks, err := tokenize(c.line)
+		if err != nil {
+			t.Errorf("tokenize(%q): %v", c.line, err)
+			continue
+		}
+		var got []string
+		for _, tk := range toks {
+			got = append(got, tk.text)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", c.line, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("tokenize(%q) = %q, want %q", c.line, got, c.want)
+				break
+			}
+		}
+	}
+	if _, err := tokenize(`--comment "open`); err == nil {
+		t.Error("unterminated quote: want error")
+	}
+}
+
+func TestCheckValue(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"", true},
+		{"allow ssh", true},
+		{`quote " and \ backslash`, true},
+		{"中文注释", true},
+		{"a\nb", false},
+		{"a\rb", false},
+		{"a\x00b", false},
+		{"a\tb", false},
+		{"a\x7fb", false},
+	}
+	for _, c := range cases {
+		if err := CheckValue(c.in); (err == nil) != c.ok {
+			t.Errorf("CheckValue(%q) = %v, want ok=%v", c.in, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package iptables
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError：带行号的解析错误（行号从 1 开始；规则片段解析时为 0）
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line <= 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func errorf(line int, format string, args ...any) *ParseError {
+	return &ParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// 通用参数（不属于任何 match / target）；值为参数个数
+var genericOptions = map[string]int{
+	"-p": 1, "--protocol": 1,
+	"-s": 1, "--source": 1, "--src": 1,
+	"-d": 1, "--destination": 1, "--dst": 1,
+	"-i": 1, "--in-interface": 1,
+	"-o": 1, "--out-interface": 1,
+	"-f": 0, "--fragment": 0,
+	"-c": 2, "--set-counters": 2,
+	"-4": 0, "--ipv4": 0,
+	"-6": 0, "--ipv6": 0,
+}
+
+// Parse：解析 iptables-save 输出（也接受 iptables-restore 输入中的 -A 规则）
+func Parse(text string) (*Ruleset, error) {
+	rs := &Ruleset{}
+	lines := strings.Split(text, "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	} else if text != "" {
+		rs.noEOL = true
+	}
+
+	var (
+		cur     *Table
+		pending []string // 等待挂到下一个元素上的注释 / 空行
+	)
+	for i, line := range lines {
+		no := i + 1
+		trim := strings.TrimSpace(line)
+		switch {
+		case trim == "" || strings.HasPrefix(trim, "#"):
+			pending = append(pending, line)
+
+		case strings.HasPrefix(trim, "*"):
+			if cur != nil {
+				return nil, errorf(no, "table %q started before COMMIT of %q", trim[1:], cur.Name)
+			}
+			name := strings.TrimSpace(trim[1:])
+			if name == "" || strings.ContainsAny(name, " \t") {
+				return nil, errorf(no, "invalid table header %q", trim)
+			}
+			cur = &Table{Leading: pending, Name: name, raw: line}
+			cur.canon = cur.header()
+			pending = nil
+
+		case trim == "COMMIT":
+			if cur == nil {
+				return nil, errorf(no, "COMMIT outside of a table")
+			}
+			cur.Trailing, cur.commit = pending, line
+			rs.Tables = append(rs.Tables, cur)
+			cur, pending = nil, nil
+
+		case cur == nil:
+			return nil, errorf(no, "unexpected line outside of a table: %q", trim)
+
+		case strings.HasPrefix(trim, ":"):
+			c, err := parseChainLine(trim)
+			if err != nil {
+				return nil, errorf(no, "%s", err.Error())
+			}
+			if cur.Chain(c.Name) != nil {
+				return nil, errorf(no, "chain %q declared twice", c.Name)
+			}
+			c.Leading, c.raw = pending, line
+			c.canon = c.String()
+			cur.Chains = append(cur.Chains, c)
+			pending = nil
+
+		default:
+			r, err := parseRuleLine(line)
+			if err != nil {
+				if pe, ok := err.(*ParseError); ok {
+					pe.Line = no
+					return nil, pe
+				}
+				return nil, errorf(no, "%s", err.Error())
+			}
+			r.Leading = pending
+			cur.Rules = append(cur.Rules, r)
+			pending = nil
+		}
+	}
+	if cur != nil {
+		return nil, errorf(len(lines), "table %q: missing COMMIT", cur.Name)
+	}
+	rs.Trailing = pending
+	return rs, nil
+}
+
+func parseChainLine(line string) (*Chain, error) {
+	f := strings.Fields(line[1:])
+	if len(f) < 2 || len(f) > 3 || f[0] == "" {
+		return nil, fmt.Errorf("invalid chain line %q", line)
+	}
+	c := &Chain{Name: f[0], Policy: f[1]}
+	if len(f) == 3 {
+		cnt, ok := parseCounters(f[2])
+		if !ok {
+			return nil, fmt.Errorf("invalid counters %q", f[2])
+		}
+		c.Counters = cnt
+	}
+	return c, nil
+}
+
+// parseRuleLine：[packets:bytes] -A CHAIN spec
+func parseRuleLine(line string) (*Rule, error) {
+	toks, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rule{raw: line}
+	k := 0
+	if k < len(toks) && !toks[k].quoted && strings.HasPrefix(toks[k].text, "[") {
+		cnt, ok := parseCounters(toks[k].text)
+		if !ok {
+			return nil, fmt.Errorf("invalid counters %q", toks[k].text)
+		}
+		r.Counters = cnt
+		k++
+	}
+	if k >= len(toks) || !(toks[k].is("-A") || toks[k].is("--append")) {
+		cmd := ""
+		if k < len(toks) {
+			cmd = toks[k].text
+		}
+		return nil, fmt.Errorf("unsupported command %q (only -A is allowed)", cmd)
+	}
+	k++
+	if k >= len(toks) || toks[k].isOption() || toks[k].text == "" {
+		return nil, fmt.Errorf("-A requires a chain name")
+	}
+	r.Chain = toks[k].text
+	k++
+	if k < len(toks) {
+		r.rawSpec = strings.TrimRight(line[toks[k].start:], " \t\r")
+	}
+	if err := parseSpec(r, toks[k:]); err != nil {
+		return nil, err
+	}
+	r.canon = r.render()
+	return r, nil
+}
+
+// ParseRule：解析单行 "-A CHAIN spec"（可带 [packets:bytes] 前缀）
+func ParseRule(line string) (*Rule, error) {
+	r, err := parseRuleLine(line)
+	if err != nil {
+		if pe, ok := err.(*ParseError); ok {
+			return nil, pe
+		}
+		return nil, &ParseError{Msg: err.Error()}
+	}
+	return r, nil
+}
+
+// ParseRuleSpec：解析不含 "-A CHAIN" 的规则片段（用户输入、iptables -A CHAIN 之后的参数）
+func ParseRuleSpec(spec string) (*Rule, error) {
+	toks, err := tokenize(spec)
+	if err != nil {
+		return nil, &ParseError{Msg: err.Error()}
+	}
+	r := &Rule{rawSpec: strings.TrimSpace(spec)}
+	if err := parseSpec(r, toks); err != nil {
+		return nil, &ParseError{Msg: err.Error()}
+	}
+	r.canon = r.render()
+	return r, nil
+}
+
+// parseSpec：把参数归到通用参数 / 当前 match / target
+// 与 iptables 一致：-m 之后的未知选项属于最近的 match；-j 之后的选项属于 target；
+// 出现在任何 -m 之前的非通用选项归入 -p 隐式加载的协议 match
+func parseSpec(r *Rule, toks []token) error {
+	var (
+		curMatch *Match
+		inTarget bool
+		neg      bool
+	)
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.is("!"):
+			if neg {
+				return fmt.Errorf("multiple \"!\" flags not allowed")
+			}
+			neg = true
+
+		case t.is("-m") || t.is("--match"):
+			if neg {
+				return fmt.Errorf("\"!\" not allowed before %s", t.text)
+			}
+			if i+1 >= len(toks) || toks[i+1].isOption() || toks[i+1].text == "" {
+				return fmt.Errorf("%s requires a module name", t.text)
+			}
+			i++
+			curMatch = &Match{Module: toks[i].text}
+			r.Matches = append(r.Matches, curMatch)
+			inTarget = false
+
+		case t.is("-j") || t.is("--jump") || t.is("-g") || t.is("--goto"):
+			if neg {
+				return fmt.Errorf("\"!\" not allowed before %s", t.text)
+			}
+			if r.Target != nil {
+				return fmt.Errorf("multiple targets (%s %s)", t.text, r.Target.Name)
+			}
+			if i+1 >= len(toks) || toks[i+1].isOption() || toks[i+1].text == "" {
+				return fmt.Errorf("%s requires a target", t.text)
+			}
+			i++
+			r.Target = &Target{Goto: t.text == "-g" || t.text == "--goto", Name: toks[i].text}
+			inTarget, curMatch = true, nil
+
+		case t.isOption():
+			o := &Option{Name: t.text, Negated: neg}
+			neg = false
+			// 旧写法：--dport ! 22
+			if i+2 < len(toks) && toks[i+1].is("!") && !toks[i+2].isOption() {
+				if o.Negated {
+					return fmt.Errorf("multiple \"!\" flags not allowed")
+				}
+				o.Negated = true
+				i++
+			}
+			n, generic := genericOptions[t.text]
+			for i+1 < len(toks) && !toks[i+1].isOption() && !toks[i+1].is("!") {
+				if generic && len(o.Values) == n {
+					break
+				}
+				i++
+				o.Values = append(o.Values, toks[i].text)
+				o.raw = append(o.raw, toks[i].raw)
+			}
+			if generic && len(o.Values) != n {
+				return fmt.Errorf("option %s requires %d argument(s)", t.text, n)
+			}
+			switch {
+			case generic:
+				r.Params = append(r.Params, o)
+			case inTarget:
+				r.Target.Options = append(r.Target.Options, o)
+			case curMatch != nil:
+				curMatch.Options = append(curMatch.Options, o)
+			default:
+				m := r.implicitMatch()
+				m.Options = append(m.Options, o)
+			}
+
+		default:
+			return fmt.Errorf("unexpected argument %q", t.text)
+		}
+	}
+	if neg {
+		return fmt.Errorf("\"!\" at end of rule")
+	}
+	return nil
+}
+
+// implicitMatch：-p tcp 之后直接写 --dport 时隐式加载的协议 match
+func (r *Rule) implicitMatch() *Match {
+	proto := strings.ToLower(r.Param("-p", "--protocol").Value())
+	for _, m := range r.Matches {
+		if m.Implicit && m.Module == proto {
+			return m
+		}
+	}
+	m := &Match{Module: proto, Implicit: true}
+	r.Matches = append(r.Matches, m)
+	return m
+}
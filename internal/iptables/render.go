@@ -0,0 +1,223 @@
+package iptables
+
+import "strings"
+
+// 字符串类取值：输出时与 iptables-save 一样按 xtables_save_string 加引号
+var stringOptions = map[string]bool{
+	"--comment":      true,
+	"--log-prefix":   true,
+	"--nflog-prefix": true,
+}
+
+// String：iptables-save 格式
+func (rs *Ruleset) String() string {
+	var b strings.Builder
+	for _, t := range rs.Tables {
+		t.write(&b)
+	}
+	writeLines(&b, rs.Trailing)
+	out := b.String()
+	if rs.noEOL {
+		out = strings.TrimSuffix(out, "\n")
+	}
+	return out
+}
+
+// String：单张表（*name ... COMMIT）
+func (t *Table) String() string {
+	var b strings.Builder
+	t.write(&b)
+	return b.String()
+}
+
+func (t *Table) write(b *strings.Builder) {
+	writeLines(b, t.Leading)
+	b.WriteString(pick(t.raw, t.canon, t.header()))
+	b.WriteByte('\n')
+	for _, c := range t.Chains {
+		writeLines(b, c.Leading)
+		b.WriteString(pick(c.raw, c.canon, c.String()))
+		b.WriteByte('\n')
+	}
+	for _, r := range t.Rules {
+		writeLines(b, r.Leading)
+		b.WriteString(r.String())
+		b.WriteByte('\n')
+	}
+	writeLines(b, t.Trailing)
+	b.WriteString(pick(t.commit, "COMMIT", "COMMIT"))
+	b.WriteByte('\n')
+}
+
+// RuleAtLine：String() 输出中第 n 行（从 1 开始）对应的规则；不是规则行时返回 nil
+// 行号计算与 write 保持一致
+func (t *Table) RuleAtLine(n int) *Rule {
+	line := len(t.Leading) + 1
+	for _, c := range t.Chains {
+		line += len(c.Leading) + 1
+	}
+	for _, r := range t.Rules {
+		line += len(r.Leading) + 1
+		if line == n {
+			return r
+		}
+		if line > n {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (t *Table) header() string { return "*" + t.Name }
+
+// String：:NAME POLICY [packets:bytes]
+func (c *Chain) String() string {
+	s := ":" + c.Name + " " + c.Policy
+	if c.Counters != nil {
+		s += " " + c.Counters.String()
+	}
+	return s
+}
+
+// String：整行（含 -c 计数器前缀）；未修改时返回原文
+func (r *Rule) String() string {
+	return pick(r.raw, r.canon, r.render())
+}
+
+// Line：不含计数器的 "-A CHAIN spec"
+func (r *Rule) Line() string {
+	spec := r.Spec()
+	if spec == "" {
+		return "-A " + quoteArg(r.Chain)
+	}
+	return "-A " + quoteArg(r.Chain) + " " + spec
+}
+
+// Spec：-A CHAIN 之后的部分；未修改时返回原文
+func (r *Rule) Spec() string {
+	spec := strings.Join(r.tokens(), " ")
+	if r.rawSpec != "" && r.canon != "" && r.render() == r.canon {
+		return r.rawSpec
+	}
+	return spec
+}
+
+// Args：规则参数（已去掉引号），可直接作为 argv 传给 iptables -A CHAIN
+func (r *Rule) Args() []string {
+	var out []string
+	for _, o := range r.Params {
+		out = append(out, o.args()...)
+	}
+	for _, m := range r.Matches {
+		if !m.Implicit {
+			out = append(out, "-m", m.Module)
+		}
+		for _, o := range m.Options {
+			out = append(out, o.args()...)
+		}
+	}
+	if r.Target != nil {
+		out = append(out, r.Target.flag(), r.Target.Name)
+		for _, o := range r.Target.Options {
+			out = append(out, o.args()...)
+		}
+	}
+	return out
+}
+
+func (r *Rule) render() string {
+	var b strings.Builder
+	if r.Counters != nil {
+		b.WriteString(r.Counters.String())
+		b.WriteByte(' ')
+	}
+	b.WriteString("-A ")
+	b.WriteString(quoteArg(r.Chain))
+	for _, t := range r.tokens() {
+		b.WriteByte(' ')
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// tokens：规范化输出的各参数（已按需加引号）
+func (r *Rule) tokens() []string {
+	var out []string
+	for _, o := range r.Params {
+		out = append(out, o.tokens()...)
+	}
+	for _, m := range r.Matches {
+		if !m.Implicit {
+			out = append(out, "-m", quoteArg(m.Module))
+		}
+		for _, o := range m.Options {
+			out = append(out, o.tokens()...)
+		}
+	}
+	if r.Target != nil {
+		out = append(out, r.Target.flag(), quoteArg(r.Target.Name))
+		for _, o := range r.Target.Options {
+			out = append(out, o.tokens()...)
+		}
+	}
+	return out
+}
+
+func (t *Target) flag() string {
+	if t.Goto {
+		return "-g"
+	}
+	return "-j"
+}
+
+func (o *Option) tokens() []string {
+	out := make([]string, 0, len(o.Values)+2)
+	if o.Negated {
+		out = append(out, "!")
+	}
+	out = append(out, o.Name)
+	for i, v := range o.Values {
+		switch {
+		case i < len(o.raw) && rawValue(o.raw[i]) == v:
+			out = append(out, o.raw[i])
+		case stringOptions[o.Name]:
+			out = append(out, SaveString(v))
+		default:
+			out = append(out, quoteArg(v))
+		}
+	}
+	return out
+}
+
+func (o *Option) args() []string {
+	out := make([]string, 0, len(o.Values)+2)
+	if o.Negated {
+		out = append(out, "!")
+	}
+	out = append(out, o.Name)
+	return append(out, o.Values...)
+}
+
+// rawValue：原文去引号后的值（原文是单个参数）
+func rawValue(raw string) string {
+	toks, err := tokenize(raw)
+	if err != nil || len(toks) != 1 {
+		return "\x00"
+	}
+	return toks[0].text
+}
+
+// pick：规范化输出与解析时一致（未修改）则用原文
+func pick(raw, canon, cur string) string {
+	if raw != "" && cur == canon {
+		return raw
+	}
+	return cur
+}
+
+func writeLines(b *strings.Builder, lines []string) {
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+}
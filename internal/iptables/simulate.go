@@ -0,0 +1,390 @@
+package iptables
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Verdict：模拟结果；规则里有无法判断的 match（recent / set / limit 等）且影响结果时为 VerdictUnknown
+type Verdict string
+
+const (
+	VerdictAccept  Verdict = "ACCEPT"
+	VerdictDrop    Verdict = "DROP"
+	VerdictUnknown Verdict = "UNKNOWN"
+)
+
+// Packet：待模拟的 TCP 包；零值字段表示未知（如 Src 为 nil、InIface 为空）
+type Packet struct {
+	Src, Dst net.IP
+	SPort    int // 0 表示未知
+	DPort    int
+	InIface  string
+	State    string // NEW / ESTABLISHED
+}
+
+// tri：单条规则是否命中
+type tri int
+
+const (
+	triNo tri = iota
+	triYes
+	triMaybe
+)
+
+func (t tri) negate(neg bool) tri {
+	if !neg || t == triMaybe {
+		return t
+	}
+	if t == triYes {
+		return triNo
+	}
+	return triYes
+}
+
+// simBudget：遍历步数上限；不确定的跳转会分叉，超过上限直接给出 VerdictUnknown
+const simBudget = 20000
+
+// Simulate：从内置链 chain 开始模拟 p 的走向
+// 只模拟本表；-j 到自定义链、-g、RETURN 按内核语义处理，LOG 等非终结 target 直接跳过
+func (t *Table) Simulate(chain string, p Packet) Verdict {
+	s := &simulator{t: t, p: p, base: chain, budget: simBudget}
+	return s.run(chain, 0, nil)
+}
+
+type simulator struct {
+	t      *Table
+	p      Packet
+	base   string
+	budget int
+}
+
+// frame：-j 到自定义链时压栈的返回位置
+type frame struct {
+	chain string
+	next  int
+}
+
+func (s *simulator) run(chain string, i int, stack []frame) Verdict {
+	s.budget--
+	if s.budget < 0 {
+		return VerdictUnknown
+	}
+	rules := s.t.ChainRules(chain)
+	for ; i < len(rules); i++ {
+		r := rules[i]
+		m := s.match(r)
+		if m == triNo {
+			continue
+		}
+		v, terminal := s.target(r, chain, i, stack)
+		if !terminal {
+			continue
+		}
+		if m == triYes {
+			return v
+		}
+		// 可能命中：命中与不命中两条路径结果一致才确定
+		return combine(v, s.run(chain, i+1, stack))
+	}
+	return s.ret(stack)
+}
+
+// ret：链走完或 RETURN；栈空时回到起始内置链的默认策略
+func (s *simulator) ret(stack []frame) Verdict {
+	if len(stack) == 0 {
+		c := s.t.Chain(s.base)
+		if c == nil || !c.Builtin() {
+			return VerdictUnknown
+		}
+		return policyVerdict(c.Policy)
+	}
+	top := stack[len(stack)-1]
+	return s.run(top.chain, top.next, stack[:len(stack)-1])
+}
+
+// target：规则命中后的结果；terminal 为 false 表示继续下一条
+func (s *simulator) target(r *Rule, chain string, i int, stack []frame) (Verdict, bool) {
+	if r.Target == nil {
+		return "", false
+	}
+	name := r.Target.Name
+	switch name {
+	case "ACCEPT":
+		return VerdictAccept, true
+	case "DROP", "REJECT", "TARPIT":
+		return VerdictDrop, true
+	case "RETURN":
+		return s.ret(stack), true
+	}
+	if s.t.Chain(name) != nil {
+		if r.Target.Goto {
+			return s.run(name, 0, stack), true
+		}
+		// 没有环时调用深度不会超过链数；超过说明链互相跳转（内核会拒绝加载），不必耗尽步数
+		if len(stack) >= len(s.t.Chains) {
+			return VerdictUnknown, true
+		}
+		next := append(stack[:len(stack):len(stack)], frame{chain: chain, next: i + 1})
+		return s.run(name, 0, next), true
+	}
+	if nonTerminating[name] {
+		return "", false
+	}
+	// NFQUEUE 等交给用户态决定
+	return VerdictUnknown, true
+}
+
+var nonTerminating = map[string]bool{
+	"LOG": true, "NFLOG": true, "ULOG": true, "MARK": true, "CONNMARK": true,
+	"TCPMSS": true, "CLASSIFY": true, "DSCP": true, "TOS": true, "TTL": true, "HL": true,
+	"SET": true, "AUDIT": true, "TRACE": true, "CHECKSUM": true, "CONNSECMARK": true, "SECMARK": true,
+}
+
+func policyVerdict(policy string) Verdict {
+	switch policy {
+	case "ACCEPT":
+		return VerdictAccept
+	case "DROP":
+		return VerdictDrop
+	}
+	return VerdictUnknown
+}
+
+func combine(a, b Verdict) Verdict {
+	if a == b {
+		return a
+	}
+	return VerdictUnknown
+}
+
+// ============ match ============
+
+func (s *simulator) match(r *Rule) tri {
+	res := triYes
+	and := func(t tri) {
+		if t == triNo || res == triNo {
+			res = triNo
+		} else if t == triMaybe {
+			res = triMaybe
+		}
+	}
+	for _, o := range r.Params {
+		and(s.param(o).negate(o.Negated))
+	}
+	for _, m := range r.Matches {
+		for _, o := range m.Options {
+			and(s.option(m.Module, o).negate(o.Negated))
+		}
+		if len(m.Options) == 0 && m.Module != "tcp" && m.Module != "comment" {
+			and(triMaybe)
+		}
+	}
+	return res
+}
+
+func (s *simulator) param(o *Option) tri {
+	switch o.Name {
+	case "-p", "--protocol":
+		switch strings.ToLower(o.Value()) {
+		case "tcp", "6", "all", "0":
+			return triYes
+		}
+		return triNo
+	case "-s", "--source", "--src":
+		return matchAddr(s.p.Src, o.Value())
+	case "-d", "--destination", "--dst":
+		return matchAddr(s.p.Dst, o.Value())
+	case "-i", "--in-interface":
+		return matchIface(s.p.InIface, o.Value())
+	case "-f", "--fragment":
+		return triNo
+	case "-o", "--out-interface":
+		return triNo // INPUT 方向没有出接口
+	}
+	return triMaybe
+}
+
+func (s *simulator) option(module string, o *Option) tri {
+	switch o.Name {
+	case "--comment":
+		return triYes
+	case "--dport", "--destination-port":
+		if module == "tcp" {
+			return matchPorts(s.p.DPort, o.Value())
+		}
+	case "--sport", "--source-port":
+		if module == "tcp" {
+			return matchPorts(s.p.SPort, o.Value())
+		}
+	case "--dports", "--destination-ports":
+		if module == "multiport" {
+			return matchPorts(s.p.DPort, o.Value())
+		}
+	case "--sports", "--source-ports":
+		if module == "multiport" {
+			return matchPorts(s.p.SPort, o.Value())
+		}
+	case "--ports":
+		if module == "multiport" {
+			if matchPorts(s.p.DPort, o.Value()) == triYes {
+				return triYes
+			}
+			return triMaybe
+		}
+	case "--syn":
+		if module == "tcp" {
+			return boolTri(s.p.State == "NEW")
+		}
+	case "--tcp-flags":
+		if module == "tcp" && len(o.Values) == 2 {
+			return matchTCPFlags(s.p.State, o.Values[0], o.Values[1])
+		}
+	case "--ctstate", "--state":
+		if module == "conntrack" || module == "state" {
+			for _, st := range strings.Split(o.Value(), ",") {
+				if strings.EqualFold(st, s.p.State) {
+					return triYes
+				}
+			}
+			return triNo
+		}
+	case "--src-range":
+		if module == "iprange" {
+			return matchRange(s.p.Src, o.Value())
+		}
+	case "--dst-range":
+		if module == "iprange" {
+			return matchRange(s.p.Dst, o.Value())
+		}
+	case "--dst-type":
+		if module == "addrtype" {
+			for _, t := range strings.Split(o.Value(), ",") {
+				if t == "LOCAL" || t == "UNICAST" {
+					return triYes
+				}
+			}
+			return triMaybe
+		}
+	}
+	return triMaybe
+}
+
+func boolTri(b bool) tri {
+	if b {
+		return triYes
+	}
+	return triNo
+}
+
+// matchAddr：a.b.c.d[/mask]，可逗号分隔多个
+func matchAddr(ip net.IP, spec string) tri {
+	if ip == nil {
+		return triMaybe
+	}
+	for _, part := range strings.Split(spec, ",") {
+		if !strings.Contains(part, "/") {
+			if x := net.ParseIP(part); x != nil {
+				if x.Equal(ip) {
+					return triYes
+				}
+				continue
+			}
+			return triMaybe // 主机名等
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return triMaybe
+		}
+		if n.Contains(ip) {
+			return triYes
+		}
+	}
+	return triNo
+}
+
+func matchRange(ip net.IP, spec string) tri {
+	if ip == nil {
+		return triMaybe
+	}
+	lo, hi, ok := strings.Cut(spec, "-")
+	from, to := net.ParseIP(lo), net.ParseIP(hi)
+	if !ok || from == nil || to == nil {
+		return triMaybe
+	}
+	ip16, f, t := ip.To16(), from.To16(), to.To16()
+	return boolTri(string(ip16) >= string(f) && string(ip16) <= string(t))
+}
+
+// matchIface：末尾 "+" 为前缀通配
+func matchIface(iface, spec string) tri {
+	if iface == "" {
+		return triMaybe
+	}
+	if p, ok := strings.CutSuffix(spec, "+"); ok {
+		return boolTri(strings.HasPrefix(iface, p))
+	}
+	return boolTri(iface == spec)
+}
+
+// matchPorts：端口、a:b 范围，可逗号分隔；服务名无法判断
+func matchPorts(port int, spec string) tri {
+	if port == 0 {
+		return triMaybe
+	}
+	for _, part := range strings.Split(spec, ",") {
+		lo, hi, isRange := strings.Cut(part, ":")
+		if !isRange {
+			hi = lo
+		}
+		a, err1 := portBound(lo, 0)
+		b, err2 := portBound(hi, 65535)
+		if err1 != nil || err2 != nil {
+			return triMaybe
+		}
+		if port >= a && port <= b {
+			return triYes
+		}
+	}
+	return triNo
+}
+
+func portBound(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// matchTCPFlags：NEW 按纯 SYN 包、ESTABLISHED 按纯 ACK 包判断
+func matchTCPFlags(state, mask, comp string) tri {
+	var set map[string]bool
+	switch state {
+	case "NEW":
+		set = map[string]bool{"SYN": true}
+	case "ESTABLISHED":
+		set = map[string]bool{"ACK": true}
+	default:
+		return triMaybe
+	}
+	flags := func(s string) []string {
+		switch strings.ToUpper(s) {
+		case "ALL":
+			return []string{"SYN", "ACK", "FIN", "RST", "URG", "PSH"}
+		case "NONE":
+			return nil
+		}
+		return strings.Split(strings.ToUpper(s), ",")
+	}
+	want := map[string]bool{}
+	for _, f := range flags(comp) {
+		want[f] = true
+	}
+	for _, f := range flags(mask) {
+		if set[f] != want[f] {
+			return triNo
+		}
+	}
+	return triYes
+}
@@ -0,0 +1,90 @@
+package iptables
+
+import (
+	"net"
+	"testing"
+)
+
+// filterTable：policy 为 INPUT 默认策略，body 为 :CHAIN 声明与 -A 规则
+func filterTable(t *testing.T, policy, body string) *Table {
+	t.Helper()
+	rs := mustParse(t, "*filter\n:INPUT "+policy+" [0:0]\n"+body+"COMMIT\n")
+	return rs.Table("filter")
+}
+
+func TestSimulate(t *testing.T) {
+	ssh := Packet{Src: net.ParseIP("203.0.113.7"), Dst: net.ParseIP("10.0.0.1"), SPort: 50000, DPort: 22, InIface: "eth0", State: "NEW"}
+	est := ssh
+	est.State = "ESTABLISHED"
+	web := ssh
+	web.DPort = 443
+	lan := ssh
+	lan.Src = net.ParseIP("10.1.2.3")
+	anySrc := ssh
+	anySrc.Src = nil
+
+	const stateful = "-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT\n"
+
+	cases := []struct {
+		name   string
+		policy string
+		body   string
+		p      Packet
+		want   Verdict
+	}{
+		{"empty chain uses policy", "ACCEPT", "", ssh, VerdictAccept},
+		{"policy DROP", "DROP", "", ssh, VerdictDrop},
+		{"established accepted before DROP policy", "DROP", stateful, est, VerdictAccept},
+		{"new connection falls through to DROP policy", "DROP", stateful, ssh, VerdictDrop},
+		{"dport accept", "DROP", stateful + "-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT\n", ssh, VerdictAccept},
+		{"dport range", "DROP", "-A INPUT -p tcp -m tcp --dport 20:25 -j ACCEPT\n", ssh, VerdictAccept},
+		{"dport miss", "DROP", "-A INPUT -p tcp -m tcp --dport 2222 -j ACCEPT\n", ssh, VerdictDrop},
+		{"multiport", "DROP", "-A INPUT -p tcp -m multiport --dports 80,443 -j ACCEPT\n", web, VerdictAccept},
+		{"udp rule does not match tcp", "ACCEPT", "-A INPUT -p udp -m udp --dport 22 -j DROP\n", ssh, VerdictAccept},
+		{"negated dport", "ACCEPT", "-A INPUT -p tcp -m tcp ! --dport 22 -j DROP\n", ssh, VerdictAccept},
+		{"negated source drops outsiders", "ACCEPT", "-A INPUT ! -s 10.0.0.0/8 -j DROP\n", ssh, VerdictDrop},
+		{"negated source keeps lan", "ACCEPT", "-A INPUT ! -s 10.0.0.0/8 -j DROP\n", lan, VerdictAccept},
+		{"syn flag on new", "ACCEPT", "-A INPUT -p tcp -m tcp --syn -j DROP\n", ssh, VerdictDrop},
+		{"syn flag on established", "ACCEPT", "-A INPUT -p tcp -m tcp --syn -j DROP\n", est, VerdictAccept},
+		{"interface wildcard", "ACCEPT", "-A INPUT -i eth+ -j DROP\n", ssh, VerdictDrop},
+		{"LOG is not terminal", "ACCEPT", "-A INPUT -j LOG --log-prefix x\n-A INPUT -j REJECT\n", ssh, VerdictDrop},
+		{"comment match always matches", "DROP", "-A INPUT -m comment --comment ssh -j ACCEPT\n", ssh, VerdictAccept},
+
+		// -j 到自定义链：链走完回到调用处的下一条
+		{"jump returns to caller", "ACCEPT", ":X - [0:0]\n-A INPUT -j X\n-A INPUT -j DROP\n", ssh, VerdictDrop},
+		// -g：链走完不回调用链，直接用起始链的默认策略
+		{"goto skips the rest of the caller", "ACCEPT", ":X - [0:0]\n-A INPUT -g X\n-A INPUT -j DROP\n", ssh, VerdictAccept},
+		{"RETURN resumes the caller", "DROP",
+			":X - [0:0]\n-A INPUT -j X\n-A INPUT -j ACCEPT\n-A X -p tcp -m tcp --dport 22 -j RETURN\n-A X -j DROP\n", ssh, VerdictAccept},
+		{"RETURN not taken", "DROP",
+			":X - [0:0]\n-A INPUT -j X\n-A INPUT -j ACCEPT\n-A X -p tcp -m tcp --dport 22 -j RETURN\n-A X -j DROP\n", web, VerdictDrop},
+		{"RETURN in base chain uses policy", "DROP", "-A INPUT -j RETURN\n-A INPUT -j ACCEPT\n", ssh, VerdictDrop},
+
+		// 无法判断的 match：两条路径结果一致才确定
+		{"unknown match changes the result", "ACCEPT", "-A INPUT -m recent --rcheck --name bad -j DROP\n", ssh, VerdictUnknown},
+		{"unknown match with the same result either way", "DROP", "-A INPUT -m recent --rcheck --name bad -j DROP\n", ssh, VerdictDrop},
+		{"unknown source address", "ACCEPT", "-A INPUT -s 198.51.100.0/24 -j DROP\n", anySrc, VerdictUnknown},
+		{"unknown target", "ACCEPT", "-A INPUT -j NFQUEUE --queue-num 1\n", ssh, VerdictUnknown},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tb := filterTable(t, c.policy, c.body)
+			if got := tb.Simulate("INPUT", c.p); got != c.want {
+				t.Errorf("Simulate = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+// 互相跳转的自定义链不会让模拟死循环
+func TestSimulateLoop(t *testing.T) {
+	for name, body := range map[string]string{
+		"jump": ":A - [0:0]\n:B - [0:0]\n-A INPUT -j A\n-A A -j B\n-A B -j A\n",
+		"goto": ":A - [0:0]\n:B - [0:0]\n-A INPUT -g A\n-A A -g B\n-A B -g A\n",
+	} {
+		tb := filterTable(t, "ACCEPT", body)
+		if got := tb.Simulate("INPUT", Packet{DPort: 22, State: "NEW"}); got != VerdictUnknown {
+			t.Errorf("%s loop: Simulate = %s, want %s", name, got, VerdictUnknown)
+		}
+	}
+}
@@ -28,13 +28,31 @@ type Host struct {
 	RootUser string `json:"root_user"  gorm:"type:varchar(64)"`
 	RootPass string `json:"-"          gorm:"type:text"` // AES-GCM 密文
 
+	// 认证方式：password(默认，密码登录) | key(私钥，可附带 OpenSSH 用户证书) | agent(ssh-agent)
+	// key/agent 方式下 Password/RootPass 仍用于 sudo -S / su 提权（可选）
+	AuthType      string `json:"auth_type"   gorm:"type:varchar(16);default:password"`
+	PrivateKey    string `json:"-"           gorm:"type:text"` // AES-GCM 密文（PEM/OpenSSH 私钥）
+	KeyPassphrase string `json:"-"           gorm:"type:text"` // AES-GCM 密文
+	Certificate   string `json:"certificate" gorm:"type:text"` // OpenSSH 用户证书（*-cert.pub），公开信息明文存储
+
+	// ssh-agent：为空时使用全局 SSH_AGENT_SOCK / SSH_AUTH_SOCK
+	AgentSocket  string `json:"agent_socket"  gorm:"type:varchar(255)"`
+	AgentForward bool   `json:"agent_forward"` // 把 agent 转发给远端会话
+
+	// 跳板机：经由另一台已管理主机（自带凭据）连接，可多级串联（ProxyJump 语义）
+	ViaHostID *uint `json:"via_host_id" gorm:"index"`
+
 	// 兼容旧字段（已废弃）
 	UseSudo bool `json:"use_sudo" gorm:"-"`
 }
 
-// 统一规整：小写 login_method、默认端口
+// 统一规整：小写 login_method/auth_type、默认端口
 func (h *Host) Normalize() {
 	h.LoginMethod = strings.ToLower(strings.TrimSpace(h.LoginMethod))
+	h.AuthType = strings.ToLower(strings.TrimSpace(h.AuthType))
+	if h.AuthType == "" {
+		h.AuthType = "password"
+	}
 	if h.Port == 0 {
 		h.Port = 22
 	}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// HostKey：主机 SSH 公钥指纹（每台 Host 一条）
+// 首次连接时 TOFU 写入；之后服务端出示的 key 不一致则拒绝连接，并记入 Pending* 等待人工审批
+type HostKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	HostID uint `json:"host_id" gorm:"uniqueIndex"`
+
+	// 已固定的公钥（authorized_keys 格式）
+	KeyType     string `json:"key_type"    gorm:"type:varchar(64)"`
+	PublicKey   string `json:"public_key"  gorm:"type:text"`
+	Fingerprint string `json:"fingerprint" gorm:"type:varchar(128)"`
+	// 来源：tofu | known_hosts | approved
+	Source string `json:"source" gorm:"type:varchar(16)"`
+
+	// 最近一次不匹配时服务端出示的公钥（待审批）
+	PendingKeyType     string     `json:"pending_key_type,omitempty"    gorm:"type:varchar(64)"`
+	PendingPublicKey   string     `json:"pending_public_key,omitempty"  gorm:"type:text"`
+	PendingFingerprint string     `json:"pending_fingerprint,omitempty" gorm:"type:varchar(128)"`
+	PendingAt          *time.Time `json:"pending_at,omitempty"`
+}
+
+// HasPending：是否存在待审批的新 key
+func (k *HostKey) HasPending() bool {
+	return k.PendingPublicKey != ""
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RulesetSnapshot：某次修改之前主机某协议族的完整规则集（iptables-save -c 输出）
+// Hash 为 Content 的 SHA-256，用于完整性校验；Revision 为当时的规则集版本号（ETag，忽略计数器和注释）
+type RulesetSnapshot struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index:idx_snapshot_host_created,priority:3" json:"created_at"`
+
+	HostID uint `gorm:"index:idx_snapshot_host_created,priority:1" json:"host_id"`
+	V6     bool `gorm:"index:idx_snapshot_host_created,priority:2" json:"v6"`
+
+	Author   string `gorm:"type:varchar(128)" json:"author"` // X-Operator 请求头，未设置时为客户端 IP
+	Reason   string `gorm:"type:varchar(255)" json:"reason"` // 触发快照的操作
+	Hash     string `gorm:"type:varchar(64);index" json:"hash"`
+	Revision string `gorm:"type:varchar(32);index" json:"revision"`
+	Size     int    `json:"size"`
+
+	Content string `gorm:"type:text" json:"content,omitempty"` // 列表接口不返回
+}
+
+func (RulesetSnapshot) TableName() string { return "ruleset_snapshots" }
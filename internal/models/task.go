@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// TaskRecord：异步作业中单台主机的一次执行（ssh.Task 的持久化形式）
+// Host 只保存 ID/名称/IP 快照，不落凭据
+type TaskRecord struct {
+	ID    string `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	JobID string `gorm:"type:varchar(64);index"      json:"job_id"`
+	Op    string `gorm:"type:varchar(32)"            json:"op"`
+
+	HostID   uint   `gorm:"index:idx_task_host_created,priority:1" json:"host_id"`
+	HostName string `gorm:"type:varchar(64)"                       json:"host_name"`
+	HostIP   string `gorm:"type:varchar(128)"                      json:"host_ip"`
+
+	Status    string     `gorm:"type:varchar(16);index"                           json:"status"`
+	CreatedAt time.Time  `gorm:"index;index:idx_task_host_created,priority:2" json:"created_at"`
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `gorm:"index" json:"ended_at"`
+
+	Retry     int   `json:"retry"`
+	MaxRetry  int   `json:"max_retry"`
+	BackoffMS int64 `json:"backoff_ms"`
+
+	Command string `gorm:"type:text" json:"-"` // ssh.Command 的 JSON
+
+	Code     int    `json:"code"`
+	Stdout   string `gorm:"type:text" json:"stdout"`
+	Stderr   string `gorm:"type:text" json:"stderr"`
+	Error    string `gorm:"type:text" json:"error"`
+	SpentMS  int64  `json:"spent_ms"`
+	Strategy string `gorm:"type:varchar(32)" json:"strategy"`
+}
+
+func (TaskRecord) TableName() string { return "tasks" }
@@ -12,10 +12,10 @@ type HostRepo struct{ db *gorm.DB }
 func NewHostRepo() *HostRepo { return &HostRepo{db: db.DB()} }
 
 func (r *HostRepo) Create(h *models.Host) error { return r.db.Create(h).Error }
-func (r *HostRepo) Update(h *models.Host) error {
-	return r.db.Model(&models.Host{}).Where("id = ?", h.ID).Updates(h).Error
-}
-func (r *HostRepo) Delete(id uint) error { return r.db.Delete(&models.Host{}, id).Error }
+
+// Update：整行保存（Updates(struct) 会跳过零值，清空证书等字段时不生效）
+func (r *HostRepo) Update(h *models.Host) error { return r.db.Save(h).Error }
+func (r *HostRepo) Delete(id uint) error        { return r.db.Delete(&models.Host{}, id).Error }
 func (r *HostRepo) BatchDelete(ids []uint) (int64, error) {
 	tx := r.db.Delete(&models.Host{}, ids)
 	return tx.RowsAffected, tx.Error
@@ -45,3 +45,9 @@ func (r *HostRepo) FindByIPPort(ip string, port int) (*models.Host, error) {
 	}
 	return &h, nil
 }
+
+// ListByVia：以 id 为跳板机的主机
+func (r *HostRepo) ListByVia(ids ...uint) ([]models.Host, error) {
+	var hs []models.Host
+	return hs, r.db.Where("via_host_id IN ?", ids).Order("id asc").Find(&hs).Error
+}
@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"iptables-web/backend/internal/db"
+	"iptables-web/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type HostKeyRepo struct{ db *gorm.DB }
+
+func NewHostKeyRepo() *HostKeyRepo { return &HostKeyRepo{db: db.DB()} }
+
+func (r *HostKeyRepo) GetByHost(hostID uint) (*models.HostKey, error) {
+	var k models.HostKey
+	if err := r.db.Where("host_id = ?", hostID).First(&k).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Save：按主键插入或整行更新
+func (r *HostKeyRepo) Save(k *models.HostKey) error { return r.db.Save(k).Error }
+
+func (r *HostKeyRepo) DeleteByHost(hostIDs ...uint) error {
+	if len(hostIDs) == 0 {
+		return nil
+	}
+	return r.db.Where("host_id IN ?", hostIDs).Delete(&models.HostKey{}).Error
+}
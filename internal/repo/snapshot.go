@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"time"
+
+	"iptables-web/backend/internal/db"
+	"iptables-web/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type SnapshotRepo struct{ db *gorm.DB }
+
+func NewSnapshotRepo() *SnapshotRepo { return &SnapshotRepo{db: db.DB()} }
+
+func (r *SnapshotRepo) Create(s *models.RulesetSnapshot) error { return r.db.Create(s).Error }
+
+func (r *SnapshotRepo) Get(id uint) (*models.RulesetSnapshot, error) {
+	var s models.RulesetSnapshot
+	if err := r.db.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// List：按时间倒序，不带 Content；v6 为 nil 时两个协议族都返回
+func (r *SnapshotRepo) List(hostID uint, v6 *bool, limit, offset int) ([]models.RulesetSnapshot, int64, error) {
+	q := r.db.Model(&models.RulesetSnapshot{}).Where("host_id = ?", hostID)
+	if v6 != nil {
+		q = q.Where("v6 = ?", *v6)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []models.RulesetSnapshot
+	err := q.Omit("content").Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&out).Error
+	return out, total, err
+}
+
+// PruneKeep：主机该协议族只保留最新的 keep 条，返回删除条数
+func (r *SnapshotRepo) PruneKeep(hostID uint, v6 bool, keep int) (int64, error) {
+	latest := r.db.Model(&models.RulesetSnapshot{}).Select("id").
+		Where("host_id = ? AND v6 = ?", hostID, v6).
+		Order("created_at desc, id desc").Limit(keep)
+	tx := r.db.Where("host_id = ? AND v6 = ? AND id NOT IN (?)", hostID, v6, latest).
+		Delete(&models.RulesetSnapshot{})
+	return tx.RowsAffected, tx.Error
+}
+
+// PruneBefore：删除早于 before 的快照，返回删除条数
+func (r *SnapshotRepo) PruneBefore(before time.Time) (int64, error) {
+	tx := r.db.Where("created_at < ?", before).Delete(&models.RulesetSnapshot{})
+	return tx.RowsAffected, tx.Error
+}
+
+func (r *SnapshotRepo) DeleteByHost(hostIDs ...uint) error {
+	if len(hostIDs) == 0 {
+		return nil
+	}
+	return r.db.Where("host_id IN ?", hostIDs).Delete(&models.RulesetSnapshot{}).Error
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+var (
+	ErrChainNotFound = errors.New("chain not found")
+	ErrChainExists   = errors.New("chain already exists")
+	// ErrChainInUse：链仍被引用或非空，需要 cascade 才能删除
+	ErrChainInUse = errors.New("chain is in use")
+)
+
+// PolicyInput：内置链默认策略
+type PolicyInput struct {
+	Policy string `json:"policy"` // ACCEPT / DROP
+	Force  bool   `json:"force"`  // 确认接受锁死风险，等同 WriteOptions.AllowLockout
+}
+
+// SetPolicy：修改内置链的默认策略（-P），通过整表 restore 生效
+// 改为 DROP 可能把自己锁在外面，由 editTable 的防锁死检查把关，force 时跳过
+func (s *IptablesService) SetPolicy(hostID uint, family IPFamily, table TableType, chainName string, in PolicyInput, opt WriteOptions) (WriteResult, error) {
+	policy := strings.ToUpper(strings.TrimSpace(in.Policy))
+	if policy != "ACCEPT" && policy != "DROP" {
+		return WriteResult{}, invalidf("policy must be ACCEPT or DROP")
+	}
+	if in.Force {
+		opt.AllowLockout = true
+	}
+	return s.edit(hostID, family, table, chainName, opt, func(t *iptables.Table) error {
+		c := t.Chain(chainName)
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, chainName)
+		}
+		if !c.Builtin() {
+			return invalidf("policy can only be set on builtin chains, %s is a user chain", chainName)
+		}
+		if c.Policy == policy {
+			return nil
+		}
+		c.Policy = policy
+		return nil
+	})
+}
+
+// RenameChain：重命名自定义链（-E），链内规则与表内所有 -j / -g 引用一起改写
+func (s *IptablesService) RenameChain(hostID uint, family IPFamily, table TableType, chainName, newName string, opt WriteOptions) (WriteResult, error) {
+	if err := validateChainName(newName); err != nil {
+		return WriteResult{}, err
+	}
+	return s.edit(hostID, family, table, chainName, opt, func(t *iptables.Table) error {
+		c := t.Chain(chainName)
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, chainName)
+		}
+		if c.Builtin() {
+			return invalidf("builtin chain %s cannot be renamed", chainName)
+		}
+		if t.Chain(newName) != nil {
+			return fmt.Errorf("%w: %s", ErrChainExists, newName)
+		}
+		return t.RenameChain(chainName, newName)
+	})
+}
+
+// DeleteChain：删除自定义链
+// 默认要求链为空且没有被引用（与 -X 一致，但给出明确的引用列表）；
+// cascade 时在同一次整表 restore 里删除所有引用它的规则、清空并删除该链
+func (s *IptablesService) DeleteChain(hostID uint, family IPFamily, table TableType, chainName string, cascade bool, opt WriteOptions) (WriteResult, error) {
+	return s.edit(hostID, family, table, chainName, opt, func(t *iptables.Table) error {
+		c := t.Chain(chainName)
+		if c == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, chainName)
+		}
+		if c.Builtin() {
+			return invalidf("builtin chain %s cannot be deleted", chainName)
+		}
+		var refs []*iptables.Rule
+		for _, r := range t.Jumps(chainName) {
+			if r.Chain != chainName { // 链内自引用随链一起删掉
+				refs = append(refs, r)
+			}
+		}
+		if !cascade {
+			if len(refs) > 0 {
+				return fmt.Errorf("%w: referenced by %s (use cascade to remove them)", ErrChainInUse, describeRules(t, refs))
+			}
+			if n := len(t.ChainRules(chainName)); n > 0 {
+				return fmt.Errorf("%w: chain %s still has %d rule(s) (use cascade to flush it)", ErrChainInUse, chainName, n)
+			}
+		}
+		for _, r := range refs {
+			t.RemoveRule(r)
+		}
+		t.RemoveChain(chainName)
+		return nil
+	})
+}
+
+// describeRules：CHAIN#NUM 列表，用于错误信息
+func describeRules(t *iptables.Table, rules []*iptables.Rule) string {
+	out := make([]string, 0, len(rules))
+	for _, r := range rules {
+		num := 0
+		for i, x := range t.ChainRules(r.Chain) {
+			if x == r {
+				num = i + 1
+				break
+			}
+		}
+		out = append(out, fmt.Sprintf("%s#%d", r.Chain, num))
+	}
+	return strings.Join(out, ", ")
+}
+
+// ChainGraph：表内链之间的跳转关系
+type ChainGraph struct {
+	Nodes    []ChainNode `json:"nodes"`
+	Edges    []ChainEdge `json:"edges"`
+	Revision string      `json:"revision"`
+}
+
+type ChainNode struct {
+	Name       string `json:"name"`
+	Builtin    bool   `json:"builtin"`
+	Policy     string `json:"policy,omitempty"`
+	Rules      int    `json:"rules"`
+	References int    `json:"references"`
+	Reachable  bool   `json:"reachable"` // 能否从某条内置链跳到
+}
+
+// ChainEdge：From 链中有规则 -j / -g 到 To 链
+type ChainEdge struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Goto    bool     `json:"goto,omitempty"`
+	RuleIDs []string `json:"ruleIds"`
+}
+
+// ChainGraph：由 iptables-save 构建跳转图（只统计跳到表内已声明链的规则）
+func (s *IptablesService) ChainGraph(hostID uint, family IPFamily, table TableType) (*ChainGraph, error) {
+	if err := validateTable(string(table)); err != nil {
+		return nil, err
+	}
+	cli, err := s.sshClient(hostID)
+	if err != nil {
+		return nil, err
+	}
+	dump, err := cli.IptablesSave(s.boolFamily(family))
+	if err != nil {
+		return nil, err
+	}
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return nil, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	g := &ChainGraph{Nodes: []ChainNode{}, Edges: []ChainEdge{}, Revision: rs.Revision()}
+	t := rs.Table(string(table))
+	if t == nil {
+		return g, nil
+	}
+	return buildChainGraph(t, g), nil
+}
+
+func buildChainGraph(t *iptables.Table, g *ChainGraph) *ChainGraph {
+	ids := t.RuleIDs()
+	type key struct {
+		from, to string
+		isGoto   bool
+	}
+	edgeIndex := map[key]int{}
+	next := map[string][]string{}
+	for _, r := range t.Rules {
+		if r.Target == nil || t.Chain(r.Target.Name) == nil {
+			continue
+		}
+		k := key{r.Chain, r.Target.Name, r.Target.Goto}
+		i, ok := edgeIndex[k]
+		if !ok {
+			i = len(g.Edges)
+			edgeIndex[k] = i
+			g.Edges = append(g.Edges, ChainEdge{From: k.from, To: k.to, Goto: k.isGoto})
+			next[k.from] = append(next[k.from], k.to)
+		}
+		g.Edges[i].RuleIDs = append(g.Edges[i].RuleIDs, ids[r])
+	}
+
+	// 从内置链出发做一次遍历，标出可达的链
+	reachable := map[string]bool{}
+	var queue []string
+	for _, c := range t.Chains {
+		if c.Builtin() {
+			reachable[c.Name] = true
+			queue = append(queue, c.Name)
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, n := range next[cur] {
+			if !reachable[n] {
+				reachable[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	for _, c := range t.Chains {
+		n := ChainNode{
+			Name:       c.Name,
+			Builtin:    c.Builtin(),
+			Rules:      len(t.ChainRules(c.Name)),
+			References: len(t.Jumps(c.Name)),
+			Reachable:  reachable[c.Name],
+		}
+		if n.Builtin {
+			n.Policy = c.Policy
+		}
+		g.Nodes = append(g.Nodes, n)
+	}
+	return g
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+// commit-confirm：写操作带确认窗口时，先在目标机上布置一个脱离会话的回滚进程再修改；
+// 窗口内经一条新建的 SSH 连接确认才取消回滚，否则目标机自己恢复修改前的规则
+var (
+	ErrConfirmPending  = errors.New("a change is awaiting confirmation on this host")
+	ErrConfirmNotFound = errors.New("confirmation not found")
+	ErrConfirmExpired  = errors.New("confirmation window expired, the change has been rolled back")
+)
+
+// confirmTimeout：未指定窗口时的默认值，由配置 CONFIRM_TIMEOUT 设置
+var confirmTimeout = 60 * time.Second
+
+// maxConfirmTimeout：确认窗口上限，避免误填导致长时间不回滚
+const maxConfirmTimeout = time.Hour
+
+func SetConfirmTimeout(d time.Duration) {
+	if d > 0 {
+		confirmTimeout = d
+	}
+}
+
+// PendingConfirm：等待确认的变更
+type PendingConfirm struct {
+	ID       string    `json:"id"`
+	HostID   uint      `json:"hostId"`
+	V6       bool      `json:"v6"`
+	Deadline time.Time `json:"deadline"` // 超过后目标机自动回滚
+
+	rollback sshx.ScheduledRollback
+}
+
+// pendingConfirms：进程内登记；本服务重启后登记丢失，但目标机上的回滚照常执行
+var pendingConfirms = struct {
+	sync.Mutex
+	byID map[string]*PendingConfirm
+}{byID: map[string]*PendingConfirm{}}
+
+// expiredRetention：过期的登记保留一段时间，迟到的确认能得到 ErrConfirmExpired 而不是 404
+const expiredRetention = 10 * time.Minute
+
+// pendingFor：主机该协议族上未过期的待确认变更
+func pendingFor(hostID uint, v6 bool) *PendingConfirm {
+	pendingConfirms.Lock()
+	defer pendingConfirms.Unlock()
+	for id, p := range pendingConfirms.byID {
+		if time.Since(p.Deadline) > expiredRetention {
+			delete(pendingConfirms.byID, id)
+			continue
+		}
+		if time.Now().After(p.Deadline) {
+			continue
+		}
+		if p.HostID == hostID && p.V6 == v6 {
+			return p
+		}
+	}
+	return nil
+}
+
+func dropConfirm(id string) {
+	pendingConfirms.Lock()
+	delete(pendingConfirms.byID, id)
+	pendingConfirms.Unlock()
+}
+
+// armConfirm：在主机锁内、修改之前调用
+// 有未确认的变更时拒绝新的写入（否则回滚会连同新修改一起撤销）；
+// opt.Confirm 时备份当前规则集并在目标机上布置回滚
+func armConfirm(cli rulesetHost, hostID uint, v6 bool, opt WriteOptions) (*PendingConfirm, error) {
+	if p := pendingFor(hostID, v6); p != nil {
+		return nil, fmt.Errorf("%w (%s, until %s)", ErrConfirmPending, p.ID, p.Deadline.Format(time.RFC3339))
+	}
+	if !opt.Confirm {
+		return nil, nil
+	}
+	timeout := opt.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = confirmTimeout
+	}
+	if timeout > maxConfirmTimeout {
+		return nil, invalidf("confirm timeout must be at most %s", maxConfirmTimeout)
+	}
+	ctx := context.Background()
+	txn, err := cli.BeginIptablesTxn(ctx, v6)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := txn.ScheduleRollback(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	p := &PendingConfirm{
+		ID:       newConfirmID(),
+		HostID:   hostID,
+		V6:       v6,
+		Deadline: time.Now().Add(timeout),
+		rollback: rb,
+	}
+	pendingConfirms.Lock()
+	pendingConfirms.byID[p.ID] = p
+	pendingConfirms.Unlock()
+	return p, nil
+}
+
+// disarmConfirm：修改本身失败时撤掉刚布置的回滚（规则没变，不需要恢复）
+func disarmConfirm(cli rulesetHost, p *PendingConfirm) {
+	if p == nil {
+		return
+	}
+	_ = cli.CancelRollback(context.Background(), p.rollback)
+	dropConfirm(p.ID)
+}
+
+func newConfirmID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+type ConfirmService struct{ hosts *repo.HostRepo }
+
+func NewConfirmService() *ConfirmService { return &ConfirmService{hosts: repo.NewHostRepo()} }
+
+// List：主机上等待确认的变更
+func (s *ConfirmService) List(hostID uint) []PendingConfirm {
+	out := []PendingConfirm{}
+	for _, v6 := range []bool{false, true} {
+		if p := pendingFor(hostID, v6); p != nil {
+			out = append(out, *p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Deadline.Before(out[j].Deadline) })
+	return out
+}
+
+// Confirm：经一条新建的 SSH 连接取消回滚；能连上本身就证明修改没有把管理连接切断
+func (s *ConfirmService) Confirm(hostID uint, id string) error {
+	return s.resolve(hostID, id, func(p *PendingConfirm) error {
+		h, err := s.hosts.Get(hostID)
+		if err != nil {
+			return err
+		}
+		h.Normalize()
+		cli := sshx.New(*h) // 不走连接池：已建立的连接可能靠 ESTABLISHED 规则活着
+		defer cli.Close()
+		return cli.CancelRollback(context.Background(), p.rollback)
+	})
+}
+
+// Rollback：不等窗口结束，立即恢复修改前的规则；opt 只用到快照的操作者与原因
+func (s *ConfirmService) Rollback(hostID uint, id string, opt WriteOptions) error {
+	return s.resolve(hostID, id, func(p *PendingConfirm) error {
+		h, err := s.hosts.Get(hostID)
+		if err != nil {
+			return err
+		}
+		h.Normalize()
+		cli := sshx.Get(*h)
+		if opt.Reason == "" {
+			opt.Reason = "rollback confirm " + id
+		}
+		// 回滚不因快照失败而推迟：它本身就是恢复到已知的旧规则集
+		if _, err := snapshotLive(cli, hostID, p.V6, opt); err != nil {
+			log.Printf("[confirm] host %d: %v", hostID, err)
+		}
+		return cli.RunRollback(context.Background(), p.rollback)
+	})
+}
+
+// resolve：在主机锁内找到待确认变更并执行 fn；回滚已经发生时返回 ErrConfirmExpired
+func (s *ConfirmService) resolve(hostID uint, id string, fn func(p *PendingConfirm) error) error {
+	pendingConfirms.Lock()
+	p := pendingConfirms.byID[id]
+	pendingConfirms.Unlock()
+	if p == nil || p.HostID != hostID {
+		return fmt.Errorf("%w: %s", ErrConfirmNotFound, id)
+	}
+	unlock := lockHost(hostID, p.V6)
+	defer unlock()
+
+	if time.Now().After(p.Deadline) {
+		dropConfirm(id)
+		return ErrConfirmExpired
+	}
+	if err := fn(p); err != nil {
+		if errors.Is(err, sshx.ErrRollbackFired) {
+			dropConfirm(id)
+			return ErrConfirmExpired
+		}
+		return err // 连不上等情况保留登记，窗口内可重试
+	}
+	dropConfirm(id)
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// RulesetDiff：线上规则集（或较早的快照）与待导入内容（或另一个快照）的差异
+type RulesetDiff struct {
+	Changed  bool                 `json:"changed"`
+	Tables   []iptables.TableDiff `json:"tables"`
+	Unified  string               `json:"unified"`  // 规范化后（无计数器、无注释）的 unified diff
+	Revision string               `json:"revision"` // 线上版本号，确认后可作为 If-Match 导入
+}
+
+// Diff：比较主机当前规则集与 proposed（iptables-save 格式）
+// 只比较 proposed 中出现的表，与 iptables-restore 的替换范围一致
+func (s *RulesOpsService) Diff(hostID uint, v6 bool, proposed string) (*RulesetDiff, error) {
+	next, err := iptables.Parse(proposed)
+	if err != nil {
+		// ParseError 自带行号
+		return nil, invalidf("proposed ruleset: %v", err)
+	}
+	cli, err := s.cli(hostID)
+	if err != nil {
+		return nil, err
+	}
+	text, err := cli.IptablesSave(v6)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := iptables.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	return diffRulesets(cur, next, "current", "proposed"), nil
+}
+
+// diffRulesets：nameA / nameB 为 unified diff 的文件名
+func diffRulesets(cur, next *iptables.Ruleset, nameA, nameB string) *RulesetDiff {
+	out := &RulesetDiff{Tables: iptables.Diff(cur, next), Revision: cur.Revision()}
+	out.Changed = len(out.Tables) > 0
+
+	var a, b []string
+	for _, nt := range next.Tables {
+		if ct := cur.Table(nt.Name); ct != nil {
+			a = append(a, ct.NormalizedLines()...)
+		}
+		b = append(b, nt.NormalizedLines()...)
+	}
+	out.Unified = iptables.UnifiedDiff(a, b, nameA, nameB, 3)
+	return out
+}
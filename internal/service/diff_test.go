@@ -0,0 +1,67 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRulesets(t *testing.T) {
+	const cur = `*nat
+:PREROUTING ACCEPT [0:0]
+-A PREROUTING -p tcp -m tcp --dport 80 -j REDIRECT --to-ports 8080
+COMMIT
+*filter
+:INPUT ACCEPT [10:600]
+[3:180] -A INPUT -s 10.0.0.1/32 -j ACCEPT
+COMMIT
+`
+	cases := []struct {
+		name    string
+		next    string
+		changed bool
+		unified []string // unified diff 中应当出现的行
+		absent  []string // 不应出现的行
+	}{
+		{"same rules, different counters", "*filter\n:INPUT ACCEPT [0:0]\n-A INPUT -s 10.0.0.1/32 -j ACCEPT\nCOMMIT\n", false, nil, nil},
+		{"filter changed, nat not proposed", "*filter\n:INPUT DROP [0:0]\n-A INPUT -s 10.0.0.1/32 -j ACCEPT\nCOMMIT\n", true,
+			[]string{"--- current", "+++ proposed", "-:INPUT ACCEPT", "+:INPUT DROP", " -A INPUT -s 10.0.0.1/32 -j ACCEPT"},
+			[]string{"PREROUTING", "[3:180]"}},
+		{"new table", "*raw\n:PREROUTING ACCEPT [0:0]\nCOMMIT\n", true,
+			[]string{"+*raw", "+:PREROUTING ACCEPT", "+COMMIT"}, []string{"*filter", "*nat"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cr := mustRuleset(t, cur)
+			d := diffRulesets(cr, mustRuleset(t, c.next), "current", "proposed")
+			if d.Changed != c.changed || d.Changed != (len(d.Tables) > 0) {
+				t.Errorf("Changed = %v with %d tables, want %v", d.Changed, len(d.Tables), c.changed)
+			}
+			if d.Revision != cr.Revision() {
+				t.Errorf("Revision = %q, want current %q", d.Revision, cr.Revision())
+			}
+			if !c.changed && d.Unified != "" {
+				t.Errorf("Unified = %q, want empty", d.Unified)
+			}
+			lines := strings.Split(d.Unified, "\n")
+			for _, want := range c.unified {
+				if !hasLinePrefix(lines, want) {
+					t.Errorf("unified diff missing %q:\n%s", want, d.Unified)
+				}
+			}
+			for _, bad := range c.absent {
+				if strings.Contains(d.Unified, bad) {
+					t.Errorf("unified diff contains %q:\n%s", bad, d.Unified)
+				}
+			}
+		})
+	}
+}
+
+func hasLinePrefix(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// DryRunResult：iptables-restore --test 的校验结果，主机上的规则不做任何改动
+type DryRunResult struct {
+	Valid   bool           `json:"valid"`
+	Errors  []RestoreError `json:"errors,omitempty"`
+	Content string         `json:"content"`           // 实际送去校验的内容（结构化修改为渲染后的整表）
+	Lockout *LockoutCheck  `json:"lockout,omitempty"` // 防锁死模拟结果；修改与管理连接无关时为空
+}
+
+// RestoreError：Line 为 Content 中的行号（从 1 开始，0 表示无法定位）
+type RestoreError struct {
+	Line    int    `json:"line,omitempty"`
+	Text    string `json:"text,omitempty"`   // 该行内容
+	RuleID  string `json:"ruleId,omitempty"` // 结构化修改时对应的规则
+	Message string `json:"message"`
+}
+
+// iptables-restore 的报错形如 "line 5 failed" / "Error occurred at line: 5"
+var reRestoreLine = regexp.MustCompile(`(?i)\bline:?\s+(\d+)`)
+
+// testRestore：把 content 交给 iptables-restore --test，只解析、校验，不提交
+func testRestore(cli rulesetHost, v6 bool, content string) *DryRunResult {
+	res := &DryRunResult{Valid: true, Content: content}
+	if _, err := cli.IptablesRestore(v6, content, "-c", "--test"); err != nil {
+		res.Valid = false
+		res.Errors = []RestoreError{restoreError(content, err.Error())}
+	}
+	return res
+}
+
+func restoreError(content, msg string) RestoreError {
+	e := RestoreError{Message: msg}
+	m := reRestoreLine.FindAllStringSubmatch(msg, -1)
+	if len(m) == 0 {
+		return e
+	}
+	// 取最后一处：nft 版本先打印出错位置的细节，最后才是 "Error occurred at line"
+	n, _ := strconv.Atoi(m[len(m)-1][1])
+	e.Line, e.Text = atLine(content, n)
+	return e
+}
+
+// atLine：content 的第 n 行；越界时行号置 0
+func atLine(content string, n int) (int, string) {
+	lines := strings.Split(content, "\n")
+	if n < 1 || n > len(lines) {
+		return 0, ""
+	}
+	return n, strings.TrimRight(lines[n-1], "\r")
+}
+
+// dryRunTable：渲染修改后的表并 --test，出错行映射回对应规则
+func dryRunTable(cli rulesetHost, v6 bool, t *iptables.Table) *DryRunResult {
+	res := testRestore(cli, v6, t.String())
+	ids := t.RuleIDs()
+	for i := range res.Errors {
+		if r := t.RuleAtLine(res.Errors[i].Line); r != nil {
+			res.Errors[i].RuleID = ids[r]
+		}
+	}
+	return res
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// editTable：在 AST 上修改一张表，再用一次 iptables-restore 整表替换
+// 流程：加锁 → iptables-save -c → 解析 → 校验 If-Match → mutate → 渲染该表 → 保存快照 → iptables-restore -c
+// restore 只替换输入中出现的表，且整表要么全部生效要么不生效；-c 让未改动规则的计数器保持不变
+// opt.DryRun 时最后一步换成 iptables-restore --test，结果放在 WriteResult.DryRun；
+// mutate 之后做防锁死模拟（见 lockoutGuard）；opt.Confirm 时 restore 之前先布置回滚（见 armConfirm）
+func editTable(cli rulesetHost, hostID uint, v6 bool, table string, opt WriteOptions, mutate func(t *iptables.Table) error) (WriteResult, error) {
+	want := normalizeETag(opt.IfMatch)
+	if want == "" {
+		if !opt.DryRun {
+			return WriteResult{}, ErrPreconditionRequired
+		}
+		want = "*"
+	}
+	unlock := lockHost(hostID, v6)
+	defer unlock()
+
+	dump, err := cli.IptablesSave(v6, "-c")
+	if err != nil {
+		return WriteResult{}, err
+	}
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	cur := rs.Revision()
+	if err := checkRevision(cur, want); err != nil {
+		return WriteResult{Revision: cur}, err
+	}
+
+	var guard *lockoutGuard
+	if !opt.AllowLockout || opt.ProtectSSH || opt.DryRun {
+		guard = newLockoutGuard(cli, hostID, v6, rs)
+	}
+	t := rs.Table(table)
+	if t == nil {
+		// 表还没加载（如从未用过 nat），restore 时会带着内置链创建
+		t = &iptables.Table{Name: table}
+		rs.Tables = append(rs.Tables, t)
+	}
+	if err := mutate(t); err != nil {
+		return WriteResult{Revision: cur}, err
+	}
+	// 只有改动了 filter 表时才会补保护规则，此时 t 就是 filter 表，随 t 一起 restore
+	lc := guard.check(rs, opt.ProtectSSH)
+	if opt.DryRun {
+		res := dryRunTable(cli, v6, t)
+		res.Lockout = lc
+		return WriteResult{Revision: cur, DryRun: res}, nil
+	}
+	if err := lc.err(); err != nil && !opt.AllowLockout {
+		return WriteResult{Revision: cur}, err
+	}
+	pc, err := armConfirm(cli, hostID, v6, opt)
+	if err != nil {
+		return WriteResult{Revision: cur}, err
+	}
+	snap, err := recordSnapshot(hostID, v6, dump, cur, opt)
+	if err != nil {
+		disarmConfirm(cli, pc)
+		return WriteResult{Revision: cur}, err
+	}
+	if _, err := cli.IptablesRestore(v6, t.String(), "-c"); err != nil {
+		disarmConfirm(cli, pc)
+		return WriteResult{Revision: cur}, err
+	}
+
+	rev, err := currentRevision(cli, v6)
+	if err != nil {
+		// 修改已经生效，只是取不到新版本号；客户端重新读取即可
+		return WriteResult{Confirm: pc, Snapshot: snap}, nil
+	}
+	return WriteResult{Revision: rev, Confirm: pc, Snapshot: snap}, nil
+}
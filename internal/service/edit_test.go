@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"iptables-web/backend/internal/iptables"
+	"iptables-web/backend/internal/repo"
+)
+
+func TestEditTable(t *testing.T) {
+	addRule := func(tb *iptables.Table) error {
+		tb.InsertRule(mustRuleArgs(t, "INPUT", "-s", "198.51.100.0/24", "-j", "DROP"), 1)
+		return nil
+	}
+	cases := []struct {
+		name       string
+		opt        WriteOptions // IfMatch 中的 "cur" 换成当前版本号
+		mutate     func(tb *iptables.Table) error
+		restoreErr error
+		err        error
+		applied    bool
+	}{
+		{name: "applied", opt: WriteOptions{IfMatch: "cur"}, mutate: addRule, applied: true},
+		{name: "wildcard", opt: WriteOptions{IfMatch: "*"}, mutate: addRule, applied: true},
+		{name: "missing If-Match", mutate: addRule, err: ErrPreconditionRequired},
+		{name: "stale revision", opt: WriteOptions{IfMatch: "0123"}, mutate: addRule, err: ErrRevisionMismatch},
+		{name: "mutate fails", opt: WriteOptions{IfMatch: "cur"}, mutate: func(*iptables.Table) error { return invalidf("nope") }, err: ErrInvalidInput},
+		{name: "lockout", opt: WriteOptions{IfMatch: "cur"}, mutate: dropInput, err: ErrLockoutRisk},
+		{name: "lockout allowed", opt: WriteOptions{IfMatch: "cur", AllowLockout: true}, mutate: dropInput, applied: true},
+		{name: "restore fails", opt: WriteOptions{IfMatch: "cur"}, mutate: addRule, restoreErr: errors.New("iptables-restore: line 3 failed")},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hostID := uint(9200 + i)
+			defer repo.NewSnapshotRepo().DeleteByHost(hostID)
+			f := newFakeHost(t, baseDump)
+			f.restoreErr = c.restoreErr
+			before := f.rs.String()
+			opt := c.opt
+			opt.IfMatch = strings.ReplaceAll(opt.IfMatch, "cur", f.revision())
+			res, err := editTable(f, hostID, false, "filter", opt, c.mutate)
+			switch {
+			case c.restoreErr != nil:
+				if !errors.Is(err, c.restoreErr) {
+					t.Errorf("err = %v, want %v", err, c.restoreErr)
+				}
+			case c.err != nil:
+				if !errors.Is(err, c.err) {
+					t.Errorf("err = %v, want %v", err, c.err)
+				}
+				if len(f.restores) != 0 {
+					t.Errorf("restored %d time(s) after a failed check", len(f.restores))
+				}
+			case err != nil:
+				t.Fatalf("err = %v", err)
+			}
+			if changed := f.rs.String() != before; changed != c.applied {
+				t.Errorf("rules changed = %v, want %v", changed, c.applied)
+			}
+			if c.applied {
+				if res.Revision != f.revision() {
+					t.Errorf("revision = %s, want %s", res.Revision, f.revision())
+				}
+				if len(f.restores) != 1 || !strings.HasPrefix(f.restores[0], "*filter\n") {
+					t.Errorf("restores = %q, want one filter table", f.restores)
+				}
+				if snap, err := NewSnapshotService().Get(hostID, res.Snapshot); err != nil || snap.Content != before {
+					t.Errorf("snapshot %d = %v, %v, want the pre-change dump", res.Snapshot, snap, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEditTableDryRun(t *testing.T) {
+	const hostID = 9250
+	f := newFakeHost(t, baseDump)
+	before := f.rs.String()
+	f.testErr = errors.New("iptables-restore: line 5 failed")
+	res, err := editTable(f, hostID, false, "filter", WriteOptions{DryRun: true}, dropInput)
+	if err != nil {
+		t.Fatalf("dry-run without If-Match: %v", err)
+	}
+	if f.rs.String() != before || len(f.restores) != 0 || len(f.tests) != 1 {
+		t.Fatalf("dry-run touched the host: restores %d, tests %d", len(f.restores), len(f.tests))
+	}
+	d := res.DryRun
+	if d == nil || d.Valid || len(d.Errors) != 1 || d.Errors[0].Line != 5 {
+		t.Errorf("dry-run result = %+v", d)
+	}
+	if d != nil && (d.Lockout == nil || !d.Lockout.Blocked) {
+		t.Errorf("dry-run lockout = %+v, want blocked", d.Lockout)
+	}
+	if res.Snapshot != 0 {
+		t.Errorf("dry-run saved snapshot %d", res.Snapshot)
+	}
+}
+
+// 有未确认的变更时拒绝新的写入
+func TestEditTableConfirmPending(t *testing.T) {
+	const hostID = 9251
+	p := &PendingConfirm{ID: "pending-test", HostID: hostID, Deadline: time.Now().Add(time.Minute)}
+	pendingConfirms.Lock()
+	pendingConfirms.byID[p.ID] = p
+	pendingConfirms.Unlock()
+	defer dropConfirm(p.ID)
+
+	f := newFakeHost(t, baseDump)
+	_, err := editTable(f, hostID, false, "filter", WriteOptions{IfMatch: "*"}, func(*iptables.Table) error { return nil })
+	if !errors.Is(err, ErrConfirmPending) || len(f.restores) != 0 {
+		t.Errorf("err = %v, restores %d, want ErrConfirmPending and no restore", err, len(f.restores))
+	}
+}
@@ -2,16 +2,24 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"iptables-web/backend/internal/crypto"
 	"iptables-web/backend/internal/models"
 	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
 )
 
-type HostsService struct{ r *repo.HostRepo }
+type HostsService struct {
+	r     *repo.HostRepo
+	keys  *repo.HostKeyRepo
+	snaps *repo.SnapshotRepo
+}
 
-func NewHostsService() *HostsService { return &HostsService{r: repo.NewHostRepo()} }
+func NewHostsService() *HostsService {
+	return &HostsService{r: repo.NewHostRepo(), keys: repo.NewHostKeyRepo(), snaps: repo.NewSnapshotRepo()}
+}
 
 // ============ 查询 ============
 func (s *HostsService) List() ([]models.Host, error) {
@@ -40,6 +48,14 @@ type CreateHostInput struct {
 	LoginMethod        string // "user" | "sudo" | "root"
 	User, Password     string
 	RootUser, RootPass string
+
+	AuthType      string // "password" | "key" | "agent"
+	PrivateKey    string
+	KeyPassphrase string
+	Certificate   string
+	AgentSocket   string
+	AgentForward  bool
+	ViaHostID     *uint // 跳板机
 }
 
 func (s *HostsService) Create(in CreateHostInput) (*models.Host, error) {
@@ -70,6 +86,16 @@ func (s *HostsService) Create(in CreateHostInput) (*models.Host, error) {
 	}
 	m.Password = encUserPass
 	m.RootPass = encRootPass
+	m.AuthType = in.AuthType
+	if err := setKeyAuth(&m, in.PrivateKey, in.KeyPassphrase, in.Certificate, false); err != nil {
+		return nil, err
+	}
+	if err := setAgentAuth(&m, in.AgentSocket, in.AgentForward); err != nil {
+		return nil, err
+	}
+	if err := s.setVia(&m, in.ViaHostID); err != nil {
+		return nil, err
+	}
 	m.Normalize()
 
 	if err := s.r.Create(&m); err != nil {
@@ -88,6 +114,16 @@ type UpdateHostInput struct {
 	Password    string // 留空表示不改
 	RootUser    string
 	RootPass    string // 留空表示不改
+
+	AuthType         string // 留空表示不改
+	PrivateKey       string // 留空表示不改
+	KeyPassphrase    string // 留空表示不改
+	ClearPassphrase  bool   // 去掉已保存私钥的口令（私钥本身改为无口令时用）
+	Certificate      string // 留空表示不改
+	ClearCertificate bool
+	AgentSocket      string
+	AgentForward     bool
+	ViaHostID        *uint // nil 表示不经跳板机
 }
 
 func (s *HostsService) Update(in UpdateHostInput) (*models.Host, error) {
@@ -104,6 +140,7 @@ func (s *HostsService) Update(in UpdateHostInput) (*models.Host, error) {
 		return nil, errors.New("ip:port already exists")
 	}
 
+	oldAddr := fmt.Sprintf("%s:%d", h.IP, defPort(h.Port))
 	h.Name = strings.TrimSpace(in.Name)
 	h.IP = strings.TrimSpace(in.IP)
 	h.Port = defPort(in.Port)
@@ -126,17 +163,183 @@ func (s *HostsService) Update(in UpdateHostInput) (*models.Host, error) {
 		}
 		h.RootPass = enc
 	}
+	if in.AuthType != "" {
+		h.AuthType = in.AuthType
+	}
+	if in.ClearPassphrase {
+		h.KeyPassphrase = ""
+	}
+	if in.ClearCertificate {
+		h.Certificate = ""
+	}
+	if err := setKeyAuth(h, in.PrivateKey, in.KeyPassphrase, in.Certificate, true); err != nil {
+		return nil, err
+	}
+	if err := setAgentAuth(h, in.AgentSocket, in.AgentForward); err != nil {
+		return nil, err
+	}
+	if err := s.setVia(h, in.ViaHostID); err != nil {
+		return nil, err
+	}
 
 	h.Normalize()
 	if err := s.r.Update(h); err != nil {
 		return nil, err
 	}
+	// 凭据/地址可能已变，丢弃池中旧连接
+	sshx.DefaultPool().Invalidate(h.ID)
+	// 换了地址就是另一台机器：旧的固定公钥不再适用，下次连接重新 TOFU
+	if fmt.Sprintf("%s:%d", h.IP, defPort(h.Port)) != oldAddr {
+		if err := s.keys.DeleteByHost(h.ID); err != nil {
+			return nil, fmt.Errorf("host updated, but clearing the pinned host key failed: %w", err)
+		}
+	}
 	return h, nil
 }
 
 // ============ 删除 ============
-func (s *HostsService) Delete(id uint) error                  { return s.r.Delete(id) }
-func (s *HostsService) BatchDelete(ids []uint) (int64, error) { return s.r.BatchDelete(ids) }
+func (s *HostsService) Delete(id uint) error {
+	if err := s.checkNotVia(id); err != nil {
+		return err
+	}
+	if err := s.r.Delete(id); err != nil {
+		return err
+	}
+	sshx.DefaultPool().Invalidate(id)
+	if err := s.snaps.DeleteByHost(id); err != nil {
+		return err
+	}
+	return s.keys.DeleteByHost(id)
+}
+func (s *HostsService) BatchDelete(ids []uint) (int64, error) {
+	if err := s.checkNotVia(ids...); err != nil {
+		return 0, err
+	}
+	n, err := s.r.BatchDelete(ids)
+	if err != nil {
+		return n, err
+	}
+	sshx.DefaultPool().Invalidate(ids...)
+	if err := s.snaps.DeleteByHost(ids...); err != nil {
+		return n, err
+	}
+	return n, s.keys.DeleteByHost(ids...)
+}
+
+// setKeyAuth：校验并加密保存私钥/口令/证书；update=true 时空值表示沿用已保存的值（清除口令/证书由调用方先置空）
+func setKeyAuth(h *models.Host, privateKey, passphrase, certificate string, update bool) error {
+	privateKey = strings.TrimSpace(privateKey)
+	certificate = strings.TrimSpace(certificate)
+	if strings.ToLower(strings.TrimSpace(h.AuthType)) != "key" {
+		if update {
+			return nil
+		}
+		privateKey, passphrase, certificate = "", "", ""
+	}
+
+	// 组合出最终生效的私钥/口令/证书，整体校验一次
+	keyPEM, pass, cert := privateKey, passphrase, certificate
+	if update {
+		if keyPEM == "" {
+			keyPEM = crypto.MustOpen(h.PrivateKey)
+		}
+		if pass == "" && privateKey == "" {
+			pass = crypto.MustOpen(h.KeyPassphrase)
+		}
+		if cert == "" {
+			cert = h.Certificate
+		}
+	}
+	if strings.ToLower(strings.TrimSpace(h.AuthType)) == "key" {
+		if keyPEM == "" {
+			return errors.New("private key is required for key auth")
+		}
+		if err := sshx.ValidateKeyAuth(keyPEM, pass, cert); err != nil {
+			return err
+		}
+	}
+
+	if privateKey != "" {
+		enc, err := crypto.Seal(privateKey)
+		if err != nil {
+			return err
+		}
+		h.PrivateKey = enc
+		// 换了私钥：口令随之替换（允许新私钥无口令）
+		encPass, err := crypto.Seal(passphrase)
+		if err != nil {
+			return err
+		}
+		h.KeyPassphrase = encPass
+	} else if passphrase != "" {
+		encPass, err := crypto.Seal(passphrase)
+		if err != nil {
+			return err
+		}
+		h.KeyPassphrase = encPass
+	}
+	if certificate != "" {
+		h.Certificate = certificate
+	}
+	return nil
+}
+
+// setVia：校验跳板机存在、不成环、跳数不超限
+func (s *HostsService) setVia(h *models.Host, via *uint) error {
+	if via == nil || *via == 0 {
+		h.ViaHostID = nil
+		return nil
+	}
+	id := *via
+	hops := 0
+	for cur := id; ; {
+		if h.ID != 0 && cur == h.ID {
+			return errors.New("jump host chain loops back to this host")
+		}
+		hops++
+		if hops > sshx.MaxJumpHops {
+			return fmt.Errorf("jump host chain too long (max %d hops)", sshx.MaxJumpHops)
+		}
+		x, err := s.r.Get(cur)
+		if err != nil {
+			return fmt.Errorf("jump host %d not found", cur)
+		}
+		if x.ViaHostID == nil || *x.ViaHostID == 0 {
+			break
+		}
+		cur = *x.ViaHostID
+	}
+	h.ViaHostID = &id
+	return nil
+}
+
+// checkNotVia：仍被其它主机（不在本次删除范围内）用作跳板机时拒绝删除
+func (s *HostsService) checkNotVia(ids ...uint) error {
+	deleting := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		deleting[id] = true
+	}
+	users, err := s.r.ListByVia(ids...)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if !deleting[u.ID] {
+			return fmt.Errorf("host %d is used as jump host by %q", *u.ViaHostID, u.Name)
+		}
+	}
+	return nil
+}
+
+// setAgentAuth：agent 方式必须能找到 agent socket（主机配置或全局环境变量）
+func setAgentAuth(h *models.Host, socket string, forward bool) error {
+	h.AgentSocket = strings.TrimSpace(socket)
+	h.AgentForward = forward
+	if strings.ToLower(strings.TrimSpace(h.AuthType)) == "agent" && sshx.AgentSocketFor(*h) == "" {
+		return errors.New("agent auth requires agent_socket or SSH_AUTH_SOCK on the server")
+	}
+	return nil
+}
 
 // utils
 func defPort(p int) int {
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/repo"
+)
+
+// pinnedHost：新建一台主机并固定一个公钥
+func pinnedHost(t *testing.T, s *HostsService, name, ip string) *models.Host {
+	t.Helper()
+	h, err := s.Create(CreateHostInput{Name: name, IP: ip, Port: 22, LoginMethod: "root", User: "root", Password: "pw", AuthType: "password"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	k := &models.HostKey{HostID: h.ID, KeyType: "ssh-ed25519", PublicKey: "ssh-ed25519 AAAA", Fingerprint: "SHA256:x"}
+	if err := repo.NewHostKeyRepo().Save(k); err != nil {
+		t.Fatalf("save host key: %v", err)
+	}
+	return h
+}
+
+func TestUpdateHostClearsPinnedKeyOnAddressChange(t *testing.T) {
+	s := NewHostsService()
+	cases := []struct {
+		name    string
+		ip      string
+		port    int
+		cleared bool
+	}{
+		{"same address", "192.0.2.10", 22, false},
+		{"default port", "192.0.2.10", 0, false},
+		{"new ip", "192.0.2.11", 22, true},
+		{"new port", "192.0.2.10", 2222, true},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name := fmt.Sprintf("hostkey-update-%d", i)
+			h := pinnedHost(t, s, name, "192.0.2.10")
+			defer s.Delete(h.ID)
+			_, err := s.Update(UpdateHostInput{ID: h.ID, Name: name, IP: c.ip, Port: c.port, LoginMethod: "root", User: "root", AuthType: "password"})
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			_, err = repo.NewHostKeyRepo().GetByHost(h.ID)
+			if cleared := errors.Is(err, gorm.ErrRecordNotFound); cleared != c.cleared {
+				t.Errorf("host key cleared = %v (err %v), want %v", cleared, err, c.cleared)
+			}
+		})
+	}
+}
+
+func TestUpdateHostKeepsAuthType(t *testing.T) {
+	s := NewHostsService()
+	cases := []struct {
+		name     string
+		authType string
+		want     string
+	}{
+		{"omitted keeps agent", "", "agent"},
+		{"explicit agent", "agent", "agent"},
+		{"switch to password", "password", "password"},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name := fmt.Sprintf("authtype-update-%d", i)
+			in := CreateHostInput{Name: name, IP: "192.0.2.20", Port: 22, LoginMethod: "root", User: "root", RootUser: "root",
+				AuthType: "agent", AgentSocket: "/run/agent.sock"}
+			h, err := s.Create(in)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			defer s.Delete(h.ID)
+			got, err := s.Update(UpdateHostInput{ID: h.ID, Name: name + "-renamed", IP: in.IP, Port: in.Port, LoginMethod: "root",
+				User: "root", RootUser: "root", AuthType: c.authType, AgentSocket: in.AgentSocket})
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if got.AuthType != c.want {
+				t.Errorf("AuthType = %q, want %q", got.AuthType, c.want)
+			}
+		})
+	}
+}
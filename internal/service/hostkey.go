@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoPendingHostKey    = errors.New("no pending host key to approve")
+	ErrFingerprintMismatch = errors.New("fingerprint does not match the pending host key")
+)
+
+// HostKeyService：主机公钥固定（实现 ssh.HostKeyStore）+ 查看/审批/重置/导入
+type HostKeyService struct {
+	keys  *repo.HostKeyRepo
+	hosts *repo.HostRepo
+}
+
+func NewHostKeyService() *HostKeyService {
+	return &HostKeyService{keys: repo.NewHostKeyRepo(), hosts: repo.NewHostRepo()}
+}
+
+// ============ ssh.HostKeyStore ============
+
+func (s *HostKeyService) Pinned(h models.Host) (gossh.PublicKey, error) {
+	if h.ID == 0 {
+		return nil, errors.New("host key: host is not persisted")
+	}
+	k, err := s.keys.GetByHost(h.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.PublicKey == "" {
+		return nil, nil
+	}
+	return parseAuthorizedKey(k.PublicKey)
+}
+
+func (s *HostKeyService) Pin(h models.Host, key gossh.PublicKey) error {
+	if h.ID == 0 {
+		return errors.New("host key: host is not persisted")
+	}
+	k, err := s.keys.GetByHost(h.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		k = &models.HostKey{HostID: h.ID}
+	} else if err != nil {
+		return err
+	}
+	setPinned(k, key, "tofu")
+	return s.keys.Save(k)
+}
+
+func (s *HostKeyService) Mismatch(h models.Host, key gossh.PublicKey) error {
+	k, err := s.keys.GetByHost(h.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	k.PendingKeyType = key.Type()
+	k.PendingPublicKey = marshalAuthorizedKey(key)
+	k.PendingFingerprint = gossh.FingerprintSHA256(key)
+	k.PendingAt = &now
+	return s.keys.Save(k)
+}
+
+// ============ 查看 / 审批 / 重置 ============
+
+// Get：未固定时返回 nil, nil
+func (s *HostKeyService) Get(hostID uint) (*models.HostKey, error) {
+	if _, err := s.hosts.Get(hostID); err != nil {
+		return nil, err
+	}
+	k, err := s.keys.GetByHost(hostID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return k, err
+}
+
+// Approve：把待审批的 key 设为固定值；fingerprint 必须与待审批的一致，避免批准了未看到的 key
+func (s *HostKeyService) Approve(hostID uint, fingerprint string) (*models.HostKey, error) {
+	k, err := s.keys.GetByHost(hostID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !k.HasPending()) {
+		return nil, ErrNoPendingHostKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(fingerprint) != k.PendingFingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	key, err := parseAuthorizedKey(k.PendingPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	setPinned(k, key, "approved")
+	if err := s.keys.Save(k); err != nil {
+		return nil, err
+	}
+	sshx.DefaultPool().Invalidate(hostID)
+	return k, nil
+}
+
+// Reset：删除固定值，下次连接重新 TOFU
+func (s *HostKeyService) Reset(hostID uint) error {
+	if _, err := s.hosts.Get(hostID); err != nil {
+		return err
+	}
+	if err := s.keys.DeleteByHost(hostID); err != nil {
+		return err
+	}
+	sshx.DefaultPool().Invalidate(hostID)
+	return nil
+}
+
+// ============ 导入 known_hosts ============
+
+type KnownHostsResult struct {
+	HostID      uint   `json:"host_id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	Status      string `json:"status"` // imported | unchanged | conflict
+}
+
+type KnownHostsLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type KnownHostsImport struct {
+	Hosts   []KnownHostsResult    `json:"hosts"`
+	Skipped int                   `json:"skipped"` // 未匹配到任何已管理主机的条目
+	Errors  []KnownHostsLineError `json:"errors,omitempty"`
+}
+
+type knownHostsEntry struct {
+	patterns []string
+	key      gossh.PublicKey
+}
+
+// ImportKnownHosts：按 ip / [ip]:port（含 |1| 哈希形式）匹配已管理主机并固定公钥
+// overwrite=false 时，已固定且不一致的主机只报告 conflict，不覆盖
+func (s *HostKeyService) ImportKnownHosts(content string, overwrite bool) (*KnownHostsImport, error) {
+	var entries []knownHostsEntry
+	out := &KnownHostsImport{}
+
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		marker, hosts, key, _, _, err := gossh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			out.Errors = append(out.Errors, KnownHostsLineError{Line: lineNo, Error: err.Error()})
+			continue
+		}
+		// @cert-authority / @revoked 不参与固定
+		if marker != "" {
+			out.Skipped++
+			continue
+		}
+		entries = append(entries, knownHostsEntry{patterns: hosts, key: key})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	hs, err := s.hosts.List()
+	if err != nil {
+		return nil, err
+	}
+	used := make([]bool, len(entries))
+	for _, h := range hs {
+		h.Normalize()
+		addr := knownhosts.Normalize(fmt.Sprintf("%s:%d", h.IP, h.Port))
+
+		var best gossh.PublicKey
+		for i, e := range entries {
+			if !matchKnownHost(e.patterns, addr) {
+				continue
+			}
+			used[i] = true
+			if best == nil || keyTypeRank(e.key.Type()) < keyTypeRank(best.Type()) {
+				best = e.key
+			}
+		}
+		if best == nil {
+			continue
+		}
+		res := KnownHostsResult{HostID: h.ID, Name: h.Name, Fingerprint: gossh.FingerprintSHA256(best)}
+
+		k, err := s.keys.GetByHost(h.ID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			k = &models.HostKey{HostID: h.ID}
+		case err != nil:
+			return nil, err
+		}
+		switch {
+		case k.Fingerprint == res.Fingerprint:
+			res.Status = "unchanged"
+		case k.Fingerprint != "" && !overwrite:
+			res.Status = "conflict"
+		default:
+			setPinned(k, best, "known_hosts")
+			if err := s.keys.Save(k); err != nil {
+				return nil, err
+			}
+			sshx.DefaultPool().Invalidate(h.ID)
+			res.Status = "imported"
+		}
+		out.Hosts = append(out.Hosts, res)
+	}
+	for _, u := range used {
+		if !u {
+			out.Skipped++
+		}
+	}
+	return out, nil
+}
+
+// matchKnownHost：只支持精确主机名与 |1| 哈希；通配符条目不参与匹配
+func matchKnownHost(patterns []string, addr string) bool {
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			continue
+		}
+		if strings.HasPrefix(p, "|1|") {
+			parts := strings.Split(p[len("|1|"):], "|")
+			if len(parts) != 2 {
+				continue
+			}
+			salt, err1 := base64.StdEncoding.DecodeString(parts[0])
+			sum, err2 := base64.StdEncoding.DecodeString(parts[1])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			mac := hmac.New(sha1.New, salt)
+			mac.Write([]byte(addr))
+			if hmac.Equal(mac.Sum(nil), sum) {
+				return true
+			}
+			continue
+		}
+		if p == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// 同一主机有多种 key 时的优先级
+func keyTypeRank(t string) int {
+	switch t {
+	case gossh.KeyAlgoED25519:
+		return 0
+	case gossh.KeyAlgoECDSA256, gossh.KeyAlgoECDSA384, gossh.KeyAlgoECDSA521:
+		return 1
+	case gossh.KeyAlgoRSA:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// utils
+func setPinned(k *models.HostKey, key gossh.PublicKey, source string) {
+	k.KeyType = key.Type()
+	k.PublicKey = marshalAuthorizedKey(key)
+	k.Fingerprint = gossh.FingerprintSHA256(key)
+	k.Source = source
+	k.PendingKeyType, k.PendingPublicKey, k.PendingFingerprint = "", "", ""
+	k.PendingAt = nil
+}
+
+func marshalAuthorizedKey(key gossh.PublicKey) string {
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+}
+
+func parseAuthorizedKey(s string) (gossh.PublicKey, error) {
+	key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(s))
+	return key, err
+}
@@ -2,11 +2,12 @@
 package service
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"iptables-web/backend/internal/iptables"
 	"iptables-web/backend/internal/repo"
 	"iptables-web/backend/internal/ssh"
 )
@@ -22,50 +23,140 @@ const (
 
 // Chain / Rule 结构与前端 types/iptables.ts 对应
 type Chain struct {
-	Name    string `json:"name"`
-	Policy  string `json:"policy,omitempty"`
-	Builtin bool   `json:"builtin"` // policy != "-" 基本就是内置链
+	Name       string `json:"name"`
+	Policy     string `json:"policy,omitempty"`
+	Builtin    bool   `json:"builtin"`    // policy != "-" 基本就是内置链
+	References int    `json:"references"` // 表内 -j / -g 到该链的规则数
+	Packets    uint64 `json:"packets"`    // 内置链：走默认策略的包数
+	Bytes      uint64 `json:"bytes"`
 }
 
 type Rule struct {
-	ID         string   `json:"id"`         // 这里用 "CHAIN:NUM"
-	Num        int      `json:"num"`        // 行号
-	Chain      string   `json:"chain"`      // 链名
-	Table      string   `json:"table"`      // 表名
-	Family     string   `json:"family"`     // ipv4/ipv6
-	Protocol   string   `json:"protocol"`   // tcp/udp/icmp/all
-	SourceIP   string   `json:"sourceIp"`   // 源 IP
-	SourcePort string   `json:"sourcePort"` // 源端口
-	DestIP     string   `json:"destIp"`     // 目标 IP
-	DestPort   string   `json:"destPort"`   // 目标端口
-	Action     string   `json:"action"`     // ACCEPT/DROP/REJECT/DNAT/SNAT等
-	State      []string `json:"state"`      // 连接状态：NEW,ESTABLISHED,RELATED
-	Interface  string   `json:"interface"`  // 接口
-	ToPort     string   `json:"toPort"`     // DNAT/REDIRECT 的目标端口
-	ToSource   string   `json:"toSource"`   // SNAT/MASQUERADE 的目标地址
-	Comment    string   `json:"comment"`    // 注释
-	Spec       string   `json:"spec"`       // 原始规则字符串（用于显示和兼容）
+	ID           string         `json:"id"`                      // 规则指纹 "<16 位十六进制>-<序号>"（见 iptables.RuleIDs），与位置无关
+	Num          int            `json:"num"`                     // 行号
+	Chain        string         `json:"chain"`                   // 链名
+	Table        string         `json:"table"`                   // 表名
+	Family       string         `json:"family"`                  // ipv4/ipv6
+	Protocol     string         `json:"protocol"`                // tcp/udp/icmp/all
+	SourceIP     string         `json:"sourceIp"`                // 源 IP
+	SourcePort   string         `json:"sourcePort"`              // 源端口
+	DestIP       string         `json:"destIp"`                  // 目标 IP
+	DestPort     string         `json:"destPort"`                // 目标端口
+	Action       string         `json:"action"`                  // ACCEPT/DROP/REJECT/DNAT/SNAT等
+	State        []string       `json:"state"`                   // 连接状态：NEW,ESTABLISHED,RELATED
+	Interface    string         `json:"interface"`               // 入接口
+	OutInterface string         `json:"outInterface"`            // 出接口
+	Negate       RuleNegation   `json:"negate"`                  // 各字段前的 "!"
+	ToPort       string         `json:"toPort"`                  // DNAT/REDIRECT 的目标端口
+	ToSource     string         `json:"toSource"`                // SNAT/MASQUERADE 的目标地址
+	Comment      string         `json:"comment"`                 // 注释
+	Matches      []MatchSpec    `json:"matches,omitempty"`       // 表单字段之外的 -m 模块
+	Target       *TargetOptions `json:"targetOptions,omitempty"` // REJECT/LOG/MARK 等 target 的选项
+	Spec         string         `json:"spec"`                    // 原始规则字符串（用于显示和兼容）
+	Packets      uint64         `json:"packets"`                 // 命中包数（iptables-save -c）
+	Bytes        uint64         `json:"bytes"`                   // 命中字节数
 }
 
 type ChainInput struct {
 	Name string `json:"name"`
-	// Policy 暂时只用于内置链的策略展示，创建自定义链时不用
+	// Policy 只用于内置链的策略展示；自定义链没有策略，修改内置链策略走 SetPolicy
 	Policy string `json:"policy,omitempty"`
 }
 
 type RuleInput struct {
-	Num        *int     `json:"num,omitempty"` // nil/0 表示追加（-A），>0 表示插入（-I num）
-	Protocol   string   `json:"protocol"`      // tcp/udp/icmp/all
-	SourceIP   string   `json:"sourceIp"`      // 源 IP
-	SourcePort string   `json:"sourcePort"`    // 源端口
-	DestIP     string   `json:"destIp"`        // 目标 IP
-	DestPort   string   `json:"destPort"`      // 目标端口
-	Action     string   `json:"action"`        // ACCEPT/DROP/REJECT/DNAT/SNAT等
-	State      []string `json:"state"`         // 连接状态
-	Interface  string   `json:"interface"`     // 接口
-	ToPort     string   `json:"toPort"`        // DNAT 目标端口
-	ToSource   string   `json:"toSource"`      // SNAT 目标地址
-	Comment    string   `json:"comment"`       // 注释
+	Num          *int           `json:"num,omitempty"`           // nil/0 表示追加（-A），>0 表示插入（-I num）
+	Protocol     string         `json:"protocol"`                // tcp/udp/icmp/all
+	SourceIP     string         `json:"sourceIp"`                // 源 IP
+	SourcePort   string         `json:"sourcePort"`              // 源端口
+	DestIP       string         `json:"destIp"`                  // 目标 IP
+	DestPort     string         `json:"destPort"`                // 目标端口
+	Action       string         `json:"action"`                  // ACCEPT/DROP/REJECT/DNAT/SNAT等
+	State        []string       `json:"state"`                   // 连接状态
+	Interface    string         `json:"interface"`               // 入接口（-i）
+	OutInterface string         `json:"outInterface"`            // 出接口（-o）
+	Negate       RuleNegation   `json:"negate"`                  // 各字段前的 "!"
+	ToPort       string         `json:"toPort"`                  // DNAT 目标端口
+	ToSource     string         `json:"toSource"`                // SNAT 目标地址
+	Comment      string         `json:"comment"`                 // 注释
+	Matches      []MatchSpec    `json:"matches"`                 // multiport / iprange / limit / recent / set / mark / owner / physdev / tcp 等
+	Target       *TargetOptions `json:"targetOptions,omitempty"` // 只能填与 Action 对应的一项
+}
+
+// RuleNegation：对应字段是否取反（iptables 的 "! -s 1.2.3.4"、"! --dport 22"）
+type RuleNegation struct {
+	Protocol     bool `json:"protocol,omitempty"`
+	SourceIP     bool `json:"sourceIp,omitempty"`
+	SourcePort   bool `json:"sourcePort,omitempty"`
+	DestIP       bool `json:"destIp,omitempty"`
+	DestPort     bool `json:"destPort,omitempty"`
+	State        bool `json:"state,omitempty"`
+	Interface    bool `json:"interface,omitempty"`
+	OutInterface bool `json:"outInterface,omitempty"`
+}
+
+// validate：取反的字段必须有值；端口依赖 -p 加载协议 match，协议不能取反
+func (n RuleNegation) validate(in *RuleInput) error {
+	for _, f := range []struct {
+		name  string
+		neg   bool
+		empty bool
+	}{
+		{"protocol", n.Protocol, in.Protocol == "" || in.Protocol == "all"},
+		{"sourceIp", n.SourceIP, in.SourceIP == ""},
+		{"sourcePort", n.SourcePort, in.SourcePort == ""},
+		{"destIp", n.DestIP, in.DestIP == ""},
+		{"destPort", n.DestPort, in.DestPort == ""},
+		{"state", n.State, len(in.State) == 0},
+		{"interface", n.Interface, in.Interface == ""},
+		{"outInterface", n.OutInterface, in.OutInterface == ""},
+	} {
+		if f.neg && f.empty {
+			return fmt.Errorf("negate.%s is set but %s is empty", f.name, f.name)
+		}
+	}
+	if n.Protocol && (in.SourcePort != "" || in.DestPort != "") {
+		return fmt.Errorf("ports cannot be used with a negated protocol")
+	}
+	return nil
+}
+
+// not：取反时在参数前加 "!"
+func not(neg bool, args ...string) []string {
+	if neg {
+		return append([]string{"!"}, args...)
+	}
+	return args
+}
+
+// normalize：规范化并校验 Matches / target 选项（写操作之前调用，校验失败不能动远端规则）
+func (in *RuleInput) normalize(v6 bool, table string) error {
+	if err := validateTable(table); err != nil {
+		return err
+	}
+	if in.Action != "" && !reChainName.MatchString(in.Action) {
+		return invalidf("invalid action %q", in.Action)
+	}
+	if err := in.Negate.validate(in); err != nil {
+		return err
+	}
+	// xt_comment 限制 256 字节（含结尾 \0）
+	if len(in.Comment) > 255 {
+		return invalidf("comment is longer than 255 bytes")
+	}
+	in.Matches = normalizeMatches(in.Matches)
+	if err := validateMatches(in.Protocol, in.Matches); err != nil {
+		return err
+	}
+	if err := validateTarget(v6, table, in.Protocol, in.Action, in.Target); err != nil {
+		return err
+	}
+	// 所有取值最终都会渲染进 restore 输入或命令行，换行等控制字符一律拒绝
+	for _, a := range buildIptablesArgs(*in) {
+		if err := iptables.CheckValue(a); err != nil {
+			return invalidf("%v", err)
+		}
+	}
+	return nil
 }
 
 // IptablesService：按 hostId 取 Host，再通过 ssh.Client 去调用 iptables
@@ -83,7 +174,7 @@ func (s *IptablesService) sshClient(hostID uint) (*ssh.Client, error) {
 		return nil, err
 	}
 	h.Normalize()
-	return ssh.New(*h), nil
+	return ssh.Get(*h), nil
 }
 
 func (s *IptablesService) boolFamily(family IPFamily) bool {
@@ -92,31 +183,42 @@ func (s *IptablesService) boolFamily(family IPFamily) bool {
 
 // ============ 查询 ============
 
-// ListChains 返回某个 host / family / table 下的链列表
-func (s *IptablesService) ListChains(hostID uint, family IPFamily, table TableType) ([]Chain, error) {
+// ListChains 返回某个 host / family / table 下的链列表（带计数器），以及该协议族规则集的版本号
+func (s *IptablesService) ListChains(hostID uint, family IPFamily, table TableType) ([]Chain, string, error) {
 	cli, err := s.sshClient(hostID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	dump, err := cli.IptablesSave(s.boolFamily(family))
+	dump, err := cli.IptablesSave(s.boolFamily(family), "-c")
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	rev, err := Revision(dump)
+	if err != nil {
+		return nil, "", err
 	}
-	chains, _ := parseTable(dump, string(table))
-	return chains, nil
+	chains, _, err := parseTable(dump, string(table))
+	return chains, rev, err
 }
 
-// ListRules 返回某个链下的规则列表
-func (s *IptablesService) ListRules(hostID uint, family IPFamily, table TableType, chainName string) ([]Rule, error) {
+// ListRules 返回某个链下的规则列表（带计数器），以及该协议族规则集的版本号
+func (s *IptablesService) ListRules(hostID uint, family IPFamily, table TableType, chainName string) ([]Rule, string, error) {
 	cli, err := s.sshClient(hostID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	dump, err := cli.IptablesSave(s.boolFamily(family))
+	dump, err := cli.IptablesSave(s.boolFamily(family), "-c")
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	rev, err := Revision(dump)
+	if err != nil {
+		return nil, "", err
+	}
+	_, rules, err := parseTable(dump, string(table))
+	if err != nil {
+		return nil, "", err
 	}
-	_, rules := parseTable(dump, string(table))
 
 	out := make([]Rule, 0, len(rules))
 	for _, r := range rules {
@@ -124,38 +226,55 @@ func (s *IptablesService) ListRules(hostID uint, family IPFamily, table TableTyp
 			out = append(out, r)
 		}
 	}
-	return out, nil
+	return out, rev, nil
 }
 
 // ============ 链管理 ============
 
-func (s *IptablesService) CreateChain(hostID uint, family IPFamily, table TableType, in ChainInput) error {
-	cli, err := s.sshClient(hostID)
-	if err != nil {
-		return err
+func (s *IptablesService) CreateChain(hostID uint, family IPFamily, table TableType, in ChainInput, opt WriteOptions) (WriteResult, error) {
+	if in.Policy != "" && in.Policy != "-" {
+		return WriteResult{}, invalidf("user chains have no policy; set policies on builtin chains via the policy endpoint")
 	}
-	args := []string{"-N", in.Name}
-	_, err = cli.Iptables(s.boolFamily(family), string(table), args...)
-	return err
+	return s.write(hostID, family, table, in.Name, opt, func(cli *ssh.Client) error {
+		_, err := cli.Iptables(s.boolFamily(family), string(table), "-N", in.Name)
+		return err
+	}, func(t *iptables.Table) error {
+		if t.Chain(in.Name) != nil {
+			return fmt.Errorf("%w: %s", ErrChainExists, in.Name)
+		}
+		t.Chains = append(t.Chains, &iptables.Chain{Name: in.Name, Policy: "-"})
+		return nil
+	})
 }
 
-func (s *IptablesService) DeleteChain(hostID uint, family IPFamily, table TableType, chainName string) error {
-	cli, err := s.sshClient(hostID)
-	if err != nil {
+func (s *IptablesService) ClearChain(hostID uint, family IPFamily, table TableType, chainName string, opt WriteOptions) (WriteResult, error) {
+	return s.write(hostID, family, table, chainName, opt, func(cli *ssh.Client) error {
+		_, err := cli.Iptables(s.boolFamily(family), string(table), "-F", chainName)
 		return err
-	}
-	// 注意：需要确保链已经被 flush 且无引用，否则 iptables -X 会失败
-	_, err = cli.Iptables(s.boolFamily(family), string(table), "-X", chainName)
-	return err
+	}, func(t *iptables.Table) error {
+		if t.Chain(chainName) == nil {
+			return fmt.Errorf("%w: %s", ErrChainNotFound, chainName)
+		}
+		t.FlushChain(chainName)
+		return nil
+	})
 }
 
-func (s *IptablesService) ClearChain(hostID uint, family IPFamily, table TableType, chainName string) error {
+// write：校验表 / 链名后，在主机锁内校验 If-Match 并执行修改
+// opt.DryRun / opt.ProtectSSH 时不执行 fn，而是在 AST 上做等价的 preview 修改后整表 restore（或 --test 校验）；
+// 否则 preview 只用于防锁死模拟
+func (s *IptablesService) write(hostID uint, family IPFamily, table TableType, chainName string, opt WriteOptions, fn func(cli *ssh.Client) error, preview func(t *iptables.Table) error) (WriteResult, error) {
+	if opt.DryRun || opt.ProtectSSH {
+		return s.edit(hostID, family, table, chainName, opt, preview)
+	}
+	if err := validateTableChain(string(table), chainName); err != nil {
+		return WriteResult{}, err
+	}
 	cli, err := s.sshClient(hostID)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
-	_, err = cli.Iptables(s.boolFamily(family), string(table), "-F", chainName)
-	return err
+	return guardedWrite(cli, hostID, s.boolFamily(family), opt, tablePreview(string(table), preview), func() error { return fn(cli) })
 }
 
 // ============ 规则管理 ============
@@ -165,56 +284,53 @@ func buildIptablesArgs(in RuleInput) []string {
 
 	// 协议
 	if in.Protocol != "" && in.Protocol != "all" {
-		args = append(args, "-p", in.Protocol)
+		args = append(args, not(in.Negate.Protocol, "-p", in.Protocol)...)
 	}
 
 	// 源 IP
 	if in.SourceIP != "" {
-		args = append(args, "-s", in.SourceIP)
+		args = append(args, not(in.Negate.SourceIP, "-s", in.SourceIP)...)
 	}
 
 	// 源端口
 	if in.SourcePort != "" && in.Protocol != "" && in.Protocol != "all" {
-		args = append(args, "--sport", in.SourcePort)
+		args = append(args, not(in.Negate.SourcePort, "--sport", in.SourcePort)...)
 	}
 
 	// 目标 IP
 	if in.DestIP != "" {
-		args = append(args, "-d", in.DestIP)
+		args = append(args, not(in.Negate.DestIP, "-d", in.DestIP)...)
 	}
 
 	// 目标端口
 	if in.DestPort != "" && in.Protocol != "" && in.Protocol != "all" {
-		args = append(args, "--dport", in.DestPort)
+		args = append(args, not(in.Negate.DestPort, "--dport", in.DestPort)...)
 	}
 
 	// 连接状态
 	if len(in.State) > 0 {
-		args = append(args, "-m", "conntrack", "--ctstate", strings.Join(in.State, ","))
+		args = append(args, "-m", "conntrack")
+		args = append(args, not(in.Negate.State, "--ctstate", strings.Join(in.State, ","))...)
 	}
 
 	// 接口
 	if in.Interface != "" {
-		args = append(args, "-i", in.Interface)
+		args = append(args, not(in.Negate.Interface, "-i", in.Interface)...)
+	}
+	if in.OutInterface != "" {
+		args = append(args, not(in.Negate.OutInterface, "-o", in.OutInterface)...)
 	}
 
+	// 其他 match 模块
+	args = append(args, matchArgs(in.Matches)...)
+
 	// 动作
 	if in.Action != "" {
 		args = append(args, "-j", in.Action)
 
 		// DNAT 需要 --to-destination
 		if in.Action == "DNAT" && (in.ToSource != "" || in.ToPort != "") {
-			dest := in.ToSource
-			if in.ToPort != "" {
-				if dest == "" {
-					dest = ":" + in.ToPort
-				} else {
-					dest = dest + ":" + in.ToPort
-				}
-			}
-			if dest != "" {
-				args = append(args, "--to-destination", dest)
-			}
+			args = append(args, "--to-destination", joinNATDest(in.ToSource, in.ToPort))
 		}
 
 		// SNAT 需要 --to-source
@@ -226,6 +342,9 @@ func buildIptablesArgs(in RuleInput) []string {
 		if in.Action == "REDIRECT" && in.ToPort != "" {
 			args = append(args, "--to-ports", in.ToPort)
 		}
+
+		// 其他 target 的类型化选项
+		args = append(args, targetArgs(in.Action, in.Target)...)
 	}
 
 	// 注释
@@ -236,92 +355,104 @@ func buildIptablesArgs(in RuleInput) []string {
 	return args
 }
 
-func parseRuleSpec(spec string) (protocol, sourceIP, sourcePort, destIP, destPort, action, iface, toPort, toSource string, state []string) {
-	parts := strings.Fields(spec)
+// joinNATDest：拼出 --to-destination；IPv6 地址带端口时要写成 [addr]:port
+func joinNATDest(addr, port string) string {
+	if port == "" {
+		return addr
+	}
+	if strings.Contains(addr, ":") && !strings.HasPrefix(addr, "[") {
+		addr = "[" + addr + "]"
+	}
+	return addr + ":" + port
+}
 
-	for i := 0; i < len(parts); i++ {
-		switch parts[i] {
-		case "-p":
-			if i+1 < len(parts) {
-				protocol = parts[i+1]
-				i++
-			}
-		case "-s":
-			if i+1 < len(parts) {
-				sourceIP = parts[i+1]
-				i++
-			}
-		case "--sport", "--source-port":
-			if i+1 < len(parts) {
-				sourcePort = parts[i+1]
-				i++
-			}
-		case "-d":
-			if i+1 < len(parts) {
-				destIP = parts[i+1]
-				i++
-			}
-		case "--dport", "--destination-port":
-			if i+1 < len(parts) {
-				destPort = parts[i+1]
-				i++
-			}
-		case "-j":
-			if i+1 < len(parts) {
-				action = parts[i+1]
-				i++
-			}
-		case "-i":
-			if i+1 < len(parts) {
-				iface = parts[i+1]
-				i++
-			}
-		case "--ctstate":
-			if i+1 < len(parts) {
-				state = strings.Split(parts[i+1], ",")
-				i++
-			}
-		case "--to-destination":
-			if i+1 < len(parts) {
-				dest := parts[i+1]
-				if strings.Contains(dest, ":") {
-					p := strings.Split(dest, ":")
-					toSource = p[0]
-					if len(p) > 1 {
-						toPort = p[1]
-					}
-				} else {
-					toSource = dest
-				}
-				i++
-			}
-		case "--to-source":
-			if i+1 < len(parts) {
-				toSource = parts[i+1]
-				i++
-			}
-		case "--to-ports":
-			if i+1 < len(parts) {
-				toPort = parts[i+1]
-				i++
-			}
+// splitNATDest：joinNATDest 的逆操作；接受 addr、addr:port、:port、[v6]:port 和不带端口的 v6 地址
+func splitNATDest(dest string) (addr, port string) {
+	if strings.HasPrefix(dest, "[") {
+		if end := strings.IndexByte(dest, ']'); end > 0 {
+			return dest[1:end], strings.TrimPrefix(dest[end+1:], ":")
 		}
+		return dest, ""
 	}
+	if strings.Count(dest, ":") != 1 {
+		// 没有端口，或是不带方括号的 v6 地址
+		return dest, ""
+	}
+	addr, port, _ = strings.Cut(dest, ":")
+	return addr, port
+}
 
-	if protocol == "" {
-		protocol = "all"
+// ruleFields：从 AST 取出表单字段及其取反标记（只取第一处出现）
+func ruleFields(dst *Rule, r *iptables.Rule) {
+	field := func(o *iptables.Option, val *string, neg *bool) {
+		if o != nil {
+			*val, *neg = o.Value(), o.Negated
+		}
+	}
+	field(r.Param("-p", "--protocol"), &dst.Protocol, &dst.Negate.Protocol)
+	field(r.Param("-s", "--source", "--src"), &dst.SourceIP, &dst.Negate.SourceIP)
+	field(r.Param("-d", "--destination", "--dst"), &dst.DestIP, &dst.Negate.DestIP)
+	field(r.Param("-i", "--in-interface"), &dst.Interface, &dst.Negate.Interface)
+	field(r.Param("-o", "--out-interface"), &dst.OutInterface, &dst.Negate.OutInterface)
+	field(r.MatchOption("--sport", "--source-port"), &dst.SourcePort, &dst.Negate.SourcePort)
+	field(r.MatchOption("--dport", "--destination-port"), &dst.DestPort, &dst.Negate.DestPort)
+	if o := r.MatchOption("--ctstate", "--state"); o != nil {
+		dst.State = strings.Split(o.Value(), ",")
+		dst.Negate.State = o.Negated
+	}
+
+	if t := r.Target; t != nil {
+		dst.Action = t.Name
+		if dest := t.Option("--to-destination").Value(); dest != "" {
+			dst.ToSource, dst.ToPort = splitNATDest(dest)
+		}
+		if v := t.Option("--to-source").Value(); v != "" {
+			dst.ToSource = v
+		}
+		if v := t.Option("--to-ports").Value(); v != "" {
+			dst.ToPort = v
+		}
 	}
 
-	return
+	if dst.Protocol == "" {
+		dst.Protocol = "all"
+	}
 }
 
 // CreateRule：在链里插入/追加一条规则
-func (s *IptablesService) CreateRule(hostID uint, family IPFamily, table TableType, chainName string, in RuleInput) error {
-	cli, err := s.sshClient(hostID)
-	if err != nil {
-		return err
+func (s *IptablesService) CreateRule(hostID uint, family IPFamily, table TableType, chainName string, in RuleInput, opt WriteOptions) (WriteResult, error) {
+	if err := in.normalize(s.boolFamily(family), string(table)); err != nil {
+		return WriteResult{}, err
+	}
+	return s.write(hostID, family, table, chainName, opt, func(cli *ssh.Client) error {
+		return s.insertRule(cli, family, table, chainName, in)
+	}, func(t *iptables.Table) error {
+		r, err := iptables.ParseRuleArgs(chainName, buildIptablesArgs(in))
+		if err != nil {
+			return invalidf("rule: %v", err)
+		}
+		pos := 0
+		if in.Num != nil {
+			pos = *in.Num
+		}
+		if err := checkInsertPos(t, chainName, pos); err != nil {
+			return err
+		}
+		t.InsertRule(r, pos)
+		return nil
+	})
+}
+
+// checkInsertPos：与 "iptables -I CHAIN N" 一致，N 最大为链长 + 1；
+// InsertRule 会把越界位置当作追加，预览必须先拦下，免得与真实命令结果不一致
+func checkInsertPos(t *iptables.Table, chainName string, pos int) error {
+	if n := len(t.ChainRules(chainName)); pos > n+1 {
+		return invalidf("position %d out of range, chain %s has %d rules", pos, chainName, n)
 	}
+	return nil
+}
 
+func (s *IptablesService) insertRule(cli *ssh.Client, family IPFamily, table TableType, chainName string, in RuleInput) error {
 	args := []string{}
 	if in.Num != nil && *in.Num > 0 {
 		args = append(args, "-I", chainName, strconv.Itoa(*in.Num))
@@ -331,183 +462,187 @@ func (s *IptablesService) CreateRule(hostID uint, family IPFamily, table TableTy
 
 	args = append(args, buildIptablesArgs(in)...)
 
-	_, err = cli.Iptables(s.boolFamily(family), string(table), args...)
+	_, err := cli.Iptables(s.boolFamily(family), string(table), args...)
 	return err
 }
 
-// UpdateRule：简单策略 = 先删旧规则，再在同一个位置插入新规则
-func (s *IptablesService) UpdateRule(hostID uint, family IPFamily, table TableType, chainName string, ruleID string, in RuleInput) error {
-	num, err := parseRuleNum(ruleID)
+// UpdateRule：在 AST 上把 ruleId 对应的规则换成新内容（可同时改位置），整表一次 restore，失败时原规则不受影响
+func (s *IptablesService) UpdateRule(hostID uint, family IPFamily, table TableType, chainName string, ruleID string, in RuleInput, opt WriteOptions) (WriteResult, error) {
+	if err := in.normalize(s.boolFamily(family), string(table)); err != nil {
+		return WriteResult{}, err
+	}
+	next, err := iptables.ParseRuleArgs(chainName, buildIptablesArgs(in))
 	if err != nil {
-		return err
+		return WriteResult{}, invalidf("rule: %v", err)
+	}
+	pos := 0
+	if in.Num != nil {
+		pos = *in.Num
+	}
+	return s.edit(hostID, family, table, chainName, opt, replaceRule(chainName, ruleID, next, pos))
+}
+
+// replaceRule：把 ruleId 对应的规则换成 next；pos 大于 0 且与原位置不同时同时移动
+func replaceRule(chainName, ruleID string, next *iptables.Rule, pos int) func(t *iptables.Table) error {
+	return func(t *iptables.Table) error {
+		num, old, err := resolveRule(t, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		t.ReplaceRule(old, next)
+		if pos > 0 && pos != num {
+			// 与 move.go 一致：越界位置直接报错，不能被 InsertRule 当作追加
+			if n := len(t.ChainRules(chainName)); pos > n {
+				return invalidf("position %d out of range, chain %s has %d rules", pos, chainName, n)
+			}
+			return t.MoveRule(next, pos)
+		}
+		return nil
+	}
+}
+
+// edit：校验表 / 链名后走 editTable（整表原子替换）
+func (s *IptablesService) edit(hostID uint, family IPFamily, table TableType, chainName string, opt WriteOptions, mutate func(t *iptables.Table) error) (WriteResult, error) {
+	if err := validateTableChain(string(table), chainName); err != nil {
+		return WriteResult{}, err
 	}
 	cli, err := s.sshClient(hostID)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
+	return editTable(cli, hostID, s.boolFamily(family), string(table), opt, mutate)
+}
 
-	// 先删旧
-	if _, err := cli.Iptables(s.boolFamily(family), string(table), "-D", chainName, strconv.Itoa(num)); err != nil {
+// DeleteRule：删除单条规则（-D CHAIN NUM），位置在主机锁内按 ruleId 重新解析
+// 不能按 "-D CHAIN <spec>" 删：链中有完全相同的规则时内核删的是第一条，不一定是 ruleId 指的那条
+func (s *IptablesService) DeleteRule(hostID uint, family IPFamily, table TableType, chainName string, ruleID string, opt WriteOptions) (WriteResult, error) {
+	return s.write(hostID, family, table, chainName, opt, func(cli *ssh.Client) error {
+		num, _, err := s.locateRule(cli, family, table, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		_, err = cli.Iptables(s.boolFamily(family), string(table), "-D", chainName, strconv.Itoa(num))
 		return err
+	}, deleteRule(chainName, ruleID))
+}
+
+// deleteRule：DeleteRule 的 AST 等价修改
+func deleteRule(chainName, ruleID string) func(t *iptables.Table) error {
+	return func(t *iptables.Table) error {
+		_, r, err := resolveRule(t, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		t.RemoveRule(r)
+		return nil
 	}
+}
 
-	// 再插入新规则（固定插入到指定 num）
-	n := num
-	if in.Num != nil && *in.Num > 0 {
-		n = *in.Num
-	}
-	return s.CreateRule(hostID, family, table, chainName, RuleInput{
-		Num:        &n,
-		Protocol:   in.Protocol,
-		SourceIP:   in.SourceIP,
-		SourcePort: in.SourcePort,
-		DestIP:     in.DestIP,
-		DestPort:   in.DestPort,
-		Action:     in.Action,
-		State:      in.State,
-		Interface:  in.Interface,
-		ToPort:     in.ToPort,
-		ToSource:   in.ToSource,
-		Comment:    in.Comment,
+// ZeroRule：把单条规则的计数器清零（-Z CHAIN NUM），位置在主机锁内按 ruleId 重新解析
+func (s *IptablesService) ZeroRule(hostID uint, family IPFamily, table TableType, chainName string, ruleID string, opt WriteOptions) (WriteResult, error) {
+	return s.write(hostID, family, table, chainName, opt, func(cli *ssh.Client) error {
+		num, _, err := s.locateRule(cli, family, table, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		_, err = cli.Iptables(s.boolFamily(family), string(table), "-Z", chainName, strconv.Itoa(num))
+		return err
+	}, func(t *iptables.Table) error {
+		_, r, err := resolveRule(t, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		r.Counters = &iptables.Counters{}
+		return nil
 	})
 }
 
-func (s *IptablesService) DeleteRule(hostID uint, family IPFamily, table TableType, chainName string, ruleID string) error {
-	num, err := parseRuleNum(ruleID)
+// locateRule：取当前规则集，把 ruleId 解析成链内位置（1..N）和规则
+func (s *IptablesService) locateRule(cli *ssh.Client, family IPFamily, table TableType, chainName, ruleID string) (int, *iptables.Rule, error) {
+	dump, err := cli.IptablesSave(s.boolFamily(family))
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	cli, err := s.sshClient(hostID)
+	rs, err := iptables.Parse(dump)
 	if err != nil {
-		return err
+		return 0, nil, fmt.Errorf("parse iptables-save: %w", err)
 	}
-	_, err = cli.Iptables(s.boolFamily(family), string(table), "-D", chainName, strconv.Itoa(num))
-	return err
+	t := rs.Table(string(table))
+	if t == nil {
+		return 0, nil, fmt.Errorf("%w: table %s is empty", ErrRuleNotFound, table)
+	}
+	return resolveRule(t, chainName, ruleID)
 }
 
 // ============ 解析 iptables-save ============
 
 // parseTable 只解析指定表的数据，返回链和规则列表
-func parseTable(dump string, table string) ([]Chain, []Rule) {
-	var chains []Chain
-	var rules []Rule
-
-	scanner := bufio.NewScanner(strings.NewReader(dump))
-	inTable := false
-	ruleIndex := make(map[string]int) // chain -> num 累加
+func parseTable(dump string, table string) ([]Chain, []Rule, error) {
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	t := rs.Table(table)
+	if t == nil {
+		return nil, nil, nil
+	}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasPrefix(line, "*") {
-			cur := strings.TrimPrefix(line, "*")
-			inTable = (cur == table)
-			continue
+	chains := make([]Chain, 0, len(t.Chains))
+	for _, c := range t.Chains {
+		ch := Chain{
+			Name:       c.Name,
+			Policy:     c.Policy,
+			Builtin:    c.Builtin(),
+			References: len(t.Jumps(c.Name)),
 		}
-		if !inTable {
-			continue
-		}
-		if line == "COMMIT" {
-			inTable = false
-			continue
+		if c.Counters != nil {
+			ch.Packets, ch.Bytes = c.Counters.Packets, c.Counters.Bytes
 		}
+		chains = append(chains, ch)
+	}
 
-		// 链定义: :INPUT ACCEPT [0:0]
-		if strings.HasPrefix(line, ":") {
-			rest := strings.TrimPrefix(line, ":")
-			parts := strings.Fields(rest)
-			if len(parts) == 0 {
-				continue
-			}
-			name := parts[0]
-			policy := "-"
-			if len(parts) > 1 {
-				policy = parts[1]
-			}
-			chains = append(chains, Chain{
-				Name:    name,
-				Policy:  policy,
-				Builtin: policy != "-",
-			})
-			continue
+	rules := make([]Rule, 0, len(t.Rules))
+	ids := t.RuleIDs()
+	ruleIndex := make(map[string]int) // chain -> num 累加
+	for _, r := range t.Rules {
+		ruleIndex[r.Chain]++
+		num := ruleIndex[r.Chain]
+
+		rule := Rule{
+			ID:      ids[r],
+			Num:     num,
+			Chain:   r.Chain,
+			Table:   table,
+			Family:  "", // 由上层填，或前端自己知道
+			Comment: r.Comment(),
+			Matches: matchesFromAST(r),
+			Target:  targetOptionsFromAST(r.Target),
+			Spec:    r.Spec(),
 		}
-
-		// 规则: -A INPUT -s 192.168... -j ACCEPT
-		if strings.HasPrefix(line, "-A ") {
-			rest := strings.TrimSpace(strings.TrimPrefix(line, "-A "))
-			parts := strings.Fields(rest)
-			if len(parts) == 0 {
-				continue
-			}
-			chain := parts[0]
-			spec := strings.TrimSpace(rest[len(chain):])
-
-			ruleIndex[chain]++
-			num := ruleIndex[chain]
-			comment := parseComment(spec)
-
-			protocol, sourceIP, sourcePort, destIP, destPort, action, iface, toPort, toSource, state := parseRuleSpec(spec)
-
-			rules = append(rules, Rule{
-				ID:         fmt.Sprintf("%s:%d", chain, num),
-				Num:        num,
-				Chain:      chain,
-				Table:      table,
-				Family:     "", // 由上层填，或前端自己知道
-				Protocol:   protocol,
-				SourceIP:   sourceIP,
-				SourcePort: sourcePort,
-				DestIP:     destIP,
-				DestPort:   destPort,
-				Action:     action,
-				State:      state,
-				Interface:  iface,
-				ToPort:     toPort,
-				ToSource:   toSource,
-				Comment:    comment,
-				Spec:       spec,
-			})
+		if r.Counters != nil {
+			rule.Packets, rule.Bytes = r.Counters.Packets, r.Counters.Bytes
 		}
+		ruleFields(&rule, r)
+		rules = append(rules, rule)
 	}
 
-	return chains, rules
+	return chains, rules, nil
 }
 
-func parseComment(spec string) string {
-	i := strings.Index(spec, "--comment")
-	if i < 0 {
-		return ""
-	}
-	s := strings.TrimSpace(spec[i+len("--comment"):])
-	if s == "" {
-		return ""
-	}
-	// 尝试解析 "xxx" / 'xxx'
-	if s[0] == '"' || s[0] == '\'' {
-		quote := s[0]
-		s = s[1:]
-		if j := strings.IndexByte(s, quote); j >= 0 {
-			return s[:j]
-		}
-		return s
-	}
-	// 退化：取下一个空格前
-	parts := strings.Fields(s)
-	if len(parts) > 0 {
-		return parts[0]
-	}
-	return ""
-}
+// ErrRuleNotFound：ruleId 在当前规则集中找不到（可能已被他人修改或删除）
+var ErrRuleNotFound = errors.New("rule not found")
 
-func parseRuleNum(id string) (int, error) {
-	// 允许 "3" 或 "INPUT:3" 两种形式
-	if n, err := strconv.Atoi(id); err == nil {
-		return n, nil
+// resolveRule：在链中按指纹 ID 定位规则，返回位置（1..N）和规则
+// 不接受 "NUM" / "CHAIN:NUM" 这类位置写法：规则集在读与写之间变动时会命中别的规则
+func resolveRule(t *iptables.Table, chain, id string) (int, *iptables.Rule, error) {
+	if !iptables.IsRuleID(id) {
+		return 0, nil, invalidf("invalid rule id %q, expected a fingerprint id from the rule list", id)
 	}
-	if i := strings.LastIndex(id, ":"); i >= 0 {
-		return strconv.Atoi(id[i+1:])
+	ids := t.RuleIDs()
+	for i, r := range t.ChainRules(chain) {
+		if ids[r] == id {
+			return i + 1, r, nil
+		}
 	}
-	return 0, fmt.Errorf("invalid rule id: %s", id)
+	return 0, nil, fmt.Errorf("%w: %s in chain %s", ErrRuleNotFound, id, chain)
 }
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// mustRuleset：解析 iptables-save 文本
+func mustRuleset(t *testing.T, text string) *iptables.Ruleset {
+	t.Helper()
+	rs, err := iptables.Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return rs
+}
+
+// filterTable：filter 表，INPUT 链依次为 rules
+func filterTable(t *testing.T, rules ...string) *iptables.Table {
+	t.Helper()
+	text := "*filter\n:INPUT ACCEPT [0:0]\n:FORWARD ACCEPT [0:0]\n:OUTPUT ACCEPT [0:0]\n"
+	for _, r := range rules {
+		text += "-A INPUT " + r + "\n"
+	}
+	return mustRuleset(t, text+"COMMIT\n").Table("filter")
+}
+
+// ruleID：链中第 n 条规则（从 1 开始）的 ruleId
+func ruleID(t *testing.T, tb *iptables.Table, chain string, n int) string {
+	t.Helper()
+	rules := tb.ChainRules(chain)
+	if n < 1 || n > len(rules) {
+		t.Fatalf("chain %s has %d rules, want #%d", chain, len(rules), n)
+	}
+	return tb.RuleIDs()[rules[n-1]]
+}
+
+// chainSpecs：链中各规则的参数，便于比较顺序
+func chainSpecs(tb *iptables.Table, chain string) []string {
+	var out []string
+	for _, r := range tb.ChainRules(chain) {
+		out = append(out, strings.Join(r.Args(), " "))
+	}
+	return out
+}
+
+func mustRuleArgs(t *testing.T, chain string, args ...string) *iptables.Rule {
+	t.Helper()
+	r, err := iptables.ParseRuleArgs(chain, args)
+	if err != nil {
+		t.Fatalf("ParseRuleArgs(%q): %v", args, err)
+	}
+	return r
+}
+
+func TestInsertPreview(t *testing.T) {
+	cases := []struct {
+		pos  int
+		want []string // nil 表示应当拒绝
+	}{
+		{0, []string{"-j A", "-j B", "-j NEW"}},
+		{1, []string{"-j NEW", "-j A", "-j B"}},
+		{2, []string{"-j A", "-j NEW", "-j B"}},
+		{3, []string{"-j A", "-j B", "-j NEW"}}, // iptables -I INPUT 3 等同于追加
+		{4, nil},
+		{99, nil},
+	}
+	for _, c := range cases {
+		rs := mustRuleset(t, "*filter\n:INPUT ACCEPT [0:0]\n:A - [0:0]\n:B - [0:0]\n:NEW - [0:0]\n-A INPUT -j A\n-A INPUT -j B\nCOMMIT\n")
+		err := insertPreview("filter", "INPUT", c.pos, []string{"-j", "NEW"})(rs)
+		if c.want == nil {
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("pos %d: err = %v, want ErrInvalidInput", c.pos, err)
+			}
+			continue
+		}
+		if got := chainSpecs(rs.Table("filter"), "INPUT"); err != nil || !slices.Equal(got, c.want) {
+			t.Errorf("pos %d: %q, %v, want %q", c.pos, got, err, c.want)
+		}
+	}
+}
+
+func TestReplaceRule(t *testing.T) {
+	rules := []string{"-s 10.0.0.1/32 -j ACCEPT", "-s 10.0.0.2/32 -j ACCEPT", "-s 10.0.0.3/32 -j ACCEPT"}
+	next := []string{"-s", "10.0.0.9/32", "-j", "DROP"}
+	cases := []struct {
+		name string
+		n    int // 被替换的是第几条
+		pos  int
+		want []string
+		err  error
+	}{
+		{"in place", 2, 0, []string{"-s 10.0.0.1/32 -j ACCEPT", "-s 10.0.0.9/32 -j DROP", "-s 10.0.0.3/32 -j ACCEPT"}, nil},
+		{"same position", 2, 2, []string{"-s 10.0.0.1/32 -j ACCEPT", "-s 10.0.0.9/32 -j DROP", "-s 10.0.0.3/32 -j ACCEPT"}, nil},
+		{"to top", 3, 1, []string{"-s 10.0.0.9/32 -j DROP", "-s 10.0.0.1/32 -j ACCEPT", "-s 10.0.0.2/32 -j ACCEPT"}, nil},
+		{"to end", 1, 3, []string{"-s 10.0.0.2/32 -j ACCEPT", "-s 10.0.0.3/32 -j ACCEPT", "-s 10.0.0.9/32 -j DROP"}, nil},
+		{"out of range", 1, 4, nil, ErrInvalidInput},
+		{"far out of range", 1, 40, nil, ErrInvalidInput},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tb := filterTable(t, rules...)
+			err := replaceRule("INPUT", ruleID(t, tb, "INPUT", c.n), mustRuleArgs(t, "INPUT", next...), c.pos)(tb)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("err = %v, want %v", err, c.err)
+				}
+				return
+			}
+			if got := chainSpecs(tb, "INPUT"); err != nil || !slices.Equal(got, c.want) {
+				t.Errorf("got %q, %v, want %q", got, err, c.want)
+			}
+		})
+	}
+
+	tb := filterTable(t, rules...)
+	if err := replaceRule("INPUT", "0123456789abcdef-0", mustRuleArgs(t, "INPUT", next...), 0)(tb); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("unknown id: err = %v, want ErrRuleNotFound", err)
+	}
+	if err := replaceRule("INPUT", "INPUT:1", mustRuleArgs(t, "INPUT", next...), 0)(tb); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("positional id: err = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestDeleteRuleDuplicates(t *testing.T) {
+	// 第 1、3 条完全相同："-D CHAIN <spec>" 只会删掉第 1 条
+	rules := []string{"-p tcp -j ACCEPT", "-s 10.0.0.1/32 -j DROP", "-p tcp -j ACCEPT"}
+	for n := 1; n <= len(rules); n++ {
+		tb := filterTable(t, rules...)
+		id := ruleID(t, tb, "INPUT", n)
+		target := tb.ChainRules("INPUT")[n-1]
+
+		// DeleteRule 传给 "-D CHAIN NUM" 的位置
+		num, r, err := resolveRule(tb, "INPUT", id)
+		if err != nil || num != n || r != target {
+			t.Fatalf("resolveRule(#%d) = %d, %p, %v; want %d, %p", n, num, r, err, n, target)
+		}
+		if err := deleteRule("INPUT", id)(tb); err != nil {
+			t.Fatalf("deleteRule(#%d): %v", n, err)
+		}
+		if slices.Contains(tb.ChainRules("INPUT"), target) {
+			t.Errorf("deleteRule(#%d) removed a different occurrence", n)
+		}
+		if got := len(tb.ChainRules("INPUT")); got != len(rules)-1 {
+			t.Errorf("deleteRule(#%d) left %d rules", n, got)
+		}
+	}
+}
+
+func TestNATDest(t *testing.T) {
+	cases := []struct {
+		dest, addr, port string
+	}{
+		{"10.0.0.2", "10.0.0.2", ""},
+		{"10.0.0.2:22", "10.0.0.2", "22"},
+		{"10.0.0.2-10.0.0.9:1000-2000", "10.0.0.2-10.0.0.9", "1000-2000"},
+		{":8080", "", "8080"},
+		{"fd00::2", "fd00::2", ""},
+		{"[fd00::2]:22", "fd00::2", "22"},
+		{"[fd00::2-fd00::9]:1000-2000", "fd00::2-fd00::9", "1000-2000"},
+	}
+	for _, c := range cases {
+		addr, port := splitNATDest(c.dest)
+		if addr != c.addr || port != c.port {
+			t.Errorf("splitNATDest(%q) = %q, %q, want %q, %q", c.dest, addr, port, c.addr, c.port)
+		}
+		if got := joinNATDest(addr, port); got != c.dest {
+			t.Errorf("joinNATDest(%q, %q) = %q, want %q", addr, port, got, c.dest)
+		}
+	}
+}
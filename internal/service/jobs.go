@@ -0,0 +1,450 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"iptables-web/backend/internal/iptables"
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// 作业支持的操作（与 /api/rules/* 一一对应）
+const (
+	JobOpSave    = "save"    // iptables-save
+	JobOpRestore = "restore" // iptables-restore
+	JobOpAppend  = "append"  // -A
+	JobOpInsert  = "insert"  // -I
+	JobOpDelete  = "delete"  // -D CHAIN NUM
+	JobOpFlush   = "flush"   // -F
+	JobOpZero    = "zero"    // -Z
+)
+
+// 多台主机结果不一致（部分成功部分失败）时作业的状态
+const JobPartial sshx.TaskStatus = "PARTIAL"
+
+type JobInput struct {
+	HostIDs []uint
+	Op      string
+	V6      bool
+	Table   string
+	Chain   string
+	Rule    string
+	Pos     int
+	Num     int
+	Content string // restore 的内容
+
+	Retry   sshx.RetryPolicy
+	Timeout time.Duration
+
+	Author       string // 记入修改前快照的操作者
+	AllowLockout bool   // 防锁死模拟显示有风险时仍然执行（见 WriteOptions.AllowLockout）
+
+	// 修改类作业：各主机读到的版本号（相当于逐台的 If-Match），缺少时拒绝提交；
+	// Force 时不校验，可能覆盖其他人的并发修改
+	Revisions map[uint]string
+	Force     bool
+}
+
+// Job：一次提交 = 每台主机一个 Task，共享 JobID
+type Job struct {
+	ID        string
+	Op        string
+	Status    sshx.TaskStatus
+	CreatedAt time.Time
+	EndedAt   time.Time
+	Tasks     []*sshx.Task
+}
+
+type JobsService struct {
+	hosts *repo.HostRepo
+	store sshx.TaskStore
+	pool  *sshx.ExecutorPool
+	meta  sync.Map // jobID -> *jobMeta
+}
+
+// jobMeta：修改类作业提交时的信息，执行任务时走 guardedWrite 用；只在进程内，重启后未执行的任务本就不会再执行
+type jobMeta struct {
+	author       string
+	v6           bool
+	allowLockout bool
+	revisions    map[uint]string
+	force        bool
+	preview      func(rs *iptables.Ruleset) error
+	left         atomic.Int32 // 尚未结束的任务数，归零后删除
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   *JobsService
+)
+
+// StartJobs：启动进程级作业执行器；重复调用返回同一个实例
+func StartJobs(workers int, store sshx.TaskStore) *JobsService {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if jobs != nil {
+		return jobs
+	}
+	if store == nil {
+		store = sshx.NewMemoryTaskStore()
+	}
+	p := sshx.NewExecutorPool(workers, store, sshx.Hooks{})
+	jobs = &JobsService{hosts: repo.NewHostRepo(), store: store, pool: p}
+	p.Hooks.OnExec = jobs.guardTask
+	p.Hooks.OnTask = jobs.taskEnded
+	p.Start()
+	return jobs
+}
+
+// guardTask：修改类任务与同步写接口一样经 guardedWrite 执行：主机锁、待确认变更检查、防锁死检查、修改前快照
+// If-Match 取提交时该主机的版本号（Force 时不校验）；检查不通过时不执行，任务直接失败（不重试）
+func (s *JobsService) guardTask(t sshx.Task, run func() sshx.Result) sshx.Result {
+	v, ok := s.meta.Load(t.JobID)
+	if !ok {
+		return run()
+	}
+	m := v.(*jobMeta)
+	opt := WriteOptions{
+		IfMatch:      hostIfMatch(m.revisions, m.force, t.Host.ID),
+		AllowLockout: m.allowLockout,
+		Author:       m.author,
+		Reason:       fmt.Sprintf("job %s (%s)", t.JobID, t.Op),
+	}
+	var res sshx.Result
+	ran := false
+	_, err := guardedWrite(sshx.Get(t.Host), t.Host.ID, m.v6, opt, m.preview, func() error {
+		ran = true
+		res = run()
+		return res.Err
+	})
+	if !ran && err != nil {
+		return sshx.Result{HostIP: t.Host.IP, Err: err, Code: 1, Stderr: err.Error()}
+	}
+	return res
+}
+
+// taskEnded：任务结束（含未执行即取消）后清理 jobMeta
+func (s *JobsService) taskEnded(t sshx.Task) {
+	switch t.Status {
+	case sshx.TaskSucceeded, sshx.TaskFailed, sshx.TaskCanceled:
+	default:
+		return
+	}
+	v, ok := s.meta.Load(t.JobID)
+	if !ok {
+		return
+	}
+	if v.(*jobMeta).left.Add(-1) <= 0 {
+		s.meta.Delete(t.JobID)
+	}
+}
+
+// Jobs：未显式 StartJobs 时按默认配置启动
+func Jobs() *JobsService { return StartJobs(0, nil) }
+
+// Submit：校验参数、为每台主机生成任务后立即返回，执行在后台进行
+func (s *JobsService) Submit(in JobInput) (*Job, error) {
+	if len(in.HostIDs) == 0 {
+		return nil, errors.New("host_ids required")
+	}
+	cmd, err := jobCommand(in)
+	if err != nil {
+		return nil, err
+	}
+	if in.Op != JobOpSave {
+		if err := checkHostRevisions(in.Revisions, in.Force, in.HostIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	hs := make([]models.Host, 0, len(in.HostIDs))
+	seen := map[uint]bool{}
+	for _, id := range in.HostIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		h, err := s.hosts.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("host %d: %w", id, err)
+		}
+		h.Normalize()
+		hs = append(hs, *h)
+	}
+
+	jobID := newJobID()
+	now := time.Now()
+	tasks := make([]*sshx.Task, 0, len(hs))
+	for i, h := range hs {
+		t := &sshx.Task{
+			ID:        taskID(jobID, i+1, len(hs)),
+			JobID:     jobID,
+			Op:        in.Op,
+			Host:      h,
+			Command:   cmd,
+			Status:    sshx.TaskPending,
+			CreatedAt: now,
+		}
+		in.Retry.Apply(t)
+		if err := s.store.Save(t); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+
+	if in.Op != JobOpSave {
+		m := &jobMeta{
+			author: in.Author, v6: in.V6, allowLockout: in.AllowLockout,
+			revisions: in.Revisions, force: in.Force, preview: jobPreview(in),
+		}
+		m.left.Store(int32(len(tasks)))
+		s.meta.Store(jobID, m)
+	}
+	// 队列满时 Submit 会阻塞，不占用请求协程
+	go func() {
+		for _, t := range tasks {
+			s.pool.Submit(t)
+		}
+	}()
+	return s.Get(jobID)
+}
+
+func (s *JobsService) Get(id string) (*Job, error) {
+	ts, err := s.store.Query(sshx.TaskFilter{JobIDs: []string{id}})
+	if err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, ErrJobNotFound
+	}
+	return buildJob(id, ts), nil
+}
+
+// List：先按条件筛出任务，再取这些任务所属作业的全部任务（作业状态按整体汇总）；按创建时间倒序
+func (s *JobsService) List(f sshx.TaskFilter) ([]*Job, error) {
+	limit := f.Limit
+	f.Limit = 0
+	matched, err := s.store.Query(f)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, t := range matched {
+		if t.JobID == "" || seen[t.JobID] {
+			continue
+		}
+		seen[t.JobID] = true
+		ids = append(ids, t.JobID)
+		if limit > 0 && len(ids) >= limit {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return []*Job{}, nil
+	}
+	all, err := s.store.Query(sshx.TaskFilter{JobIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	byJob := map[string][]*sshx.Task{}
+	for _, t := range all {
+		byJob[t.JobID] = append(byJob[t.JobID], t)
+	}
+	out := make([]*Job, 0, len(byJob))
+	for id, ts := range byJob {
+		out = append(out, buildJob(id, ts))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID > out[j].ID
+		}
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+// Cancel：取消作业下所有未结束的任务
+func (s *JobsService) Cancel(id string) (*Job, error) {
+	j, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, t := range j.Tasks {
+		if t.Status == sshx.TaskPending || t.Status == sshx.TaskRunning {
+			if s.pool.Cancel(t.ID) {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return nil, ErrJobFinished
+	}
+	return s.Get(id)
+}
+
+// jobPreview：修改类作业在 AST 上的等价修改，用于防锁死模拟（参数已由 jobCommand 校验）
+func jobPreview(in JobInput) func(rs *iptables.Ruleset) error {
+	table, chain := strings.TrimSpace(in.Table), strings.TrimSpace(in.Chain)
+	switch in.Op {
+	case JobOpRestore:
+		return func(rs *iptables.Ruleset) error {
+			_, err := importPreview(rs, in.Content)
+			return err
+		}
+	case JobOpAppend, JobOpInsert:
+		args, err := ruleOpArgs(table, chain, strings.TrimSpace(in.Rule))
+		if err != nil {
+			return cannotSimulate
+		}
+		pos := 0
+		if in.Op == JobOpInsert {
+			pos = in.Pos
+		}
+		return insertPreview(table, chain, pos, args)
+	case JobOpDelete:
+		return deletePreview(table, chain, in.Num)
+	case JobOpFlush:
+		return flushPreview(table, chain)
+	case JobOpZero:
+		return noRuleChange
+	}
+	return nil
+}
+
+// jobCommand：与 RulesOpsService / Client.Iptables 拼出的命令保持一致（argv 逐个转义）
+func jobCommand(in JobInput) (sshx.Command, error) {
+	bin, save, restore := "iptables", "iptables-save", "iptables-restore"
+	if in.V6 {
+		bin, save, restore = "ip6tables", "ip6tables-save", "ip6tables-restore"
+	}
+	table := strings.TrimSpace(in.Table)
+	chain := strings.TrimSpace(in.Chain)
+	rule := strings.TrimSpace(in.Rule)
+
+	cmd := sshx.Command{Shell: true, Timeout: in.Timeout}
+	ipt := func(args ...string) {
+		cmd.Args = append([]string{bin, "-t", table}, args...)
+		cmd.Raw = sshx.ShellJoin(cmd.Args)
+	}
+	switch in.Op {
+	case JobOpSave:
+		cmd.Raw = save
+	case JobOpRestore:
+		if strings.TrimSpace(in.Content) == "" {
+			return cmd, errors.New("content required")
+		}
+		cmd.Raw = restore
+		cmd.Stdin = in.Content
+	case JobOpAppend:
+		if table == "" || chain == "" || rule == "" {
+			return cmd, errors.New("table, chain, rule required")
+		}
+		args, err := ruleOpArgs(table, chain, rule)
+		if err != nil {
+			return cmd, err
+		}
+		ipt(append([]string{"-A", chain}, args...)...)
+	case JobOpInsert:
+		if table == "" || chain == "" || in.Pos <= 0 || rule == "" {
+			return cmd, errors.New("table, chain, pos, rule required")
+		}
+		args, err := ruleOpArgs(table, chain, rule)
+		if err != nil {
+			return cmd, err
+		}
+		ipt(append([]string{"-I", chain, fmt.Sprint(in.Pos)}, args...)...)
+	case JobOpDelete:
+		if table == "" || chain == "" || in.Num <= 0 {
+			return cmd, errors.New("table, chain, num required")
+		}
+		if err := validateTableChain(table, chain); err != nil {
+			return cmd, err
+		}
+		ipt("-D", chain, fmt.Sprint(in.Num))
+	case JobOpFlush, JobOpZero:
+		if table == "" {
+			return cmd, errors.New("table required")
+		}
+		if err := validateTableChain(table, chain); err != nil {
+			return cmd, err
+		}
+		flag := "-F"
+		if in.Op == JobOpZero {
+			flag = "-Z"
+		}
+		if chain == "" {
+			ipt(flag)
+		} else {
+			ipt(flag, chain)
+		}
+	default:
+		return cmd, fmt.Errorf("unsupported op %q", in.Op)
+	}
+	return cmd, nil
+}
+
+func buildJob(id string, ts []*sshx.Task) *Job {
+	sort.Slice(ts, func(i, j int) bool { return ts[i].ID < ts[j].ID })
+	j := &Job{ID: id, Op: ts[0].Op, CreatedAt: ts[0].CreatedAt, Tasks: ts}
+
+	count := map[sshx.TaskStatus]int{}
+	for _, t := range ts {
+		count[t.Status]++
+		if t.CreatedAt.Before(j.CreatedAt) {
+			j.CreatedAt = t.CreatedAt
+		}
+		if t.EndedAt.After(j.EndedAt) {
+			j.EndedAt = t.EndedAt
+		}
+	}
+	switch {
+	case count[sshx.TaskPending] == len(ts):
+		j.Status = sshx.TaskPending
+	case count[sshx.TaskPending]+count[sshx.TaskRunning] > 0:
+		j.Status = sshx.TaskRunning
+	case count[sshx.TaskSucceeded] == len(ts):
+		j.Status = sshx.TaskSucceeded
+	case count[sshx.TaskCanceled] == len(ts):
+		j.Status = sshx.TaskCanceled
+	case count[sshx.TaskSucceeded] > 0:
+		j.Status = JobPartial
+	case count[sshx.TaskFailed] > 0:
+		j.Status = sshx.TaskFailed
+	default:
+		j.Status = sshx.TaskCanceled
+	}
+	if j.Status == sshx.TaskPending || j.Status == sshx.TaskRunning {
+		j.EndedAt = time.Time{}
+	}
+	return j
+}
+
+// taskID：作业内第 i 个（共 n 个）任务的 ID；序号按 n 定宽（至少 3 位），字典序即提交顺序
+func taskID(jobID string, i, n int) string {
+	return fmt.Sprintf("%s-%0*d", jobID, max(3, len(strconv.Itoa(n))), i)
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
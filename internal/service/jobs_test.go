@@ -0,0 +1,33 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTaskID(t *testing.T) {
+	cases := []struct {
+		i, n int
+		want string
+	}{
+		{1, 1, "j-001"},
+		{42, 999, "j-042"},
+		{1, 1000, "j-0001"},
+		{1000, 1000, "j-1000"},
+		{7, 12345, "j-00007"},
+	}
+	for _, c := range cases {
+		if got := taskID("j", c.i, c.n); got != c.want {
+			t.Errorf("taskID(j, %d, %d) = %q, want %q", c.i, c.n, got, c.want)
+		}
+	}
+
+	// 字典序与提交顺序一致
+	var ids []string
+	for i := 1; i <= 1200; i++ {
+		ids = append(ids, taskID("j", i, 1200))
+	}
+	if !slices.IsSorted(ids) {
+		t.Error("task IDs of a 1200-host job do not sort in submission order")
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+// 防锁死：写入前用修改后的规则集模拟本服务自己的 SSH 连接（NEW 与 ESTABLISHED 两种包）发往本机时
+// 依次经过的 raw/mangle/nat PREROUTING、mangle/filter/security INPUT；会被丢弃时拒绝写入，除非 WriteOptions.AllowLockout
+// 模拟不了的部分（recent / set / limit 等 match、DNAT 等 target、本地解析不了的导入内容）按“无法判断”处理，
+// 由“确定放行”变成“无法判断”同样视为有风险
+
+// ErrLockoutRisk：修改可能切断本服务自己的 SSH 连接，需要 allowLockout 才能写入
+var ErrLockoutRisk = errors.New("change may lock out the management SSH connection")
+
+// protectComment：自动插入的保护规则的注释，用来识别已有的保护规则
+const protectComment = "iptables-web: management ssh"
+
+// LockoutCheck：模拟结果
+type LockoutCheck struct {
+	ClientIP  string          `json:"clientIp,omitempty"` // 目标机看到的本服务地址；空表示未取到
+	Port      int             `json:"port"`
+	Iface     string          `json:"iface,omitempty"`
+	Current   LockoutVerdicts `json:"current"`
+	Proposed  LockoutVerdicts `json:"proposed"`
+	Protected bool            `json:"protected,omitempty"` // 已插入保护规则（dry-run 时表示实际导入会插入）
+	Blocked   bool            `json:"blocked"`             // 会切断（或可能切断）管理连接
+}
+
+type LockoutVerdicts struct {
+	New         iptables.Verdict `json:"new"`         // 新建连接（重连、确认接口用的新连接）
+	Established iptables.Verdict `json:"established"` // 当前会话
+}
+
+// inputPath：发往本机的包依次经过的内置链；nat 只对连接的第一个包（NEW）生效
+var inputPath = []struct {
+	table, chain string
+	newOnly      bool
+}{
+	{"raw", "PREROUTING", false},
+	{"mangle", "PREROUTING", false},
+	{"nat", "PREROUTING", true},
+	{"mangle", "INPUT", false},
+	{"filter", "INPUT", false},
+	{"security", "INPUT", false},
+}
+
+// lockoutGuard：一次写入的防锁死检查
+type lockoutGuard struct {
+	peer   sshx.Peer
+	port   int
+	cur    LockoutVerdicts
+	before map[string][]string // 修改前各表的规范化内容，用来判断这次修改动了哪些表
+}
+
+// newLockoutGuard：在修改之前调用，记下当前规则集的模拟结果
+// 管理连接与 v6 不是同一协议族时返回 nil（这次修改影响不到它）
+func newLockoutGuard(cli rulesetHost, hostID uint, v6 bool, rs *iptables.Ruleset) *lockoutGuard {
+	peer, err := cli.ManagementPeer(context.Background())
+	if err != nil {
+		log.Printf("[lockout] host %d: %v, simulating with an unknown source", hostID, err)
+	}
+	return lockoutGuardFor(peer, cli.SSHPort(), v6, rs)
+}
+
+// lockoutGuardFor：取不到对端地址时两个协议族都按未知来源模拟，涉及 -s 的规则结果为 UNKNOWN，
+// 且修改后不是确定放行就视为有风险（见 check），不会因为地址未知而跳过检查
+func lockoutGuardFor(peer sshx.Peer, port int, v6 bool, rs *iptables.Ruleset) *lockoutGuard {
+	g := &lockoutGuard{peer: peer, port: port}
+	if g.port == 0 {
+		g.port = 22
+	}
+	if ip := net.ParseIP(peer.ClientIP); ip == nil {
+		g.peer = sshx.Peer{}
+	} else if (ip.To4() == nil) != v6 {
+		return nil
+	}
+	g.before = pathLines(rs)
+	g.cur = g.simulate(rs)
+	return g
+}
+
+// pathLines：inputPath 涉及的各表的规范化内容
+func pathLines(rs *iptables.Ruleset) map[string][]string {
+	m := map[string][]string{}
+	for _, h := range inputPath {
+		if t := rs.Table(h.table); t != nil {
+			m[h.table] = t.NormalizedLines()
+		}
+	}
+	return m
+}
+
+func (g *lockoutGuard) packet(state string) iptables.Packet {
+	return iptables.Packet{
+		Src:     net.ParseIP(g.peer.ClientIP),
+		Dst:     net.ParseIP(g.peer.ServerIP),
+		DPort:   g.port,
+		InIface: g.peer.Iface,
+		State:   state,
+	}
+}
+
+func (g *lockoutGuard) simulate(rs *iptables.Ruleset) LockoutVerdicts {
+	return LockoutVerdicts{New: g.verdict(rs, "NEW"), Established: g.verdict(rs, "ESTABLISHED")}
+}
+
+// verdict：任一链确定丢弃即丢弃；否则有一条无法判断即无法判断；没有的表 / 链视为放行
+func (g *lockoutGuard) verdict(rs *iptables.Ruleset, state string) iptables.Verdict {
+	v := iptables.VerdictAccept
+	for _, h := range inputPath {
+		if h.newOnly && state != "NEW" {
+			continue
+		}
+		t := rs.Table(h.table)
+		if t == nil || t.Chain(h.chain) == nil {
+			continue
+		}
+		switch t.Simulate(h.chain, g.packet(state)) {
+		case iptables.VerdictDrop:
+			return iptables.VerdictDrop
+		case iptables.VerdictUnknown:
+			v = iptables.VerdictUnknown
+		}
+	}
+	return v
+}
+
+// check：对修改后的规则集做模拟；这次修改动了 filter 表且 protect 时，先在 filter/INPUT 顶部补上保护规则
+// （保护规则挡不住 raw / mangle 等表里的丢弃）
+// 确定会丢弃，或由“确定放行”变成“无法判断”时视为有锁死风险；g 为 nil 时返回 nil
+func (g *lockoutGuard) check(rs *iptables.Ruleset, protect bool) *LockoutCheck {
+	if g == nil {
+		return nil
+	}
+	res := &LockoutCheck{ClientIP: g.peer.ClientIP, Port: g.port, Iface: g.peer.Iface, Current: g.cur}
+	after := pathLines(rs)
+	if maps.EqualFunc(after, g.before, slices.Equal[[]string]) {
+		res.Proposed = g.cur
+		return res
+	}
+	if t := rs.Table("filter"); protect && t != nil && !slices.Equal(after["filter"], g.before["filter"]) {
+		res.Protected = g.protect(t)
+	}
+	res.Proposed = g.simulate(rs)
+	known := g.peer.ClientIP != ""
+	res.Blocked = risky(known, g.cur.New, res.Proposed.New) || risky(known, g.cur.Established, res.Proposed.Established)
+	return res
+}
+
+// risky：来源地址未知时，修改后的结果不是确定放行就有风险（原本的 UNKNOWN 也可能正是本服务的地址）
+func risky(known bool, cur, next iptables.Verdict) bool {
+	if !known {
+		return next != iptables.VerdictAccept
+	}
+	return next == iptables.VerdictDrop || (next == iptables.VerdictUnknown && cur == iptables.VerdictAccept)
+}
+
+// err：有风险时的错误，列出模拟结果
+func (c *LockoutCheck) err() error {
+	if c == nil || !c.Blocked {
+		return nil
+	}
+	src := c.ClientIP
+	if src == "" {
+		src = "unknown source"
+	}
+	return fmt.Errorf("%w: tcp %s -> port %d would be NEW=%s ESTABLISHED=%s after this change (currently NEW=%s ESTABLISHED=%s); pass allowLockout to override or protectSsh to keep an allow rule",
+		ErrLockoutRisk, src, c.Port, c.Proposed.New, c.Proposed.Established, c.Current.New, c.Current.Established)
+}
+
+// protect：在 filter/INPUT 顶部插入放行本服务 SSH 的规则；已存在时不重复插入
+func (g *lockoutGuard) protect(t *iptables.Table) bool {
+	if net.ParseIP(g.peer.ClientIP) == nil {
+		return false // 不知道来源地址就不插入（不能放行任意来源）
+	}
+	for _, r := range t.ChainRules("INPUT") {
+		if r.Comment() == protectComment {
+			return true
+		}
+	}
+	if t.Chain("INPUT") == nil {
+		t.Chains = append(t.Chains, &iptables.Chain{Name: "INPUT", Policy: "ACCEPT"})
+	}
+	r, err := iptables.ParseRuleArgs("INPUT", protectRuleArgs(g.peer.ClientIP, g.port))
+	if err != nil {
+		return false
+	}
+	t.InsertRule(r, 1)
+	return true
+}
+
+func protectRuleArgs(clientIP string, port int) []string {
+	src := clientIP + "/32"
+	if strings.Contains(clientIP, ":") {
+		src = clientIP + "/128"
+	}
+	return []string{"-s", src, "-p", "tcp", "-m", "tcp", "--dport", strconv.Itoa(port),
+		"-m", "comment", "--comment", protectComment, "-j", "ACCEPT"}
+}
+
+// tablePreview：把单表的 preview 包成整个规则集的 preview（表不存在时按 restore 的行为新建）
+func tablePreview(table string, fn func(t *iptables.Table) error) func(rs *iptables.Ruleset) error {
+	return func(rs *iptables.Ruleset) error {
+		t := rs.Table(table)
+		if t == nil {
+			t = &iptables.Table{Name: table}
+			rs.Tables = append(rs.Tables, t)
+		}
+		return fn(t)
+	}
+}
+
+// noRuleChange：只改计数器等不影响模拟结果的修改
+func noRuleChange(*iptables.Ruleset) error { return nil }
+
+// cannotSimulate：没有 preview 的修改
+func cannotSimulate(*iptables.Ruleset) error {
+	return fmt.Errorf("%w: this change cannot be simulated", ErrLockoutRisk)
+}
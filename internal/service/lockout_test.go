@@ -0,0 +1,166 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"iptables-web/backend/internal/iptables"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+var (
+	peerV4 = sshx.Peer{ClientIP: "203.0.113.7", ServerIP: "10.0.0.1", Iface: "eth0"}
+	peerV6 = sshx.Peer{ClientIP: "2001:db8::7", ServerIP: "2001:db8::1", Iface: "eth0"}
+)
+
+const (
+	stateful = "-m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT"
+	allowSSH = "-p tcp -m tcp --dport 22 -j ACCEPT"
+)
+
+// inputRuleset：filter/INPUT 的默认策略为 policy，规则为 rules
+func inputRuleset(t *testing.T, policy string, rules ...string) *iptables.Ruleset {
+	t.Helper()
+	text := "*filter\n:INPUT " + policy + " [0:0]\n:FORWARD ACCEPT [0:0]\n:OUTPUT ACCEPT [0:0]\n"
+	for _, r := range rules {
+		text += "-A INPUT " + r + "\n"
+	}
+	return mustRuleset(t, text+"COMMIT\n")
+}
+
+func TestLockoutGuard(t *testing.T) {
+	cases := []struct {
+		name    string
+		peer    sshx.Peer
+		v6      bool
+		rules   []string // 修改前 INPUT（默认策略 ACCEPT）
+		policy  string   // 修改后的 INPUT 默认策略；空表示不变
+		insert  []string // 修改时插到 INPUT 顶部的规则
+		nilG    bool     // 管理连接属于另一协议族，不检查
+		blocked bool
+	}{
+		{name: "v4 drop policy", peer: peerV4, policy: "DROP", blocked: true},
+		{name: "v4 drop policy with ssh allowed", peer: peerV4, rules: []string{stateful, allowSSH}, policy: "DROP"},
+		{name: "v4 drop own source", peer: peerV4, insert: []string{"-s", "203.0.113.7/32", "-j", "DROP"}, blocked: true},
+		{name: "v4 drop other source", peer: peerV4, insert: []string{"-s", "198.51.100.0/24", "-j", "DROP"}},
+		{name: "v4 peer, v6 write", peer: peerV4, v6: true, nilG: true},
+		{name: "v6 peer, v4 write", peer: peerV6, nilG: true},
+		{name: "v6 drop policy", peer: peerV6, v6: true, policy: "DROP", blocked: true},
+		{name: "v6 drop own source", peer: peerV6, v6: true, insert: []string{"-s", "2001:db8::/64", "-j", "DROP"}, blocked: true},
+		{name: "v6 drop other source", peer: peerV6, v6: true, insert: []string{"-s", "2001:db8:1::/48", "-j", "DROP"}},
+
+		// 取不到对端地址：两个协议族都检查，修改后不是确定放行就有风险
+		{name: "unknown peer, v4 source rule", insert: []string{"-s", "198.51.100.0/24", "-j", "DROP"}, blocked: true},
+		{name: "unknown peer, v6 source rule", v6: true, insert: []string{"-s", "2001:db8:1::/48", "-j", "DROP"}, blocked: true},
+		{name: "unknown peer, v6 drop policy", v6: true, policy: "DROP", blocked: true},
+		{name: "unknown peer, v6 other port", v6: true, insert: []string{"-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "DROP"}},
+		{name: "unparsable peer, v6 drop policy", peer: sshx.Peer{ClientIP: "bogus"}, v6: true, policy: "DROP", blocked: true},
+		{name: "unknown peer, no path change", v6: true, rules: []string{"-s 2001:db8::/32 -j DROP"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rs := inputRuleset(t, "ACCEPT", c.rules...)
+			g := lockoutGuardFor(c.peer, 22, c.v6, rs)
+			if c.nilG {
+				if g != nil {
+					t.Fatal("want no guard for the other family")
+				}
+				return
+			}
+			if g == nil {
+				t.Fatal("guard is nil")
+			}
+			ft := rs.Table("filter")
+			if c.policy != "" {
+				ft.Chain("INPUT").Policy = c.policy
+			}
+			if c.insert != nil {
+				ft.InsertRule(mustRuleArgs(t, "INPUT", c.insert...), 1)
+			}
+			lc := g.check(rs, false)
+			if lc.Blocked != c.blocked {
+				t.Errorf("blocked = %v, want %v (current %+v, proposed %+v)", lc.Blocked, c.blocked, lc.Current, lc.Proposed)
+			}
+			if (lc.err() != nil) != c.blocked {
+				t.Errorf("err = %v, want blocked=%v", lc.err(), c.blocked)
+			}
+		})
+	}
+}
+
+func TestLockoutProtect(t *testing.T) {
+	cases := []struct {
+		name      string
+		peer      sshx.Peer
+		v6        bool
+		rules     []string
+		protected bool
+		blocked   bool
+		wantTop   string // 修改后 INPUT 第一条规则
+	}{
+		{name: "v4", peer: peerV4, protected: true,
+			wantTop: "-s 203.0.113.7/32 -p tcp -m tcp --dport 2222 -m comment --comment iptables-web: management ssh -j ACCEPT"},
+		{name: "v6", peer: peerV6, v6: true, protected: true,
+			wantTop: "-s 2001:db8::7/128 -p tcp -m tcp --dport 2222 -m comment --comment iptables-web: management ssh -j ACCEPT"},
+		{name: "already present", peer: peerV4, protected: true,
+			rules:   []string{`-s 203.0.113.7/32 -p tcp -m tcp --dport 2222 -m comment --comment "iptables-web: management ssh" -j ACCEPT`},
+			wantTop: "-s 203.0.113.7/32 -p tcp -m tcp --dport 2222 -m comment --comment iptables-web: management ssh -j ACCEPT"},
+		// 不知道来源地址时不能放行任意来源，只能拒绝
+		{name: "unknown peer", v6: true, blocked: true, wantTop: "-j DROP"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rs := inputRuleset(t, "ACCEPT", c.rules...)
+			g := lockoutGuardFor(c.peer, 2222, c.v6, rs)
+			ft := rs.Table("filter")
+			ft.InsertRule(mustRuleArgs(t, "INPUT", "-j", "DROP"), 0)
+			lc := g.check(rs, true)
+			if lc.Protected != c.protected || lc.Blocked != c.blocked {
+				t.Errorf("protected, blocked = %v, %v, want %v, %v (proposed %+v)", lc.Protected, lc.Blocked, c.protected, c.blocked, lc.Proposed)
+			}
+			specs := chainSpecs(ft, "INPUT")
+			if specs[0] != c.wantTop {
+				t.Errorf("INPUT[0] = %q, want %q", specs[0], c.wantTop)
+			}
+			if n := len(slices.DeleteFunc(specs, func(s string) bool { return s != c.wantTop })); c.protected && n != 1 {
+				t.Errorf("protect rule present %d times, want once", n)
+			}
+		})
+	}
+
+	// 没有改动 filter 表时不插入保护规则
+	rs := inputRuleset(t, "ACCEPT")
+	g := lockoutGuardFor(peerV4, 22, false, rs)
+	if lc := g.check(rs, true); lc.Protected || len(rs.Table("filter").ChainRules("INPUT")) != 0 {
+		t.Errorf("protect rule inserted without a filter change: %+v", lc)
+	}
+}
+
+func TestRisky(t *testing.T) {
+	const (
+		A = iptables.VerdictAccept
+		D = iptables.VerdictDrop
+		U = iptables.VerdictUnknown
+	)
+	cases := []struct {
+		known     bool
+		cur, next iptables.Verdict
+		want      bool
+	}{
+		{true, A, A, false},
+		{true, A, D, true},
+		{true, A, U, true},
+		{true, U, U, false},
+		{true, U, D, true},
+		{true, D, A, false},
+		{false, A, A, false},
+		{false, U, U, true},
+		{false, U, A, false},
+		{false, A, D, true},
+	}
+	for _, c := range cases {
+		if got := risky(c.known, c.cur, c.next); got != c.want {
+			t.Errorf("risky(%v, %s, %s) = %v, want %v", c.known, c.cur, c.next, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"iptables-web/backend/internal/crypto"
+	"iptables-web/backend/internal/db"
+)
+
+// TestMain：用临时 SQLite 库和随机主密钥初始化，与 cmd/server 的启动顺序一致
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "service-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	if err := crypto.Init(base64.StdEncoding.EncodeToString(key)); err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Init(filepath.Join(dir, "test.db")); err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
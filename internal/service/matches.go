@@ -0,0 +1,273 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// MatchSpec：一个 -m 模块及其选项，与前端 types/iptables.ts 的 MatchSpec 对应
+type MatchSpec struct {
+	Module  string        `json:"module"`
+	Options []MatchOption `json:"options"`
+}
+
+type MatchOption struct {
+	Name   string   `json:"name"`             // 如 "--dports"
+	Values []string `json:"values,omitempty"` // 开关类选项（--syn / --rsource）为空
+	Negate bool     `json:"negate,omitempty"` // 前置 "!"
+}
+
+// matchOpt：白名单中一个选项的约束
+type matchOpt struct {
+	args   int               // 取值个数
+	negate bool              // 是否允许 "!"
+	valid  func(string) bool // 逐个校验取值；nil 表示开关类选项
+}
+
+type matchModule struct {
+	protocols []string // 非空时要求规则的 -p 为其中之一
+	options   map[string]matchOpt
+}
+
+var (
+	reUint      = regexp.MustCompile(`^\d{1,10}$`)
+	rePort      = regexp.MustCompile(`^\d{1,5}(:\d{1,5})?$`)
+	reMark      = regexp.MustCompile(`^(0x[0-9a-fA-F]{1,8}|\d{1,10})(/(0x[0-9a-fA-F]{1,8}|\d{1,10}))?$`)
+	reLimit     = regexp.MustCompile(`^\d{1,9}/(s(ec(ond)?)?|m(in(ute)?)?|h(our)?|d(ay)?)$`)
+	reName      = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,31}$`)
+	reOwner     = regexp.MustCompile(`^[A-Za-z0-9_.]{1,32}(-[A-Za-z0-9_.]{1,32})?$`)
+	reIface     = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,15}\+?$`)
+	reSetFlags  = regexp.MustCompile(`^(src|dst)(,(src|dst)){0,5}$`)
+	reTCPFlags  = regexp.MustCompile(`^(?i)(SYN|ACK|FIN|RST|URG|PSH|ALL|NONE)(,(SYN|ACK|FIN|RST|URG|PSH|ALL|NONE))*$`)
+	reRecentKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,200}$`)
+)
+
+func isPortList(v string) bool {
+	ps := strings.Split(v, ",")
+	if len(ps) > 15 {
+		return false
+	}
+	for _, p := range ps {
+		if !rePort.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIPRange(v string) bool {
+	a, b, ok := strings.Cut(v, "-")
+	return ok && net.ParseIP(a) != nil && net.ParseIP(b) != nil
+}
+
+func isIP(v string) bool { return net.ParseIP(v) != nil }
+
+var (
+	flag      = matchOpt{}
+	negFlag   = matchOpt{negate: true}
+	uintOpt   = matchOpt{args: 1, valid: reUint.MatchString}
+	portsOpt  = matchOpt{args: 1, negate: true, valid: isPortList}
+	portOpt   = matchOpt{args: 1, negate: true, valid: rePort.MatchString}
+	ifaceOpt  = matchOpt{args: 1, negate: true, valid: reIface.MatchString}
+	ownerOpt  = matchOpt{args: 1, negate: true, valid: reOwner.MatchString}
+	markOpt   = matchOpt{args: 1, negate: true, valid: reMark.MatchString}
+	rangeOpt  = matchOpt{args: 1, negate: true, valid: isIPRange}
+	portProto = []string{"tcp", "udp", "udplite", "dccp", "sctp"}
+)
+
+// matchModules：允许通过结构化接口编辑的模块及其选项
+var matchModules = map[string]matchModule{
+	"multiport": {protocols: portProto, options: map[string]matchOpt{
+		"--sports": portsOpt, "--source-ports": portsOpt,
+		"--dports": portsOpt, "--destination-ports": portsOpt,
+		"--ports": portsOpt,
+	}},
+	"iprange": {options: map[string]matchOpt{
+		"--src-range": rangeOpt, "--dst-range": rangeOpt,
+	}},
+	"limit": {options: map[string]matchOpt{
+		"--limit":       {args: 1, valid: reLimit.MatchString},
+		"--limit-burst": uintOpt,
+	}},
+	"recent": {options: map[string]matchOpt{
+		"--name": {args: 1, valid: reRecentKey.MatchString},
+		"--set":  negFlag, "--rcheck": negFlag, "--update": negFlag, "--remove": negFlag,
+		"--seconds": uintOpt, "--hitcount": uintOpt,
+		"--rttl": flag, "--reap": flag, "--rsource": flag, "--rdest": flag,
+		"--mask": {args: 1, valid: isIP},
+	}},
+	"set": {options: map[string]matchOpt{
+		"--match-set": {args: 2, negate: true, valid: func(v string) bool {
+			return reName.MatchString(v) // 第二个取值另外校验
+		}},
+		"--return-nomatch":  flag,
+		"--update-counters": negFlag, "--update-subcounters": negFlag,
+	}},
+	"mark": {options: map[string]matchOpt{
+		"--mark": markOpt,
+	}},
+	"owner": {options: map[string]matchOpt{
+		"--uid-owner": ownerOpt, "--gid-owner": ownerOpt,
+		"--suppl-groups": flag, "--socket-exists": negFlag,
+	}},
+	"physdev": {options: map[string]matchOpt{
+		"--physdev-in": ifaceOpt, "--physdev-out": ifaceOpt,
+		"--physdev-is-in": negFlag, "--physdev-is-out": negFlag, "--physdev-is-bridged": negFlag,
+	}},
+	"tcp": {protocols: []string{"tcp"}, options: map[string]matchOpt{
+		"--tcp-flags":  {args: 2, negate: true, valid: reTCPFlags.MatchString},
+		"--syn":        negFlag,
+		"--tcp-option": {args: 1, negate: true, valid: reUint.MatchString},
+		"--sport":      portOpt, "--source-port": portOpt,
+		"--dport": portOpt, "--destination-port": portOpt,
+	}},
+	"udp": {protocols: []string{"udp"}, options: map[string]matchOpt{
+		"--sport": portOpt, "--source-port": portOpt,
+		"--dport": portOpt, "--destination-port": portOpt,
+	}},
+}
+
+// normalizeMatches：模块名小写、选项名补齐 "--"；去掉没有选项的模块
+func normalizeMatches(ms []MatchSpec) []MatchSpec {
+	out := make([]MatchSpec, 0, len(ms))
+	for _, m := range ms {
+		m.Module = strings.ToLower(strings.TrimSpace(m.Module))
+		if len(m.Options) == 0 {
+			continue
+		}
+		opts := make([]MatchOption, 0, len(m.Options))
+		for _, o := range m.Options {
+			o.Name = strings.TrimSpace(o.Name)
+			if !strings.HasPrefix(o.Name, "-") {
+				o.Name = "--" + o.Name
+			}
+			for i := range o.Values {
+				o.Values[i] = strings.TrimSpace(o.Values[i])
+			}
+			opts = append(opts, o)
+		}
+		m.Options = opts
+		out = append(out, m)
+	}
+	return out
+}
+
+// validateMatches：模块与选项必须在白名单内，取值逐个校验
+func validateMatches(protocol string, ms []MatchSpec) error {
+	protocol = strings.ToLower(protocol)
+	for _, m := range ms {
+		mod, ok := matchModules[m.Module]
+		if !ok {
+			return fmt.Errorf("match module %q is not supported", m.Module)
+		}
+		if len(mod.protocols) > 0 && !contains(mod.protocols, protocol) {
+			return fmt.Errorf("match module %q requires protocol %s", m.Module, strings.Join(mod.protocols, "/"))
+		}
+		for _, o := range m.Options {
+			spec, ok := mod.options[o.Name]
+			if !ok {
+				return fmt.Errorf("option %s is not allowed for match %q", o.Name, m.Module)
+			}
+			if o.Negate && !spec.negate {
+				return fmt.Errorf("option %s of match %q cannot be negated", o.Name, m.Module)
+			}
+			if len(o.Values) != spec.args {
+				return fmt.Errorf("option %s of match %q takes %d value(s)", o.Name, m.Module, spec.args)
+			}
+			for i, v := range o.Values {
+				valid := spec.valid
+				if m.Module == "set" && o.Name == "--match-set" && i == 1 {
+					valid = reSetFlags.MatchString
+				}
+				if valid == nil || !valid(v) {
+					return fmt.Errorf("invalid value %q for %s of match %q", v, o.Name, m.Module)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchArgs：-m MODULE [!] --opt values...
+func matchArgs(ms []MatchSpec) []string {
+	var args []string
+	for _, m := range ms {
+		args = append(args, "-m", m.Module)
+		for _, o := range m.Options {
+			if o.Negate {
+				args = append(args, "!")
+			}
+			args = append(args, o.Name)
+			args = append(args, o.Values...)
+		}
+	}
+	return args
+}
+
+// 已经映射到表单字段的选项，不再出现在 Matches 里
+var fieldOptions = map[string][]string{
+	"conntrack": {"--ctstate"},
+	"state":     {"--state"},
+	"comment":   {"--comment"},
+	"tcp":       portFields,
+	"udp":       portFields,
+	"udplite":   portFields,
+	"dccp":      portFields,
+	"sctp":      portFields,
+}
+
+var portFields = []string{"--sport", "--source-port", "--dport", "--destination-port"}
+
+// matchesFromAST：把表单字段没覆盖到的 match 转成 MatchSpec（未知模块也原样带出，便于展示）
+// 与 ruleFields 一致，每个表单字段只取第一处出现
+func matchesFromAST(r *iptables.Rule) []MatchSpec {
+	used := map[string]bool{}
+	var out []MatchSpec
+	for _, m := range r.Matches {
+		ms := MatchSpec{Module: m.Module}
+		for _, o := range m.Options {
+			if contains(fieldOptions[m.Module], o.Name) {
+				key := fieldKey(o.Name)
+				if !used[key] {
+					used[key] = true
+					continue
+				}
+			}
+			ms.Options = append(ms.Options, MatchOption{
+				Name:   o.Name,
+				Values: append([]string(nil), o.Values...),
+				Negate: o.Negated,
+			})
+		}
+		if len(ms.Options) > 0 {
+			out = append(out, ms)
+		}
+	}
+	return out
+}
+
+// fieldKey：长短写法归到同一个表单字段
+func fieldKey(name string) string {
+	switch name {
+	case "--source-port":
+		return "--sport"
+	case "--destination-port":
+		return "--dport"
+	case "--state":
+		return "--ctstate"
+	}
+	return name
+}
+
+func contains(xs []string, v string) bool {
+	for _, x := range xs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
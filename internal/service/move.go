@@ -0,0 +1,106 @@
+package service
+
+import (
+	"slices"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// MoveInput：三选一；Position 为移动后在链中的位置（1..N）
+type MoveInput struct {
+	Position int    `json:"position,omitempty"`
+	Before   string `json:"before,omitempty"` // 移到该 ruleId 之前
+	After    string `json:"after,omitempty"`  // 移到该 ruleId 之后
+}
+
+func (in MoveInput) validate() error {
+	n := countSet(in.Position != 0, in.Before != "", in.After != "")
+	if n != 1 {
+		return invalidf("exactly one of position/before/after is required")
+	}
+	if in.Position < 0 {
+		return invalidf("position must be >= 1")
+	}
+	return nil
+}
+
+// MoveRule：把规则移到指定位置（或另一条规则前后），计数器保留，整表原子替换
+func (s *IptablesService) MoveRule(hostID uint, family IPFamily, table TableType, chainName, ruleID string, in MoveInput, opt WriteOptions) (WriteResult, error) {
+	if err := in.validate(); err != nil {
+		return WriteResult{}, err
+	}
+	return s.edit(hostID, family, table, chainName, opt, moveRule(chainName, ruleID, in))
+}
+
+// moveRule：MoveRule 在 AST 上的修改
+func moveRule(chainName, ruleID string, in MoveInput) func(t *iptables.Table) error {
+	return func(t *iptables.Table) error {
+		_, r, err := resolveRule(t, chainName, ruleID)
+		if err != nil {
+			return err
+		}
+		pos := in.Position
+		if ref := in.Before + in.After; ref != "" {
+			// 先在移走之前解析参照规则，旧的位置写法才能对上
+			_, anchor, err := resolveRule(t, chainName, ref)
+			if err != nil {
+				return err
+			}
+			if anchor == r {
+				return invalidf("cannot move a rule relative to itself")
+			}
+			t.RemoveRule(r)
+			pos = slices.Index(t.ChainRules(chainName), anchor) + 1
+			if in.After != "" {
+				pos++
+			}
+			t.InsertRule(r, pos)
+			return nil
+		}
+		// InsertRule 把越界位置当作追加，这里先拦下，免得写错的位置把规则挪到链尾
+		if n := len(t.ChainRules(chainName)); pos > n {
+			return invalidf("position %d out of range, chain %s has %d rules", pos, chainName, n)
+		}
+		return t.MoveRule(r, pos)
+	}
+}
+
+// ReorderChain：按给定的完整 ruleId 顺序重排整条链；必须恰好包含链中每条规则一次
+func (s *IptablesService) ReorderChain(hostID uint, family IPFamily, table TableType, chainName string, order []string, opt WriteOptions) (WriteResult, error) {
+	if len(order) == 0 {
+		return WriteResult{}, invalidf("order required")
+	}
+	return s.edit(hostID, family, table, chainName, opt, reorderChain(chainName, order))
+}
+
+// reorderChain：ReorderChain 在 AST 上的修改
+func reorderChain(chainName string, order []string) func(t *iptables.Table) error {
+	return func(t *iptables.Table) error {
+		rules := t.ChainRules(chainName)
+		if len(order) != len(rules) {
+			return invalidf("order has %d rule(s), chain %s has %d", len(order), chainName, len(rules))
+		}
+		want := make([]*iptables.Rule, 0, len(order))
+		seen := map[*iptables.Rule]bool{}
+		for _, id := range order {
+			_, r, err := resolveRule(t, chainName, id)
+			if err != nil {
+				return err
+			}
+			if seen[r] {
+				return invalidf("rule %s appears more than once", id)
+			}
+			seen[r] = true
+			want = append(want, r)
+		}
+		// 链内规则在 t.Rules 中占的槽位不变，按新顺序依次填回
+		k := 0
+		for i, r := range t.Rules {
+			if r.Chain == chainName {
+				t.Rules[i] = want[k]
+				k++
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// abcd：INPUT 链为 -j A..-j D，中间夹着一条 FORWARD 规则，用来确认只动了目标链
+func abcd(t *testing.T) *iptables.Table {
+	t.Helper()
+	return mustRuleset(t, `*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:A - [0:0]
+:B - [0:0]
+:C - [0:0]
+:D - [0:0]
+-A INPUT -j A
+-A INPUT -j B
+-A FORWARD -j ACCEPT
+-A INPUT -j C
+-A INPUT -j D
+COMMIT
+`).Table("filter")
+}
+
+func TestMoveInputValidate(t *testing.T) {
+	cases := []struct {
+		in MoveInput
+		ok bool
+	}{
+		{MoveInput{Position: 1}, true},
+		{MoveInput{Before: "x"}, true},
+		{MoveInput{After: "x"}, true},
+		{MoveInput{}, false},
+		{MoveInput{Position: -1}, false},
+		{MoveInput{Position: 1, Before: "x"}, false},
+		{MoveInput{Before: "x", After: "y"}, false},
+	}
+	for _, c := range cases {
+		if err := c.in.validate(); (err == nil) != c.ok {
+			t.Errorf("%+v.validate() = %v, want ok=%v", c.in, err, c.ok)
+		}
+	}
+}
+
+func TestMoveRule(t *testing.T) {
+	cases := []struct {
+		name string
+		rule int // 被移动的是 INPUT 第几条
+		in   func(id func(int) string) MoveInput
+		want []string // nil 表示应当拒绝
+	}{
+		{"to top", 4, func(func(int) string) MoveInput { return MoveInput{Position: 1} }, []string{"-j D", "-j A", "-j B", "-j C"}},
+		{"to end", 1, func(func(int) string) MoveInput { return MoveInput{Position: 4} }, []string{"-j B", "-j C", "-j D", "-j A"}},
+		{"same place", 2, func(func(int) string) MoveInput { return MoveInput{Position: 2} }, []string{"-j A", "-j B", "-j C", "-j D"}},
+		{"out of range", 1, func(func(int) string) MoveInput { return MoveInput{Position: 5} }, nil},
+		{"before later rule", 1, func(id func(int) string) MoveInput { return MoveInput{Before: id(4)} }, []string{"-j B", "-j C", "-j A", "-j D"}},
+		{"after later rule", 1, func(id func(int) string) MoveInput { return MoveInput{After: id(4)} }, []string{"-j B", "-j C", "-j D", "-j A"}},
+		{"before earlier rule", 4, func(id func(int) string) MoveInput { return MoveInput{Before: id(1)} }, []string{"-j D", "-j A", "-j B", "-j C"}},
+		{"after earlier rule", 4, func(id func(int) string) MoveInput { return MoveInput{After: id(2)} }, []string{"-j A", "-j B", "-j D", "-j C"}},
+		{"relative to itself", 2, func(id func(int) string) MoveInput { return MoveInput{After: id(2)} }, nil},
+		{"unknown anchor", 2, func(func(int) string) MoveInput { return MoveInput{After: "0123456789abcdef-0"} }, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tb := abcd(t)
+			id := func(n int) string { return ruleID(t, tb, "INPUT", n) }
+			err := moveRule("INPUT", id(c.rule), c.in(id))(tb)
+			if c.want == nil {
+				if err == nil {
+					t.Fatalf("got %q, want error", chainSpecs(tb, "INPUT"))
+				}
+				if got := chainSpecs(tb, "INPUT"); !slices.Equal(got, []string{"-j A", "-j B", "-j C", "-j D"}) {
+					t.Errorf("chain changed on error: %q", got)
+				}
+				return
+			}
+			if got := chainSpecs(tb, "INPUT"); err != nil || !slices.Equal(got, c.want) {
+				t.Errorf("got %q, %v, want %q", got, err, c.want)
+			}
+			if fw := chainSpecs(tb, "FORWARD"); !slices.Equal(fw, []string{"-j ACCEPT"}) {
+				t.Errorf("FORWARD = %q", fw)
+			}
+		})
+	}
+}
+
+func TestReorderChain(t *testing.T) {
+	cases := []struct {
+		name  string
+		order []int // INPUT 中规则的原序号
+		want  []string
+		err   error
+	}{
+		{"reverse", []int{4, 3, 2, 1}, []string{"-j D", "-j C", "-j B", "-j A"}, nil},
+		{"identity", []int{1, 2, 3, 4}, []string{"-j A", "-j B", "-j C", "-j D"}, nil},
+		{"missing rule", []int{1, 2, 3}, nil, ErrInvalidInput},
+		{"duplicate rule", []int{1, 2, 3, 3}, nil, ErrInvalidInput},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tb := abcd(t)
+			var order []string
+			for _, n := range c.order {
+				order = append(order, ruleID(t, tb, "INPUT", n))
+			}
+			err := reorderChain("INPUT", order)(tb)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Errorf("err = %v, want %v", err, c.err)
+				}
+				return
+			}
+			if got := chainSpecs(tb, "INPUT"); err != nil || !slices.Equal(got, c.want) {
+				t.Errorf("got %q, %v, want %q", got, err, c.want)
+			}
+			// 其他链的规则留在原来的槽位
+			if tb.Rules[2].Chain != "FORWARD" {
+				t.Errorf("FORWARD rule moved: %q", tb.String())
+			}
+		})
+	}
+
+	tb := abcd(t)
+	order := []string{ruleID(t, tb, "INPUT", 1), ruleID(t, tb, "INPUT", 2), ruleID(t, tb, "INPUT", 3), "0123456789abcdef-0"}
+	if err := reorderChain("INPUT", order)(tb); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("unknown id: err = %v, want ErrRuleNotFound", err)
+	}
+}
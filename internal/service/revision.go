@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"iptables-web/backend/internal/iptables"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+// 乐观并发：读接口返回规则集版本号（ETag），写接口要求带上 If-Match
+var (
+	ErrPreconditionRequired = errors.New("If-Match header required")
+	ErrRevisionMismatch     = errors.New("ruleset changed since it was read")
+)
+
+// WriteOptions：写操作的前置条件
+type WriteOptions struct {
+	IfMatch string // 客户端读到的版本号；"*" 表示不校验；DryRun 时可省略
+	DryRun  bool   // 只用 iptables-restore --test 校验修改结果，不落到内核
+
+	Confirm        bool          // commit-confirm：窗口内未确认则目标机自动回滚
+	ConfirmTimeout time.Duration // 确认窗口；<=0 用默认值
+
+	AllowLockout bool // 模拟显示会切断管理 SSH 连接时仍然写入
+	ProtectSSH   bool // 修改 filter 表时在 INPUT 顶部补一条放行管理连接的规则（见 lockout.go）
+
+	Author string // 记入修改前快照的操作者与原因（见 snapshot.go）
+	Reason string
+}
+
+// WriteResult：写操作完成后的新版本号；DryRun 时为当前版本号和校验结果
+type WriteResult struct {
+	Revision string
+	DryRun   *DryRunResult
+	Confirm  *PendingConfirm // opt.Confirm 时的待确认变更
+	Snapshot uint            // 修改前快照的 ID；DryRun 时为 0
+}
+
+// Revision：由 iptables-save 输出计算版本号（忽略注释、计数器）
+func Revision(dump string) (string, error) {
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return "", fmt.Errorf("parse iptables-save: %w", err)
+	}
+	return rs.Revision(), nil
+}
+
+// normalizeETag：去掉 W/ 前缀和引号
+func normalizeETag(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "W/")
+	return strings.Trim(s, `"`)
+}
+
+// hostLocks：同一主机同一协议族的写操作串行执行，保证“校验版本 → 修改”之间不被本服务的其他请求插入
+var hostLocks sync.Map // "hostID/v4|v6" -> *sync.Mutex
+
+func lockHost(hostID uint, v6 bool) func() {
+	key := fmt.Sprintf("%d/v4", hostID)
+	if v6 {
+		key = fmt.Sprintf("%d/v6", hostID)
+	}
+	mu, _ := hostLocks.LoadOrStore(key, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// rulesetHost：guardedWrite / editTable 及其各项检查对目标机的全部操作，由 *sshx.Client 实现
+type rulesetHost interface {
+	IptablesSave(v6 bool, args ...string) (string, error)
+	IptablesRestore(v6 bool, content string, args ...string) (string, error)
+	ManagementPeer(ctx context.Context) (sshx.Peer, error)
+	SSHPort() int
+	BeginIptablesTxn(ctx context.Context, v6 bool) (*sshx.Txn, error)
+	CancelRollback(ctx context.Context, rb sshx.ScheduledRollback) error
+}
+
+// guardedWrite：加锁 → 校验 If-Match → （防锁死检查）→（布置回滚）→ 保存快照 → 执行 fn → 返回新版本号
+// preview 在 AST 上做与 fn 等价的修改，用于防锁死模拟；为 nil 表示无法模拟，只能带 allowLockout 执行
+func guardedWrite(cli rulesetHost, hostID uint, v6 bool, opt WriteOptions, preview func(rs *iptables.Ruleset) error, fn func() error) (WriteResult, error) {
+	want := normalizeETag(opt.IfMatch)
+	if want == "" {
+		return WriteResult{}, ErrPreconditionRequired
+	}
+	unlock := lockHost(hostID, v6)
+	defer unlock()
+
+	dump, err := cli.IptablesSave(v6, "-c")
+	if err != nil {
+		return WriteResult{}, err
+	}
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	cur := rs.Revision()
+	if err := checkRevision(cur, want); err != nil {
+		return WriteResult{Revision: cur}, err
+	}
+	if !opt.AllowLockout || opt.ProtectSSH {
+		if g := newLockoutGuard(cli, hostID, v6, rs); g != nil {
+			if preview == nil {
+				preview = cannotSimulate
+			}
+			if err := preview(rs); err != nil {
+				return WriteResult{Revision: cur}, err
+			}
+			if err := g.check(rs, opt.ProtectSSH).err(); err != nil && !opt.AllowLockout {
+				return WriteResult{Revision: cur}, err
+			}
+		}
+	}
+	pc, err := armConfirm(cli, hostID, v6, opt)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	snap, err := recordSnapshot(hostID, v6, dump, cur, opt)
+	if err != nil {
+		disarmConfirm(cli, pc)
+		return WriteResult{Revision: cur}, err
+	}
+	if err := fn(); err != nil {
+		disarmConfirm(cli, pc)
+		return WriteResult{}, err
+	}
+	rev, err := currentRevision(cli, v6)
+	if err != nil {
+		// 修改已经生效，只是取不到新版本号；客户端重新读取即可
+		return WriteResult{Confirm: pc, Snapshot: snap}, nil
+	}
+	return WriteResult{Revision: rev, Confirm: pc, Snapshot: snap}, nil
+}
+
+// checkHostRevisions：多主机写操作（作业、流式 restore）要为每台主机给出读到的版本号，
+// 缺少时返回 ErrPreconditionRequired；force 表示明确放弃校验，可能覆盖并发修改
+func checkHostRevisions(revisions map[uint]string, force bool, hostIDs []uint) error {
+	if force {
+		return nil
+	}
+	for _, id := range hostIDs {
+		if normalizeETag(revisions[id]) == "" {
+			return fmt.Errorf("%w: no revision given for host %d (pass force to skip the check)", ErrPreconditionRequired, id)
+		}
+	}
+	return nil
+}
+
+// hostIfMatch：多主机写操作中某台主机的 If-Match
+func hostIfMatch(revisions map[uint]string, force bool, hostID uint) string {
+	if force {
+		return "*"
+	}
+	return revisions[hostID]
+}
+
+func checkRevision(cur, want string) error {
+	if want != "*" && cur != want {
+		return fmt.Errorf("%w (current revision %s)", ErrRevisionMismatch, cur)
+	}
+	return nil
+}
+
+func currentRevision(cli rulesetHost, v6 bool) (string, error) {
+	dump, err := cli.IptablesSave(v6)
+	if err != nil {
+		return "", err
+	}
+	return Revision(dump)
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"iptables-web/backend/internal/iptables"
+	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+func TestNormalizeETag(t *testing.T) {
+	cases := map[string]string{
+		"":               "",
+		"*":              "*",
+		`"abc"`:          "abc",
+		`W/"abc"`:        "abc",
+		"  abc ":         "abc",
+		`"0123456789ab"`: "0123456789ab",
+	}
+	for in, want := range cases {
+		if got := normalizeETag(in); got != want {
+			t.Errorf("normalizeETag(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCheckRevision(t *testing.T) {
+	if err := checkRevision("abc", "abc"); err != nil {
+		t.Errorf("same revision: %v", err)
+	}
+	if err := checkRevision("abc", "*"); err != nil {
+		t.Errorf("wildcard: %v", err)
+	}
+	if err := checkRevision("abc", "def"); !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("different revision: err = %v, want ErrRevisionMismatch", err)
+	}
+}
+
+func TestCheckHostRevisions(t *testing.T) {
+	revs := map[uint]string{1: `"abc"`, 2: "def", 3: `""`}
+	cases := []struct {
+		name  string
+		force bool
+		hosts []uint
+		ok    bool
+	}{
+		{"all given", false, []uint{1, 2}, true},
+		{"missing host", false, []uint{1, 4}, false},
+		{"empty etag", false, []uint{3}, false},
+		{"force", true, []uint{1, 4}, true},
+	}
+	for _, c := range cases {
+		err := checkHostRevisions(revs, c.force, c.hosts)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.ok && !errors.Is(err, ErrPreconditionRequired) {
+			t.Errorf("%s: err = %v, want ErrPreconditionRequired", c.name, err)
+		}
+	}
+	if got := hostIfMatch(revs, false, 2); got != "def" {
+		t.Errorf("hostIfMatch = %q, want def", got)
+	}
+	if got := hostIfMatch(revs, true, 2); got != "*" {
+		t.Errorf("hostIfMatch with force = %q, want *", got)
+	}
+}
+
+// 修改类作业 / 流式 restore 缺少版本号时在加载主机之前就被拒绝
+func TestMultiHostWritesRequireRevisions(t *testing.T) {
+	in := JobInput{HostIDs: []uint{1, 2}, Op: JobOpFlush, Table: "filter", Revisions: map[uint]string{1: "abc"}}
+	if _, err := (&JobsService{}).Submit(in); !errors.Is(err, ErrPreconditionRequired) {
+		t.Errorf("job without revision for host 2: err = %v, want ErrPreconditionRequired", err)
+	}
+	st := StreamInput{HostIDs: []uint{1}, Op: StreamOpRestore, Content: "*filter\nCOMMIT\n"}
+	if _, _, err := (&StreamService{}).Prepare(st); !errors.Is(err, ErrPreconditionRequired) {
+		t.Errorf("stream restore without revision: err = %v, want ErrPreconditionRequired", err)
+	}
+}
+
+// fakeHost：内存中的目标机，restore 按整表替换的语义作用在 rs 上
+type fakeHost struct {
+	t          *testing.T
+	rs         *iptables.Ruleset
+	peer       sshx.Peer
+	restoreErr error    // 非 --test 的 restore 返回的错误（规则不变）
+	testErr    error    // --test 返回的错误
+	restores   []string // 非 --test 的 restore 内容
+	tests      []string // --test 的内容
+}
+
+func newFakeHost(t *testing.T, dump string) *fakeHost {
+	return &fakeHost{t: t, rs: mustRuleset(t, dump), peer: peerV4}
+}
+
+func (f *fakeHost) IptablesSave(v6 bool, args ...string) (string, error) { return f.rs.String(), nil }
+
+func (f *fakeHost) IptablesRestore(v6 bool, content string, args ...string) (string, error) {
+	if slices.Contains(args, "--test") {
+		f.tests = append(f.tests, content)
+		return "", f.testErr
+	}
+	f.restores = append(f.restores, content)
+	if f.restoreErr != nil {
+		return "", f.restoreErr
+	}
+	next, err := iptables.Parse(content)
+	if err != nil {
+		f.t.Fatalf("restore of unparsable content: %v\n%s", err, content)
+	}
+	replaceTables(f.rs, next)
+	return "", nil
+}
+
+func (f *fakeHost) ManagementPeer(context.Context) (sshx.Peer, error) {
+	if f.peer.ClientIP == "" {
+		return sshx.Peer{}, errors.New("SSH_CONNECTION not set")
+	}
+	return f.peer, nil
+}
+
+func (f *fakeHost) SSHPort() int { return 22 }
+
+func (f *fakeHost) BeginIptablesTxn(context.Context, bool) (*sshx.Txn, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *fakeHost) CancelRollback(context.Context, sshx.ScheduledRollback) error { return nil }
+
+func (f *fakeHost) revision() string { return f.rs.Revision() }
+
+const baseDump = `*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+COMMIT
+`
+
+// dropInput：把 INPUT 的默认策略改成 DROP 并清空规则（会切断管理连接）
+func dropInput(t *iptables.Table) error {
+	t.Chain("INPUT").Policy = "DROP"
+	t.FlushChain("INPUT")
+	return nil
+}
+
+func TestGuardedWrite(t *testing.T) {
+	addRule := func(rs *iptables.Ruleset) error {
+		return insertPreview("filter", "INPUT", 0, []string{"-s", "198.51.100.0/24", "-j", "DROP"})(rs)
+	}
+	cases := []struct {
+		name    string
+		ifMatch string // "cur" 表示当前版本号
+		allow   bool
+		preview func(rs *iptables.Ruleset) error
+		fnErr   error
+		err     error // nil 表示应当执行成功
+		ran     bool
+	}{
+		{name: "matching revision", ifMatch: "cur", preview: addRule, ran: true},
+		{name: "quoted revision", ifMatch: `"cur"`, preview: addRule, ran: true},
+		{name: "wildcard", ifMatch: "*", preview: addRule, ran: true},
+		{name: "missing If-Match", preview: addRule, err: ErrPreconditionRequired},
+		{name: "stale revision", ifMatch: "0123", preview: addRule, err: ErrRevisionMismatch},
+		{name: "lockout", ifMatch: "cur", preview: tablePreview("filter", dropInput), err: ErrLockoutRisk},
+		{name: "lockout allowed", ifMatch: "cur", allow: true, preview: tablePreview("filter", dropInput), ran: true},
+		{name: "cannot simulate", ifMatch: "cur", err: ErrLockoutRisk},
+		{name: "cannot simulate, allowed", ifMatch: "cur", allow: true, ran: true},
+		{name: "command fails", ifMatch: "cur", preview: addRule, fnErr: errors.New("iptables: exit 1"), ran: true},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hostID := uint(9100 + i)
+			defer repo.NewSnapshotRepo().DeleteByHost(hostID)
+			f := newFakeHost(t, baseDump)
+			before := f.rs.String()
+			ifMatch := strings.ReplaceAll(c.ifMatch, "cur", f.revision())
+			ran := false
+			res, err := guardedWrite(f, hostID, false, WriteOptions{IfMatch: ifMatch, AllowLockout: c.allow}, c.preview, func() error {
+				ran = true
+				if c.fnErr != nil {
+					return c.fnErr
+				}
+				f.rs.Table("filter").Chain("INPUT").Policy = "DROP"
+				return nil
+			})
+			if ran != c.ran {
+				t.Errorf("ran = %v, want %v", ran, c.ran)
+			}
+			switch {
+			case c.fnErr != nil:
+				if !errors.Is(err, c.fnErr) {
+					t.Errorf("err = %v, want %v", err, c.fnErr)
+				}
+			case c.err != nil:
+				if !errors.Is(err, c.err) {
+					t.Errorf("err = %v, want %v", err, c.err)
+				}
+			case err != nil:
+				t.Fatalf("err = %v", err)
+			default:
+				if res.Revision != f.revision() || res.Revision == mustRuleset(t, before).Revision() {
+					t.Errorf("revision = %s, want the new revision %s", res.Revision, f.revision())
+				}
+				snap, err := NewSnapshotService().Get(hostID, res.Snapshot)
+				if err != nil || snap.Content != before {
+					t.Errorf("snapshot %d = %v, %v, want the pre-change dump", res.Snapshot, snap, err)
+				}
+			}
+		})
+	}
+}
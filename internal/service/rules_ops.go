@@ -3,7 +3,9 @@ package service
 
 import (
 	"fmt"
+	"slices"
 
+	"iptables-web/backend/internal/iptables"
 	"iptables-web/backend/internal/repo"
 	sshx "iptables-web/backend/internal/ssh"
 )
@@ -21,95 +23,260 @@ func (s *RulesOpsService) cli(hostID uint) (*sshx.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return sshx.New(*h), nil
+	h.Normalize()
+	return sshx.Get(*h), nil
 }
 
-// 清空规则：整表(-F) 或 指定链(-F CHAIN)
-func (s *RulesOpsService) Flush(hostID uint, v6 bool, table, chain string) error {
+// write：在主机锁内校验 If-Match 并执行修改；这些命令式操作不支持 dry-run 与 protectSsh
+// preview 为 AST 上的等价修改，用于防锁死模拟（见 guardedWrite）
+func (s *RulesOpsService) write(hostID uint, v6 bool, opt WriteOptions, preview func(rs *iptables.Ruleset) error, fn func(cli *sshx.Client) error) (WriteResult, error) {
+	if opt.DryRun {
+		return WriteResult{}, invalidf("dry-run is only supported for import")
+	}
+	if opt.ProtectSSH {
+		return WriteResult{}, invalidf("protectSsh is only supported for import")
+	}
 	cli, err := s.cli(hostID)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
-	if chain == "" {
-		_, err = cli.Iptables(v6, table, "-F")
-	} else {
-		_, err = cli.Iptables(v6, table, "-F", chain)
+	return guardedWrite(cli, hostID, v6, opt, preview, func() error { return fn(cli) })
+}
+
+// 清空规则：整表(-F) 或 指定链(-F CHAIN)
+func (s *RulesOpsService) Flush(hostID uint, v6 bool, table, chain string, opt WriteOptions) (WriteResult, error) {
+	if err := validateTableChain(table, chain); err != nil {
+		return WriteResult{}, err
 	}
-	return err
+	return s.write(hostID, v6, opt, flushPreview(table, chain), func(cli *sshx.Client) error {
+		var err error
+		if chain == "" {
+			_, err = cli.Iptables(v6, table, "-F")
+		} else {
+			_, err = cli.Iptables(v6, table, "-F", chain)
+		}
+		return err
+	})
 }
 
 // 清零计数：整表(-Z) 或 指定链(-Z CHAIN)
-func (s *RulesOpsService) Zero(hostID uint, v6 bool, table, chain string) error {
-	cli, err := s.cli(hostID)
-	if err != nil {
-		return err
-	}
-	if chain == "" {
-		_, err = cli.Iptables(v6, table, "-Z")
-	} else {
-		_, err = cli.Iptables(v6, table, "-Z", chain)
+func (s *RulesOpsService) Zero(hostID uint, v6 bool, table, chain string, opt WriteOptions) (WriteResult, error) {
+	if err := validateTableChain(table, chain); err != nil {
+		return WriteResult{}, err
 	}
-	return err
+	return s.write(hostID, v6, opt, noRuleChange, func(cli *sshx.Client) error {
+		var err error
+		if chain == "" {
+			_, err = cli.Iptables(v6, table, "-Z")
+		} else {
+			_, err = cli.Iptables(v6, table, "-Z", chain)
+		}
+		return err
+	})
 }
 
 // 清理自定义链：通常先 -F 再 -X
-func (s *RulesOpsService) ClearUserChains(hostID uint, v6 bool, table string) error {
-	cli, err := s.cli(hostID)
-	if err != nil {
-		return err
+func (s *RulesOpsService) ClearUserChains(hostID uint, v6 bool, table string, opt WriteOptions) (WriteResult, error) {
+	if err := validateTable(table); err != nil {
+		return WriteResult{}, err
 	}
-	if _, err = cli.Iptables(v6, table, "-F"); err != nil {
+	return s.write(hostID, v6, opt, clearUserChainsPreview(table), func(cli *sshx.Client) error {
+		if _, err := cli.Iptables(v6, table, "-F"); err != nil {
+			return err
+		}
+		_, err := cli.Iptables(v6, table, "-X")
 		return err
-	}
-	_, err = cli.Iptables(v6, table, "-X")
-	return err
+	})
 }
 
 // 追加规则：iptables -t <table> -A <chain> <spec>
-func (s *RulesOpsService) Append(hostID uint, v6 bool, table, chain, rule string) error {
-	cli, err := s.cli(hostID)
+func (s *RulesOpsService) Append(hostID uint, v6 bool, table, chain, rule string, opt WriteOptions) (WriteResult, error) {
+	args, err := ruleOpArgs(table, chain, rule)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
-	_, err = cli.Iptables(v6, table, "-A", chain, rule)
-	return err
+	return s.write(hostID, v6, opt, insertPreview(table, chain, 0, args), func(cli *sshx.Client) error {
+		_, err := cli.Iptables(v6, table, append([]string{"-A", chain}, args...)...)
+		return err
+	})
 }
 
 // 插入规则：iptables -t <table> -I <chain> <pos> <spec>
-func (s *RulesOpsService) Insert(hostID uint, v6 bool, table, chain string, pos int, rule string) error {
-	cli, err := s.cli(hostID)
+func (s *RulesOpsService) Insert(hostID uint, v6 bool, table, chain string, pos int, rule string, opt WriteOptions) (WriteResult, error) {
+	args, err := ruleOpArgs(table, chain, rule)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
-	_, err = cli.Iptables(v6, table, "-I", chain, fmt.Sprint(pos), rule)
-	return err
+	return s.write(hostID, v6, opt, insertPreview(table, chain, max(pos, 1), args), func(cli *sshx.Client) error {
+		_, err := cli.Iptables(v6, table, append([]string{"-I", chain, fmt.Sprint(pos)}, args...)...)
+		return err
+	})
 }
 
 // 删除第 N 条：iptables -t <table> -D <chain> <num>
-func (s *RulesOpsService) Delete(hostID uint, v6 bool, table, chain string, num int) error {
-	cli, err := s.cli(hostID)
-	if err != nil {
+func (s *RulesOpsService) Delete(hostID uint, v6 bool, table, chain string, num int, opt WriteOptions) (WriteResult, error) {
+	if err := validateTableChain(table, chain); err != nil {
+		return WriteResult{}, err
+	}
+	return s.write(hostID, v6, opt, deletePreview(table, chain, num), func(cli *sshx.Client) error {
+		_, err := cli.Iptables(v6, table, "-D", chain, fmt.Sprint(num))
 		return err
+	})
+}
+
+// flushPreview：-F（chain 为空时整表）的 AST 等价修改
+func flushPreview(table, chain string) func(rs *iptables.Ruleset) error {
+	return tablePreview(table, func(t *iptables.Table) error {
+		if chain == "" {
+			t.Rules = nil
+		} else {
+			t.FlushChain(chain)
+		}
+		return nil
+	})
+}
+
+// clearUserChainsPreview：-F 后 -X 的 AST 等价修改
+func clearUserChainsPreview(table string) func(rs *iptables.Ruleset) error {
+	return tablePreview(table, func(t *iptables.Table) error {
+		t.Rules = nil
+		t.Chains = slices.DeleteFunc(t.Chains, func(c *iptables.Chain) bool { return !c.Builtin() })
+		return nil
+	})
+}
+
+// deletePreview：-D CHAIN NUM 的 AST 等价修改
+func deletePreview(table, chain string, num int) func(rs *iptables.Ruleset) error {
+	return tablePreview(table, func(t *iptables.Table) error {
+		if rules := t.ChainRules(chain); num >= 1 && num <= len(rules) {
+			t.RemoveRule(rules[num-1])
+		}
+		return nil
+	})
+}
+
+// insertPreview：-A（pos 为 0）/ -I 的 AST 等价修改；本地解析不了的规则片段无法模拟，按有风险处理
+func insertPreview(table, chain string, pos int, args []string) func(rs *iptables.Ruleset) error {
+	return tablePreview(table, func(t *iptables.Table) error {
+		r, err := iptables.ParseRuleArgs(chain, args)
+		if err != nil {
+			return fmt.Errorf("%w: cannot simulate rule (%v)", ErrLockoutRisk, err)
+		}
+		if err := checkInsertPos(t, chain, pos); err != nil {
+			return err
+		}
+		t.InsertRule(r, pos)
+		return nil
+	})
+}
+
+// ruleOpArgs：校验表 / 链名，并把原始规则片段转成 argv
+func ruleOpArgs(table, chain, rule string) ([]string, error) {
+	if err := validateTableChain(table, chain); err != nil {
+		return nil, err
+	}
+	if chain == "" {
+		return nil, invalidf("chain required")
 	}
-	_, err = cli.Iptables(v6, table, "-D", chain, fmt.Sprint(num))
-	return err
+	return ruleSpecArgs(rule)
 }
 
-// 导出规则：iptables-save / ip6tables-save
-func (s *RulesOpsService) Export(hostID uint, v6 bool) (string, error) {
+// 导出规则：iptables-save / ip6tables-save，同时返回版本号
+func (s *RulesOpsService) Export(hostID uint, v6 bool) (string, string, error) {
 	cli, err := s.cli(hostID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return cli.IptablesSave(v6)
+	text, err := cli.IptablesSave(v6)
+	if err != nil {
+		return "", "", err
+	}
+	rev, err := Revision(text)
+	if err != nil {
+		return "", "", err
+	}
+	return text, rev, nil
 }
 
 // 导入规则：iptables-restore / ip6tables-restore
-func (s *RulesOpsService) Import(hostID uint, v6 bool, content string) error {
+// opt.DryRun 时原样交给 iptables-restore --test，错误行号即提交的 content 中的行号；
+// 防锁死模拟需要本地能解析 content，解析不了时只能带 allowLockout 导入；
+// opt.ProtectSSH 时导入的是补上保护规则后重新渲染的内容（dry-run 只在 Lockout.Protected 中体现）
+func (s *RulesOpsService) Import(hostID uint, v6 bool, content string, opt WriteOptions) (WriteResult, error) {
+	if opt.DryRun {
+		return s.dryRunImport(hostID, v6, content, opt)
+	}
 	cli, err := s.cli(hostID)
 	if err != nil {
+		return WriteResult{}, err
+	}
+	var next *iptables.Ruleset
+	preview := func(rs *iptables.Ruleset) error {
+		var err error
+		next, err = importPreview(rs, content)
+		return err
+	}
+	return guardedWrite(cli, hostID, v6, opt, preview, func() error {
+		body := content
+		if opt.ProtectSSH && next != nil {
+			body = next.String()
+		}
+		_, err := cli.IptablesRestore(v6, body)
 		return err
+	})
+}
+
+// importPreview：restore content 的 AST 等价修改，返回解析出的 content；本地解析不了时无法模拟，按有风险处理
+func importPreview(rs *iptables.Ruleset, content string) (*iptables.Ruleset, error) {
+	next, err := iptables.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot simulate imported content (%v)", ErrLockoutRisk, err)
+	}
+	replaceTables(rs, next)
+	return next, nil
+}
+
+// replaceTables：按 restore 语义用 next 中出现的表整表替换 rs 中的同名表（共用 next 的 Table）
+func replaceTables(rs, next *iptables.Ruleset) {
+	for _, t := range next.Tables {
+		i := slices.IndexFunc(rs.Tables, func(x *iptables.Table) bool { return x.Name == t.Name })
+		if i < 0 {
+			rs.Tables = append(rs.Tables, t)
+		} else {
+			rs.Tables[i] = t
+		}
+	}
+}
+
+// dryRunImport：--test 校验提交的 content 原文，保证错误行号对得上；本地能解析时顺带给出防锁死模拟结果，
+// protectSsh 要补的保护规则不进 --test，只通过 Lockout.Protected 报告
+func (s *RulesOpsService) dryRunImport(hostID uint, v6 bool, content string, opt WriteOptions) (WriteResult, error) {
+	cli, err := s.cli(hostID)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	dump, err := cli.IptablesSave(v6)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	rs, err := iptables.Parse(dump)
+	if err != nil {
+		return WriteResult{}, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	cur := rs.Revision()
+	if want := normalizeETag(opt.IfMatch); want != "" {
+		if err := checkRevision(cur, want); err != nil {
+			return WriteResult{Revision: cur}, err
+		}
+	}
+	var lc *LockoutCheck
+	if next, err := iptables.Parse(content); err == nil {
+		if g := newLockoutGuard(cli, hostID, v6, rs); g != nil {
+			replaceTables(rs, next)
+			lc = g.check(rs, opt.ProtectSSH)
+		}
 	}
-	_, err = cli.IptablesRestore(v6, content)
-	return err
+	res := testRestore(cli, v6, content)
+	res.Lockout = lc
+	return WriteResult{Revision: cur, DryRun: res}, nil
 }
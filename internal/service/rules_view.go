@@ -2,12 +2,10 @@
 package service
 
 import (
-	"bufio"
 	"fmt"
+	"iptables-web/backend/internal/iptables"
 	"iptables-web/backend/internal/repo"
 	sshx "iptables-web/backend/internal/ssh"
-	"regexp"
-	"strings"
 )
 
 type RulesService struct{ hosts *repo.HostRepo }
@@ -15,8 +13,12 @@ type RulesService struct{ hosts *repo.HostRepo }
 func NewRulesService() *RulesService { return &RulesService{hosts: repo.NewHostRepo()} }
 
 type RuleView struct {
+	ID  string `json:"id"`  // 内容指纹，与 Rule.ID 相同
 	Num int    `json:"num"` // 在链中的生效顺序（1..N）
-	Raw string `json:"raw"` // 原始 "-A CHAIN ..." 文本
+	Raw string `json:"raw"` // 原始 "-A CHAIN ..." 文本（不含计数器）
+
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
 }
 
 type ChainView struct {
@@ -24,12 +26,15 @@ type ChainView struct {
 	Name     string     `json:"name"`
 	Policy   string     `json:"policy,omitempty"`   // ACCEPT/DROP/…；自定义链为 "-"
 	Counters string     `json:"counters,omitempty"` // iptables-save 里的 "[pkts:bytes]" 原样
+	Packets  uint64     `json:"packets"`
+	Bytes    uint64     `json:"bytes"`
 	Rules    []RuleView `json:"rules"`
 }
 
 type RulesView struct {
 	// tables["nat"] = []ChainView{ ... }，按出现顺序排好
-	Tables map[string][]ChainView `json:"tables"`
+	Tables   map[string][]ChainView `json:"tables"`
+	Revision string                 `json:"revision"` // 规则集版本号，写操作时作为 If-Match 回传
 }
 
 func (s *RulesService) CurrentRules(hostID uint, v6 bool) (string, error) {
@@ -37,125 +42,80 @@ func (s *RulesService) CurrentRules(hostID uint, v6 bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cli := sshx.Client{Host: *h}
-	text, err := cli.IptablesSave(v6)
+	h.Normalize()
+	text, err := sshx.Get(*h).IptablesSave(v6)
 	if err != nil {
 		return "", fmt.Errorf("fetch rules: %w", err)
 	}
 	return text, nil
 }
 
-// 提供“结构化视图”的方法
+// 提供“结构化视图”的方法；带 -c 取每条规则的计数器
 func (s *RulesService) CurrentRulesView(hostID uint, v6 bool) (*RulesView, error) {
 	h, err := s.hosts.Get(hostID)
 	if err != nil {
 		return nil, err
 	}
-	cli := sshx.New(*h) // 或 &sshx.Client{Host:*h}
-	text, err := cli.IptablesSave(v6)
+	h.Normalize()
+	text, err := sshx.Get(*h).IptablesSave(v6, "-c")
 	if err != nil {
 		return nil, err
 	}
-	view := parseIptablesSave(text)
-	return view, nil
+	return parseIptablesSave(text)
 }
 
-// 放到同文件或单独 parser.go
-func parseIptablesSave(text string) *RulesView {
+// parseIptablesSave：基于 iptables 包的 AST 生成按表分组的视图
+func parseIptablesSave(text string) (*RulesView, error) {
+	rs, err := iptables.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse iptables-save: %w", err)
+	}
 	out := &RulesView{
 		Tables: map[string][]ChainView{
 			"raw": {}, "mangle": {}, "nat": {}, "filter": {}, "security": {},
 		},
+		Revision: rs.Revision(),
 	}
 
-	var curTable string
-	// 记录某表里链名到下标的映射，便于往已有链里追加规则
-	index := map[string]map[string]int{
-		"raw": {}, "mangle": {}, "nat": {}, "filter": {}, "security": {},
-	}
-
-	// 正则更耐脏：":CHAIN POLICY [..]"；自定义链 policy 可能是 "-"
-	reChain := regexp.MustCompile(`^:([^ ]+)\s+([A-Za-z-]+)\s+\[([^\]]*)\]$`)
-	// 规则行："-A CHAIN ..."
-	reRule := regexp.MustCompile(`^-A\s+(\S+)\s+(.*)$`)
-
-	sc := bufio.NewScanner(strings.NewReader(text))
-	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// *table
-		if strings.HasPrefix(line, "*") {
-			curTable = strings.TrimPrefix(line, "*")
-			continue
+	for _, t := range rs.Tables {
+		chains := out.Tables[t.Name]
+		ids := t.RuleIDs()
+		// 链名到下标，便于往已有链里追加规则
+		index := map[string]int{}
+		addChain := func(cv ChainView) {
+			cv.Order = len(chains)
+			cv.Rules = make([]RuleView, 0, 8)
+			chains = append(chains, cv)
+			index[cv.Name] = len(chains) - 1
 		}
-		// COMMIT 结束当前表
-		if line == "COMMIT" {
-			curTable = ""
-			continue
-		}
-		if curTable == "" {
-			continue
-		} // 其他表头不识别时跳过
-
-		// 链
-		if strings.HasPrefix(line, ":") {
-			m := reChain.FindStringSubmatch(line)
-			if len(m) == 4 {
-				name := m[1]
-				policy := m[2]
-				counters := m[3]
-
-				cv := ChainView{
-					Order:    len(out.Tables[curTable]),
-					Name:     name,
-					Policy:   "",
-					Counters: "",
-					Rules:    make([]RuleView, 0, 8),
-				}
-				if policy != "-" {
-					cv.Policy = policy
-				}
-				if counters != "" {
-					cv.Counters = "[" + counters + "]"
-				}
-
-				out.Tables[curTable] = append(out.Tables[curTable], cv)
-				if index[curTable] == nil {
-					index[curTable] = map[string]int{}
-				}
-				index[curTable][name] = len(out.Tables[curTable]) - 1
+		for _, c := range t.Chains {
+			cv := ChainView{Name: c.Name}
+			if c.Builtin() {
+				cv.Policy = c.Policy
 			}
-			continue
+			if c.Counters != nil {
+				cv.Counters = c.Counters.String()
+				cv.Packets, cv.Bytes = c.Counters.Packets, c.Counters.Bytes
+			}
+			addChain(cv)
 		}
-
-		// 规则
-		if strings.HasPrefix(line, "-A ") {
-			m := reRule.FindStringSubmatch(line)
-			if len(m) >= 2 {
-				chain := m[1]
-				// 若规则出现于链头之前，先补一条链（罕见，但容错）
-				if _, ok := index[curTable][chain]; !ok {
-					cv := ChainView{
-						Order: len(out.Tables[curTable]),
-						Name:  chain,
-						Rules: make([]RuleView, 0, 8),
-					}
-					out.Tables[curTable] = append(out.Tables[curTable], cv)
-					index[curTable][chain] = len(out.Tables[curTable]) - 1
-				}
-				ci := index[curTable][chain]
-				rules := out.Tables[curTable][ci].Rules
-				rules = append(rules, RuleView{
-					Num: len(rules) + 1,
-					Raw: line,
-				})
-				out.Tables[curTable][ci].Rules = rules
+		for _, r := range t.Rules {
+			// 若规则出现于链头之前，先补一条链（罕见，但容错）
+			if _, ok := index[r.Chain]; !ok {
+				addChain(ChainView{Name: r.Chain})
+			}
+			ci := index[r.Chain]
+			rv := RuleView{
+				ID:  ids[r],
+				Num: len(chains[ci].Rules) + 1,
+				Raw: r.Line(),
+			}
+			if r.Counters != nil {
+				rv.Packets, rv.Bytes = r.Counters.Packets, r.Counters.Bytes
 			}
-			continue
+			chains[ci].Rules = append(chains[ci].Rules, rv)
 		}
+		out.Tables[t.Name] = chains
 	}
-	return out
+	return out, nil
 }
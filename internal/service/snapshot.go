@@ -0,0 +1,187 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"iptables-web/backend/internal/iptables"
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/repo"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+// 规则集快照：每次修改之前把当前规则集（iptables-save -c）存入数据库，形成每台主机每个协议族的修改历史
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotFailed   = errors.New("could not save the pre-change snapshot")
+)
+
+// maxSnapshotPage：列表单页上限
+const maxSnapshotPage = 200
+
+// snapshotKeep：每台主机每个协议族保留的快照条数，由配置 SNAPSHOT_KEEP 设置；<=0 不限
+var snapshotKeep = 200
+
+func SetSnapshotKeep(n int) { snapshotKeep = n }
+
+// recordSnapshot：在主机锁内、修改之前调用，返回快照 ID；保存失败时返回 ErrSnapshotFailed，调用方不应继续修改
+// 保存后按 snapshotKeep 清理该主机该协议族最旧的快照，清理失败只记日志
+func recordSnapshot(hostID uint, v6 bool, dump, rev string, opt WriteOptions) (uint, error) {
+	sum := sha256.Sum256([]byte(dump))
+	s := &models.RulesetSnapshot{
+		HostID:   hostID,
+		V6:       v6,
+		Author:   opt.Author,
+		Reason:   opt.Reason,
+		Hash:     hex.EncodeToString(sum[:]),
+		Revision: rev,
+		Size:     len(dump),
+		Content:  dump,
+	}
+	snaps := repo.NewSnapshotRepo()
+	if err := snaps.Create(s); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotFailed, err)
+	}
+	if snapshotKeep > 0 {
+		if _, err := snaps.PruneKeep(hostID, v6, snapshotKeep); err != nil {
+			log.Printf("[snapshot] host %d: prune: %v", hostID, err)
+		}
+	}
+	return s.ID, nil
+}
+
+// snapshotLive：不经 guardedWrite 的修改（立即回滚）在执行前调用
+func snapshotLive(cli *sshx.Client, hostID uint, v6 bool, opt WriteOptions) (uint, error) {
+	dump, err := cli.IptablesSave(v6, "-c")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotFailed, err)
+	}
+	rev, err := Revision(dump)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSnapshotFailed, err)
+	}
+	return recordSnapshot(hostID, v6, dump, rev, opt)
+}
+
+// StartSnapshotPruner：每隔 interval 删除早于 retention 的快照；retention<=0 不清理
+func StartSnapshotPruner(retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	snaps := repo.NewSnapshotRepo()
+	go func() {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		for {
+			if n, err := snaps.PruneBefore(time.Now().Add(-retention)); err != nil {
+				log.Printf("[snapshot] prune: %v", err)
+			} else if n > 0 {
+				log.Printf("[snapshot] pruned %d snapshot(s) older than %s", n, retention)
+			}
+			<-tk.C
+		}
+	}()
+}
+
+type SnapshotService struct {
+	hosts *repo.HostRepo
+	snaps *repo.SnapshotRepo
+	ops   *RulesOpsService
+}
+
+func NewSnapshotService() *SnapshotService {
+	return &SnapshotService{hosts: repo.NewHostRepo(), snaps: repo.NewSnapshotRepo(), ops: NewRulesOpsService()}
+}
+
+// SnapshotPage：按时间倒序的一页快照（不含内容）
+type SnapshotPage struct {
+	Items []models.RulesetSnapshot `json:"items"`
+	Total int64                    `json:"total"`
+}
+
+// List：v6 为 nil 时两个协议族都返回
+func (s *SnapshotService) List(hostID uint, v6 *bool, limit, offset int) (*SnapshotPage, error) {
+	if limit <= 0 || limit > maxSnapshotPage {
+		limit = maxSnapshotPage
+	}
+	items, total, err := s.snaps.List(hostID, v6, limit, max(offset, 0))
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []models.RulesetSnapshot{}
+	}
+	return &SnapshotPage{Items: items, Total: total}, nil
+}
+
+// Get：快照不属于该主机时同样视为不存在
+func (s *SnapshotService) Get(hostID, id uint) (*models.RulesetSnapshot, error) {
+	snap, err := s.snaps.Get(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && snap.HostID != hostID) {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+	}
+	return snap, err
+}
+
+// Diff：against 为 0 时比较线上规则集 → 快照（即恢复该快照会带来的变化），Revision 为线上版本号；
+// 否则比较快照 against → 快照 id（须为同一协议族）
+func (s *SnapshotService) Diff(hostID, id, against uint) (*RulesetDiff, error) {
+	snap, err := s.Get(hostID, id)
+	if err != nil {
+		return nil, err
+	}
+	next, err := iptables.Parse(snap.Content)
+	if err != nil {
+		return nil, fmt.Errorf("parse snapshot %d: %w", id, err)
+	}
+	name := fmt.Sprintf("snapshot-%d", id)
+	if against != 0 {
+		base, err := s.Get(hostID, against)
+		if err != nil {
+			return nil, err
+		}
+		if base.V6 != snap.V6 {
+			return nil, invalidf("snapshots %d and %d belong to different families", against, id)
+		}
+		cur, err := iptables.Parse(base.Content)
+		if err != nil {
+			return nil, fmt.Errorf("parse snapshot %d: %w", against, err)
+		}
+		return diffRulesets(cur, next, fmt.Sprintf("snapshot-%d", against), name), nil
+	}
+	cli, err := s.ops.cli(hostID)
+	if err != nil {
+		return nil, err
+	}
+	text, err := cli.IptablesSave(snap.V6)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := iptables.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse iptables-save: %w", err)
+	}
+	return diffRulesets(cur, next, "current", name), nil
+}
+
+// Restore：以导入的方式恢复快照（整表替换快照中出现的表，计数器不恢复）；
+// 与其他写操作一样要求 If-Match，经过防锁死检查，并在恢复前再存一次快照
+func (s *SnapshotService) Restore(hostID, id uint, opt WriteOptions) (WriteResult, error) {
+	snap, err := s.Get(hostID, id)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	if opt.Reason == "" {
+		opt.Reason = fmt.Sprintf("restore snapshot #%d", id)
+	}
+	return s.ops.Import(hostID, snap.V6, snap.Content, opt)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"iptables-web/backend/internal/models"
+	"iptables-web/backend/internal/repo"
+)
+
+func dumpWithCounters(pkts int) string {
+	return fmt.Sprintf("# Generated by iptables-save\n*filter\n:INPUT ACCEPT [%d:0]\n:FORWARD ACCEPT [0:0]\n:OUTPUT ACCEPT [0:0]\n[%d:0] -A INPUT -p tcp -m tcp --dport 22 -j ACCEPT\nCOMMIT\n", pkts, pkts)
+}
+
+func TestRecordSnapshot(t *testing.T) {
+	const hostID = 9001
+	defer repo.NewSnapshotRepo().DeleteByHost(hostID)
+
+	a, b := dumpWithCounters(1), dumpWithCounters(2)
+	revA, err := Revision(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revB, _ := Revision(b)
+	if revA != revB {
+		t.Fatal("revision should ignore counters")
+	}
+	opt := WriteOptions{Author: "ops", Reason: "test"}
+	idA, errA := recordSnapshot(hostID, false, a, revA, opt)
+	idB, errB := recordSnapshot(hostID, false, b, revB, opt)
+	if errA != nil || errB != nil || idA == 0 || idB == 0 {
+		t.Fatalf("recordSnapshot = %d, %v / %d, %v", idA, errA, idB, errB)
+	}
+
+	svc := NewSnapshotService()
+	sa, err := svc.Get(hostID, idA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, _ := svc.Get(hostID, idB)
+	sum := sha256.Sum256([]byte(a))
+	if sa.Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash = %s, want sha256 of the content", sa.Hash)
+	}
+	// 内容不同的快照 hash 不同，版本号可以相同
+	if sa.Hash == sb.Hash || sa.Revision != revA || sb.Revision != revA {
+		t.Errorf("hash %s / %s, revision %s / %s", sa.Hash, sb.Hash, sa.Revision, sb.Revision)
+	}
+	if sa.Content != a || sa.Size != len(a) || sa.Author != "ops" || sa.Reason != "test" {
+		t.Errorf("stored snapshot = %+v", sa)
+	}
+	if _, err := svc.Get(hostID+1, idA); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("snapshot of another host: err = %v, want ErrSnapshotNotFound", err)
+	}
+}
+
+func TestSnapshotKeep(t *testing.T) {
+	const hostID = 9002
+	snaps := repo.NewSnapshotRepo()
+	defer snaps.DeleteByHost(hostID)
+	defer SetSnapshotKeep(snapshotKeep)
+	SetSnapshotKeep(3)
+
+	var ids []uint
+	for i := 0; i < 5; i++ {
+		d := dumpWithCounters(i)
+		rev, _ := Revision(d)
+		id, err := recordSnapshot(hostID, false, d, rev, WriteOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// 另一协议族不受影响
+	v6, err := recordSnapshot(hostID, true, dumpWithCounters(0), "", WriteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v4 := false
+	items, total, err := snaps.List(hostID, &v4, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(items) != 3 || items[0].ID != ids[4] || items[2].ID != ids[2] {
+		t.Errorf("kept %d snapshot(s) %+v, want the latest 3 of %v", total, items, ids)
+	}
+	if _, err := snaps.Get(v6); err != nil {
+		t.Errorf("v6 snapshot pruned: %v", err)
+	}
+}
+
+func TestSnapshotPruneBefore(t *testing.T) {
+	const hostID = 9003
+	snaps := repo.NewSnapshotRepo()
+	defer snaps.DeleteByHost(hostID)
+
+	old := &models.RulesetSnapshot{HostID: hostID, CreatedAt: time.Now().Add(-48 * time.Hour), Content: "old"}
+	recent := &models.RulesetSnapshot{HostID: hostID, Content: "recent"}
+	for _, s := range []*models.RulesetSnapshot{old, recent} {
+		if err := snaps.Create(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := snaps.PruneBefore(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snaps.Get(old.ID); err == nil {
+		t.Error("old snapshot not pruned")
+	}
+	if _, err := snaps.Get(recent.ID); err != nil {
+		t.Errorf("recent snapshot pruned: %v", err)
+	}
+}
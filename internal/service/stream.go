@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"iptables-web/backend/internal/iptables"
+	"iptables-web/backend/internal/models"
+	sshx "iptables-web/backend/internal/ssh"
+)
+
+// 支持流式输出的操作
+const (
+	StreamOpSave        = "save"         // iptables-save
+	StreamOpRestore     = "restore"      // iptables-restore -v
+	StreamOpRestoreTest = "restore-test" // iptables-restore --test -v（只校验不生效）
+	StreamOpPing        = "ping"         // 在目标主机上 ping 指定地址
+)
+
+var pingTargetRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.:-]{0,252}$`)
+
+type StreamInput struct {
+	HostIDs []uint
+	Op      string
+	V6      bool
+	Content string // restore / restore-test
+
+	Target string // ping
+	Count  int    // ping，默认 4
+
+	Author       string // restore：记入修改前快照的操作者
+	AllowLockout bool   // restore：防锁死模拟显示有风险时仍然执行
+
+	// restore：各主机读到的版本号（相当于逐台的 If-Match），缺少时拒绝执行；Force 时不校验
+	Revisions map[uint]string
+	Force     bool
+}
+
+// StreamLine：某台主机输出的一行
+type StreamLine struct {
+	HostID uint   `json:"host_id"`
+	Stream string `json:"stream"` // stdout | stderr
+	Line   string `json:"line"`
+}
+
+// StreamDone：某台主机执行结束
+type StreamDone struct {
+	HostID uint   `json:"host_id"`
+	Code   int    `json:"code"`
+	Error  string `json:"error,omitempty"`
+	Spent  string `json:"spent"`
+}
+
+type StreamService struct{ ops *RulesOpsService }
+
+func NewStreamService() *StreamService { return &StreamService{ops: NewRulesOpsService()} }
+
+// Prepare：先校验参数并加载全部主机，出错时还没开始输出，调用方可以正常返回 4xx
+func (s *StreamService) Prepare(in StreamInput) ([]models.Host, sshx.Command, error) {
+	if len(in.HostIDs) == 0 {
+		return nil, sshx.Command{}, errors.New("host_ids required")
+	}
+	cmd, err := streamCommand(in)
+	if err != nil {
+		return nil, cmd, err
+	}
+	if in.Op == StreamOpRestore {
+		if err := checkHostRevisions(in.Revisions, in.Force, in.HostIDs); err != nil {
+			return nil, cmd, err
+		}
+	}
+	hs := make([]models.Host, 0, len(in.HostIDs))
+	seen := map[uint]bool{}
+	for _, id := range in.HostIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		h, err := s.ops.hosts.Get(id)
+		if err != nil {
+			return nil, cmd, fmt.Errorf("host %d: %w", id, err)
+		}
+		h.Normalize()
+		hs = append(hs, *h)
+	}
+	return hs, cmd, nil
+}
+
+// Run：多台主机并发执行，按行回调；ctx 取消（客户端断开）时各主机上的进程被 SIGKILL
+// in 为 Prepare 的输入；restore 与同步写接口一样经 guardedWrite 执行（主机锁、If-Match、待确认变更检查、防锁死检查、修改前快照），
+// If-Match 取 in.Revisions 中该主机的版本号
+// 回调可能来自多个协程，调用方自行保证并发安全
+func (s *StreamService) Run(ctx context.Context, in StreamInput, hs []models.Host, cmd sshx.Command,
+	onLine func(StreamLine), onDone func(StreamDone)) {
+	var wg sync.WaitGroup
+	for _, h := range hs {
+		h := h
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cli := sshx.Get(h)
+			run := func() sshx.Result {
+				return cli.ExecStream(ctx, cmd.Raw,
+					func(line string) { onLine(StreamLine{HostID: h.ID, Stream: "stdout", Line: line}) },
+					func(line string) { onLine(StreamLine{HostID: h.ID, Stream: "stderr", Line: line}) },
+					sshx.WithShell(cmd.Shell), sshx.WithStdin(cmd.Stdin), sshx.WithTimeout(cmd.Timeout),
+				)
+			}
+			var res sshx.Result
+			if in.Op == StreamOpRestore {
+				res = guardedRestore(cli, h.ID, in, run)
+			} else {
+				res = run()
+			}
+			d := StreamDone{HostID: h.ID, Code: res.Code, Spent: res.Spent.Round(time.Millisecond).String()}
+			if res.Err != nil {
+				d.Error = res.Err.Error()
+			}
+			onDone(d)
+		}()
+	}
+	wg.Wait()
+}
+
+func guardedRestore(cli *sshx.Client, hostID uint, in StreamInput, run func() sshx.Result) sshx.Result {
+	opt := WriteOptions{IfMatch: hostIfMatch(in.Revisions, in.Force, hostID), AllowLockout: in.AllowLockout, Author: in.Author, Reason: "stream restore"}
+	preview := func(rs *iptables.Ruleset) error {
+		_, err := importPreview(rs, in.Content)
+		return err
+	}
+	var res sshx.Result
+	ran := false
+	_, err := guardedWrite(cli, hostID, in.V6, opt, preview, func() error {
+		ran = true
+		res = run()
+		return res.Err
+	})
+	if !ran && err != nil {
+		return sshx.Result{Err: err, Code: 1}
+	}
+	return res
+}
+
+func streamCommand(in StreamInput) (sshx.Command, error) {
+	// 与 jobCommand 一样用命令名，由 Shell 模式设置的 PATH（含 /sbin、/usr/local/sbin）查找
+	save, restore := "iptables-save", "iptables-restore"
+	if in.V6 {
+		save, restore = "ip6tables-save", "ip6tables-restore"
+	}
+	cmd := sshx.Command{Shell: true}
+	switch in.Op {
+	case StreamOpSave:
+		cmd.Raw = save
+	case StreamOpRestore, StreamOpRestoreTest:
+		if strings.TrimSpace(in.Content) == "" {
+			return cmd, errors.New("content required")
+		}
+		cmd.Raw = restore + " -v"
+		if in.Op == StreamOpRestoreTest {
+			cmd.Raw = restore + " --test -v"
+		}
+		cmd.Stdin = in.Content
+		// 大规则集可能较慢，不受默认命令超时限制
+		cmd.Timeout = 10 * time.Minute
+	case StreamOpPing:
+		target := strings.TrimSpace(in.Target)
+		if !pingTargetRe.MatchString(target) {
+			return cmd, errors.New("invalid ping target")
+		}
+		count := in.Count
+		if count <= 0 {
+			count = 4
+		}
+		if count > 100 {
+			return cmd, errors.New("count must be <= 100")
+		}
+		bin := "ping"
+		if in.V6 {
+			bin = "ping -6"
+		}
+		cmd.Raw = fmt.Sprintf("%s -c %d %s", bin, count, target)
+		cmd.Timeout = time.Duration(count)*time.Second + 30*time.Second
+	default:
+		return cmd, fmt.Errorf("unsupported op %q", in.Op)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,574 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// TargetOptions：按 target 分开的类型化选项，只能填与 Action 对应的那一项
+// DNAT / SNAT / REDIRECT 仍使用 RuleInput.ToSource / ToPort
+type TargetOptions struct {
+	Reject     *RejectOptions     `json:"reject,omitempty"`
+	Log        *LogOptions        `json:"log,omitempty"`
+	NFLog      *NFLogOptions      `json:"nflog,omitempty"`
+	Mark       *MarkOptions       `json:"mark,omitempty"`
+	ConnMark   *ConnMarkOptions   `json:"connmark,omitempty"`
+	TCPMSS     *TCPMSSOptions     `json:"tcpmss,omitempty"`
+	CT         *CTOptions         `json:"ct,omitempty"`
+	Masquerade *MasqueradeOptions `json:"masquerade,omitempty"`
+	TEE        *TEEOptions        `json:"tee,omitempty"`
+
+	// 解析时未识别的选项（只读，提交时必须为空）
+	Other []MatchOption `json:"other,omitempty"`
+}
+
+type RejectOptions struct {
+	RejectWith string `json:"rejectWith,omitempty"` // icmp-port-unreachable / tcp-reset / ...
+}
+
+type LogOptions struct {
+	Prefix      string `json:"prefix,omitempty"` // 最长 29 字符
+	Level       string `json:"level,omitempty"`  // 0-7 或 emerg/alert/crit/err/warning/notice/info/debug
+	TCPSequence bool   `json:"tcpSequence,omitempty"`
+	TCPOptions  bool   `json:"tcpOptions,omitempty"`
+	IPOptions   bool   `json:"ipOptions,omitempty"`
+	UID         bool   `json:"uid,omitempty"`
+	MACDecode   bool   `json:"macDecode,omitempty"`
+}
+
+type NFLogOptions struct {
+	Group     *int   `json:"group,omitempty"`  // 0-65535
+	Prefix    string `json:"prefix,omitempty"` // 最长 64 字符
+	Size      *int   `json:"size,omitempty"`   // 拷贝到用户态的字节数
+	Threshold *int   `json:"threshold,omitempty"`
+}
+
+// MarkOptions：五选一；值为 value 或 value/mask
+type MarkOptions struct {
+	SetXMark string `json:"setXmark,omitempty"`
+	SetMark  string `json:"setMark,omitempty"`
+	AndMark  string `json:"andMark,omitempty"`
+	OrMark   string `json:"orMark,omitempty"`
+	XorMark  string `json:"xorMark,omitempty"`
+}
+
+// ConnMarkOptions：set / save / restore 三选一
+type ConnMarkOptions struct {
+	SetXMark    string `json:"setXmark,omitempty"`
+	SetMark     string `json:"setMark,omitempty"`
+	SaveMark    bool   `json:"saveMark,omitempty"`
+	RestoreMark bool   `json:"restoreMark,omitempty"`
+	Mask        string `json:"mask,omitempty"`   // save / restore
+	NfMask      string `json:"nfmask,omitempty"` // save / restore
+	CtMask      string `json:"ctmask,omitempty"` // save / restore
+}
+
+// TCPMSSOptions：二选一
+type TCPMSSOptions struct {
+	SetMSS         *int `json:"setMss,omitempty"`
+	ClampMSSToPMTU bool `json:"clampMssToPmtu,omitempty"`
+}
+
+type CTOptions struct {
+	NoTrack   bool     `json:"notrack,omitempty"`
+	Helper    string   `json:"helper,omitempty"`
+	Zone      *int     `json:"zone,omitempty"`
+	CTEvents  []string `json:"ctevents,omitempty"`
+	ExpEvents []string `json:"expevents,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"` // nfct timeout 策略名
+}
+
+type MasqueradeOptions struct {
+	ToPorts     string `json:"toPorts,omitempty"` // port 或 port-port
+	Random      bool   `json:"random,omitempty"`
+	RandomFully bool   `json:"randomFully,omitempty"`
+}
+
+type TEEOptions struct {
+	Gateway string `json:"gateway"`
+}
+
+var (
+	reMarkValue = regexp.MustCompile(`^(0x[0-9a-fA-F]{1,8}|\d{1,10})$`)
+	rePortRange = regexp.MustCompile(`^\d{1,5}(-\d{1,5})?$`)
+	reHelper    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,16}$`)
+
+	rejectWith4 = []string{
+		"icmp-net-unreachable", "icmp-host-unreachable", "icmp-port-unreachable", "icmp-proto-unreachable",
+		"icmp-net-prohibited", "icmp-host-prohibited", "icmp-admin-prohibited", "tcp-reset",
+	}
+	rejectWith6 = []string{
+		"icmp6-no-route", "no-route", "icmp6-adm-prohibited", "adm-prohibited",
+		"icmp6-addr-unreachable", "addr-unreach", "icmp6-port-unreachable", "port-unreach",
+		"icmp6-policy-fail", "policy-fail", "icmp6-reject-route", "reject-route", "tcp-reset",
+	}
+	logLevels = []string{"emerg", "alert", "crit", "err", "error", "warning", "warn", "notice", "info", "debug"}
+	ctEvents  = []string{"new", "related", "destroy", "reply", "assured", "protoinfo", "helper", "mark", "natseqinfo", "secmark"}
+)
+
+// targetTables：target 只能用在这些表里（空表示不限）
+var targetTables = map[string][]string{
+	"MARK":       {"mangle"},
+	"CONNMARK":   {"mangle"},
+	"TCPMSS":     {"mangle", "filter"},
+	"CT":         {"raw"},
+	"MASQUERADE": {"nat"},
+	"TEE":        {"mangle"},
+}
+
+// countSet：“多选一”校验用
+func countSet(vs ...bool) int {
+	n := 0
+	for _, v := range vs {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+func inRange(p *int, lo, hi int) bool { return p == nil || (*p >= lo && *p <= hi) }
+
+// validateTarget：选项必须与 action 对应，逐项校验
+func validateTarget(v6 bool, table, protocol, action string, o *TargetOptions) error {
+	if ts, ok := targetTables[action]; ok && !contains(ts, table) {
+		return fmt.Errorf("target %s is only valid in table %s", action, strings.Join(ts, "/"))
+	}
+	if o == nil {
+		switch action {
+		case "TEE":
+			return fmt.Errorf("target TEE requires targetOptions.tee.gateway")
+		case "MARK", "CONNMARK", "TCPMSS":
+			return fmt.Errorf("target %s requires targetOptions", action)
+		}
+		return nil
+	}
+	if len(o.Other) > 0 {
+		return fmt.Errorf("targetOptions.other is read-only")
+	}
+	given := map[string]bool{
+		"REJECT": o.Reject != nil, "LOG": o.Log != nil, "NFLOG": o.NFLog != nil,
+		"MARK": o.Mark != nil, "CONNMARK": o.ConnMark != nil, "TCPMSS": o.TCPMSS != nil,
+		"CT": o.CT != nil, "MASQUERADE": o.Masquerade != nil, "TEE": o.TEE != nil,
+	}
+	for t, ok := range given {
+		if ok && t != action {
+			return fmt.Errorf("targetOptions.%s given but action is %q", strings.ToLower(t), action)
+		}
+	}
+
+	switch action {
+	case "REJECT":
+		if w := o.Reject.RejectWith; w != "" {
+			allowed := rejectWith4
+			if v6 {
+				allowed = rejectWith6
+			}
+			if !contains(allowed, w) {
+				return fmt.Errorf("invalid --reject-with %q", w)
+			}
+			if w == "tcp-reset" && strings.ToLower(protocol) != "tcp" {
+				return fmt.Errorf("--reject-with tcp-reset requires protocol tcp")
+			}
+		}
+	case "LOG":
+		if len(o.Log.Prefix) > 29 {
+			return fmt.Errorf("--log-prefix is longer than 29 characters")
+		}
+		if err := iptables.CheckValue(o.Log.Prefix); err != nil {
+			return fmt.Errorf("--log-prefix: %v", err)
+		}
+		if l := o.Log.Level; l != "" {
+			n, err := strconv.Atoi(l)
+			if (err != nil || n < 0 || n > 7) && !contains(logLevels, strings.ToLower(l)) {
+				return fmt.Errorf("invalid --log-level %q", l)
+			}
+		}
+	case "NFLOG":
+		x := o.NFLog
+		if len(x.Prefix) > 64 {
+			return fmt.Errorf("--nflog-prefix is longer than 64 characters")
+		}
+		if err := iptables.CheckValue(x.Prefix); err != nil {
+			return fmt.Errorf("--nflog-prefix: %v", err)
+		}
+		if !inRange(x.Group, 0, 65535) || !inRange(x.Size, 0, 1<<30) || !inRange(x.Threshold, 1, 65535) {
+			return fmt.Errorf("nflog group/size/threshold out of range")
+		}
+	case "MARK":
+		x := o.Mark
+		if countSet(x.SetXMark != "", x.SetMark != "", x.AndMark != "", x.OrMark != "", x.XorMark != "") != 1 {
+			return fmt.Errorf("MARK requires exactly one of setXmark/setMark/andMark/orMark/xorMark")
+		}
+		for _, v := range []string{x.SetXMark, x.SetMark} {
+			if v != "" && !reMark.MatchString(v) {
+				return fmt.Errorf("invalid mark %q", v)
+			}
+		}
+		for _, v := range []string{x.AndMark, x.OrMark, x.XorMark} {
+			if v != "" && !reMarkValue.MatchString(v) {
+				return fmt.Errorf("invalid mark %q", v)
+			}
+		}
+	case "CONNMARK":
+		x := o.ConnMark
+		set := x.SetXMark != "" || x.SetMark != ""
+		if countSet(x.SetXMark != "", x.SetMark != "", x.SaveMark, x.RestoreMark) != 1 {
+			return fmt.Errorf("CONNMARK requires exactly one of setXmark/setMark/saveMark/restoreMark")
+		}
+		for _, v := range []string{x.SetXMark, x.SetMark} {
+			if v != "" && !reMark.MatchString(v) {
+				return fmt.Errorf("invalid mark %q", v)
+			}
+		}
+		for _, v := range []string{x.Mask, x.NfMask, x.CtMask} {
+			if v == "" {
+				continue
+			}
+			if set {
+				return fmt.Errorf("mask/nfmask/ctmask only apply to saveMark/restoreMark")
+			}
+			if !reMarkValue.MatchString(v) {
+				return fmt.Errorf("invalid mask %q", v)
+			}
+		}
+	case "TCPMSS":
+		x := o.TCPMSS
+		if countSet(x.SetMSS != nil, x.ClampMSSToPMTU) != 1 {
+			return fmt.Errorf("TCPMSS requires exactly one of setMss/clampMssToPmtu")
+		}
+		if !inRange(x.SetMSS, 1, 65495) {
+			return fmt.Errorf("--set-mss out of range")
+		}
+		if strings.ToLower(protocol) != "tcp" {
+			return fmt.Errorf("target TCPMSS requires protocol tcp")
+		}
+	case "CT":
+		x := o.CT
+		if x.NoTrack && (x.Helper != "" || x.Zone != nil || len(x.CTEvents) > 0 || len(x.ExpEvents) > 0 || x.Timeout != "") {
+			return fmt.Errorf("CT --notrack cannot be combined with other options")
+		}
+		if x.Helper != "" && !reHelper.MatchString(x.Helper) {
+			return fmt.Errorf("invalid CT helper %q", x.Helper)
+		}
+		if x.Timeout != "" && !reHelper.MatchString(x.Timeout) {
+			return fmt.Errorf("invalid CT timeout policy %q", x.Timeout)
+		}
+		if !inRange(x.Zone, 0, 65535) {
+			return fmt.Errorf("CT zone out of range")
+		}
+		for _, e := range append(append([]string{}, x.CTEvents...), x.ExpEvents...) {
+			if !contains(ctEvents, e) {
+				return fmt.Errorf("invalid CT event %q", e)
+			}
+		}
+	case "MASQUERADE":
+		x := o.Masquerade
+		if x.ToPorts != "" {
+			if !rePortRange.MatchString(x.ToPorts) {
+				return fmt.Errorf("invalid --to-ports %q", x.ToPorts)
+			}
+			if p := strings.ToLower(protocol); p != "tcp" && p != "udp" && p != "sctp" && p != "dccp" {
+				return fmt.Errorf("MASQUERADE --to-ports requires protocol tcp/udp/sctp/dccp")
+			}
+		}
+	case "TEE":
+		ip := net.ParseIP(o.TEE.Gateway)
+		if ip == nil || (ip.To4() == nil) != v6 {
+			return fmt.Errorf("invalid TEE gateway %q", o.TEE.Gateway)
+		}
+	}
+	return nil
+}
+
+// targetArgs：-j ACTION 之后的选项
+func targetArgs(action string, o *TargetOptions) []string {
+	if o == nil {
+		return nil
+	}
+	var args []string
+	add := func(name string, vals ...string) { args = append(args, name); args = append(args, vals...) }
+	addIf := func(ok bool, name string) {
+		if ok {
+			add(name)
+		}
+	}
+	addStr := func(name, v string) {
+		if v != "" {
+			add(name, v)
+		}
+	}
+	addInt := func(name string, v *int) {
+		if v != nil {
+			add(name, strconv.Itoa(*v))
+		}
+	}
+
+	switch action {
+	case "REJECT":
+		addStr("--reject-with", o.Reject.RejectWith)
+	case "LOG":
+		x := o.Log
+		addStr("--log-prefix", x.Prefix)
+		addStr("--log-level", x.Level)
+		addIf(x.TCPSequence, "--log-tcp-sequence")
+		addIf(x.TCPOptions, "--log-tcp-options")
+		addIf(x.IPOptions, "--log-ip-options")
+		addIf(x.UID, "--log-uid")
+		addIf(x.MACDecode, "--log-macdecode")
+	case "NFLOG":
+		x := o.NFLog
+		addInt("--nflog-group", x.Group)
+		addStr("--nflog-prefix", x.Prefix)
+		addInt("--nflog-size", x.Size)
+		addInt("--nflog-threshold", x.Threshold)
+	case "MARK":
+		x := o.Mark
+		addStr("--set-xmark", x.SetXMark)
+		addStr("--set-mark", x.SetMark)
+		addStr("--and-mark", x.AndMark)
+		addStr("--or-mark", x.OrMark)
+		addStr("--xor-mark", x.XorMark)
+	case "CONNMARK":
+		x := o.ConnMark
+		addStr("--set-xmark", x.SetXMark)
+		addStr("--set-mark", x.SetMark)
+		addIf(x.SaveMark, "--save-mark")
+		addIf(x.RestoreMark, "--restore-mark")
+		addStr("--mask", x.Mask)
+		addStr("--nfmask", x.NfMask)
+		addStr("--ctmask", x.CtMask)
+	case "TCPMSS":
+		addInt("--set-mss", o.TCPMSS.SetMSS)
+		addIf(o.TCPMSS.ClampMSSToPMTU, "--clamp-mss-to-pmtu")
+	case "CT":
+		x := o.CT
+		addIf(x.NoTrack, "--notrack")
+		addStr("--helper", x.Helper)
+		addInt("--zone", x.Zone)
+		if len(x.CTEvents) > 0 {
+			add("--ctevents", strings.Join(x.CTEvents, ","))
+		}
+		if len(x.ExpEvents) > 0 {
+			add("--expevents", strings.Join(x.ExpEvents, ","))
+		}
+		addStr("--timeout", x.Timeout)
+	case "MASQUERADE":
+		addStr("--to-ports", o.Masquerade.ToPorts)
+		addIf(o.Masquerade.Random, "--random")
+		addIf(o.Masquerade.RandomFully, "--random-fully")
+	case "TEE":
+		addStr("--gateway", o.TEE.Gateway)
+	}
+	return args
+}
+
+// targetOptionsFromAST：把 iptables-save 中的 target 选项解析回类型化结构；不认识的选项放进 Other
+func targetOptionsFromAST(t *iptables.Target) *TargetOptions {
+	if t == nil || len(t.Options) == 0 {
+		return nil
+	}
+	o := &TargetOptions{}
+	atoi := func(v string) *int {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	split := func(v string) []string {
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}
+
+	var handle func(opt *iptables.Option) bool
+	switch t.Name {
+	case "REJECT":
+		o.Reject = &RejectOptions{}
+		handle = func(x *iptables.Option) bool {
+			if x.Name != "--reject-with" {
+				return false
+			}
+			o.Reject.RejectWith = x.Value()
+			return true
+		}
+	case "LOG":
+		o.Log = &LogOptions{}
+		l := o.Log
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--log-prefix":
+				l.Prefix = x.Value()
+			case "--log-level":
+				l.Level = x.Value()
+			case "--log-tcp-sequence":
+				l.TCPSequence = true
+			case "--log-tcp-options":
+				l.TCPOptions = true
+			case "--log-ip-options":
+				l.IPOptions = true
+			case "--log-uid":
+				l.UID = true
+			case "--log-macdecode":
+				l.MACDecode = true
+			default:
+				return false
+			}
+			return true
+		}
+	case "NFLOG":
+		o.NFLog = &NFLogOptions{}
+		l := o.NFLog
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--nflog-group":
+				l.Group = atoi(x.Value())
+			case "--nflog-prefix":
+				l.Prefix = x.Value()
+			case "--nflog-size", "--nflog-range":
+				l.Size = atoi(x.Value())
+			case "--nflog-threshold":
+				l.Threshold = atoi(x.Value())
+			default:
+				return false
+			}
+			return true
+		}
+	case "MARK":
+		o.Mark = &MarkOptions{}
+		m := o.Mark
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--set-xmark":
+				m.SetXMark = x.Value()
+			case "--set-mark":
+				m.SetMark = x.Value()
+			case "--and-mark":
+				m.AndMark = x.Value()
+			case "--or-mark":
+				m.OrMark = x.Value()
+			case "--xor-mark":
+				m.XorMark = x.Value()
+			default:
+				return false
+			}
+			return true
+		}
+	case "CONNMARK":
+		o.ConnMark = &ConnMarkOptions{}
+		m := o.ConnMark
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--set-xmark":
+				m.SetXMark = x.Value()
+			case "--set-mark":
+				m.SetMark = x.Value()
+			case "--save-mark":
+				m.SaveMark = true
+			case "--restore-mark":
+				m.RestoreMark = true
+			case "--mask":
+				m.Mask = x.Value()
+			case "--nfmask":
+				m.NfMask = x.Value()
+			case "--ctmask":
+				m.CtMask = x.Value()
+			default:
+				return false
+			}
+			return true
+		}
+	case "TCPMSS":
+		o.TCPMSS = &TCPMSSOptions{}
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--set-mss":
+				o.TCPMSS.SetMSS = atoi(x.Value())
+			case "--clamp-mss-to-pmtu":
+				o.TCPMSS.ClampMSSToPMTU = true
+			default:
+				return false
+			}
+			return true
+		}
+	case "CT":
+		o.CT = &CTOptions{}
+		c := o.CT
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--notrack":
+				c.NoTrack = true
+			case "--helper":
+				c.Helper = x.Value()
+			case "--zone":
+				c.Zone = atoi(x.Value())
+			case "--ctevents":
+				c.CTEvents = split(x.Value())
+			case "--expevents":
+				c.ExpEvents = split(x.Value())
+			case "--timeout":
+				c.Timeout = x.Value()
+			default:
+				return false
+			}
+			return true
+		}
+	case "MASQUERADE":
+		o.Masquerade = &MasqueradeOptions{}
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--to-ports":
+				o.Masquerade.ToPorts = x.Value()
+			case "--random":
+				o.Masquerade.Random = true
+			case "--random-fully":
+				o.Masquerade.RandomFully = true
+			default:
+				return false
+			}
+			return true
+		}
+	case "TEE":
+		o.TEE = &TEEOptions{}
+		handle = func(x *iptables.Option) bool {
+			if x.Name != "--gateway" {
+				return false
+			}
+			o.TEE.Gateway = x.Value()
+			return true
+		}
+	case "DNAT", "SNAT", "REDIRECT":
+		// 由 ToSource / ToPort 承载
+		handle = func(x *iptables.Option) bool {
+			switch x.Name {
+			case "--to-destination", "--to-source", "--to-ports":
+				return true
+			}
+			return false
+		}
+	default:
+		handle = func(*iptables.Option) bool { return false }
+	}
+
+	for _, x := range t.Options {
+		if x.Negated || !handle(x) {
+			o.Other = append(o.Other, MatchOption{Name: x.Name, Values: append([]string(nil), x.Values...), Negate: x.Negated})
+		}
+	}
+	if o.empty() {
+		return nil
+	}
+	return o
+}
+
+func (o *TargetOptions) empty() bool {
+	return o.Reject == nil && o.Log == nil && o.NFLog == nil && o.Mark == nil && o.ConnMark == nil &&
+		o.TCPMSS == nil && o.CT == nil && o.Masquerade == nil && o.TEE == nil && len(o.Other) == 0
+}
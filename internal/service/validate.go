@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"iptables-web/backend/internal/iptables"
+)
+
+// ErrInvalidInput：参数校验失败（handler 映射为 400，不会触达远端）
+var ErrInvalidInput = errors.New("invalid input")
+
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidInput, fmt.Sprintf(format, args...))
+}
+
+var (
+	tables = []string{"filter", "nat", "mangle", "raw", "security"}
+
+	// 链名 / target 名：iptables 限制 28 字符；不允许以 "-" 或 "!" 开头，免得被当成选项
+	reChainName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,27}$`)
+	// match 模块名
+	reModuleName = regexp.MustCompile(`^[a-z0-9_][a-z0-9_-]{0,28}$`)
+)
+
+func validateTable(table string) error {
+	if !contains(tables, table) {
+		return invalidf("unknown table %q", table)
+	}
+	return nil
+}
+
+func validateChainName(name string) error {
+	if !reChainName.MatchString(name) {
+		return invalidf("invalid chain name %q", name)
+	}
+	return nil
+}
+
+// validateTableChain：chain 为空时只校验表（整表 -F / -Z）
+func validateTableChain(table, chain string) error {
+	if err := validateTable(table); err != nil {
+		return err
+	}
+	if chain == "" {
+		return nil
+	}
+	return validateChainName(chain)
+}
+
+// 规则片段里允许出现的通用参数
+var allowedParams = []string{
+	"-p", "--protocol",
+	"-s", "--source", "--src",
+	"-d", "--destination", "--dst",
+	"-i", "--in-interface",
+	"-o", "--out-interface",
+	"-f", "--fragment",
+	"-4", "--ipv4", "-6", "--ipv6",
+}
+
+// 无论出现在哪都拒绝的选项：--modprobe 会以 root 执行任意程序，其余会改变命令本身
+var forbiddenOptions = []string{
+	"--modprobe", "--table", "--wait", "--wait-interval",
+	"--append", "--insert", "--delete", "--replace", "--check",
+	"--flush", "--zero", "--new-chain", "--delete-chain", "--policy", "--rename-chain",
+	"--list", "--list-rules", "--line-numbers", "--numeric", "--exact", "--verbose",
+	"--set-counters",
+}
+
+// iptables 自身的全部长选项。iptables 用 getopt_long 解析，任何无歧义的前缀都会被展开，
+// 所以 --tab / --modp=... 同样是 --table / --modprobe
+var baseOptions = append([]string{
+	"--protocol", "--source", "--src", "--destination", "--dst",
+	"--in-interface", "--out-interface", "--fragment", "--ipv4", "--ipv6",
+	"--jump", "--goto", "--match", "--help", "--version",
+}, forbiddenOptions...)
+
+// checkLongOption：拒绝禁用选项以及会被 getopt_long 展开成 iptables 自身选项的缩写
+// 扩展模块恰好定义了同名选项时（如 recent 的 --set）按精确匹配处理，不算缩写
+func checkLongOption(name string) error {
+	name, _, _ = strings.Cut(name, "=")
+	if name == "--" || contains(forbiddenOptions, name) {
+		return invalidf("option %s is not allowed", name)
+	}
+	if isModuleOption(name) {
+		return nil
+	}
+	for _, b := range baseOptions {
+		if strings.HasPrefix(b, name) {
+			return invalidf("option %s is an abbreviation of %s", name, b)
+		}
+	}
+	return nil
+}
+
+// isModuleOption：name 是否为白名单中某个 match 模块的选项
+func isModuleOption(name string) bool {
+	for _, m := range matchModules {
+		if _, ok := m.options[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleSpecArgs：把 /api/rules/append|insert 的原始规则片段解析成 argv，并按白名单校验
+// 扩展模块的选项都是长选项；短选项只允许 allowedParams 里的通用参数
+func ruleSpecArgs(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, invalidf("rule required")
+	}
+	if strings.ContainsAny(spec, "\r\n\x00") {
+		return nil, invalidf("rule must be a single line")
+	}
+	r, err := iptables.ParseRuleSpec(spec)
+	if err != nil {
+		return nil, invalidf("rule: %v", err)
+	}
+
+	checkOpt := func(where string, o *iptables.Option) error {
+		if !strings.HasPrefix(o.Name, "--") {
+			return invalidf("option %s is not allowed in %s", o.Name, where)
+		}
+		return checkLongOption(o.Name)
+	}
+	for _, o := range r.Params {
+		if !contains(allowedParams, o.Name) {
+			return nil, invalidf("option %s is not allowed", o.Name)
+		}
+	}
+	for _, m := range r.Matches {
+		where := "match " + m.Module
+		if m.Module == "" {
+			where = "rule"
+		}
+		for _, o := range m.Options {
+			if err := checkOpt(where, o); err != nil {
+				return nil, err
+			}
+		}
+		if m.Implicit && m.Module == "" {
+			return nil, invalidf("option %s requires -p or -m", m.Options[0].Name)
+		}
+		if !reModuleName.MatchString(strings.ToLower(m.Module)) {
+			return nil, invalidf("invalid match module %q", m.Module)
+		}
+	}
+	if t := r.Target; t != nil {
+		if err := validateChainName(t.Name); err != nil {
+			return nil, invalidf("invalid target %q", t.Name)
+		}
+		for _, o := range t.Options {
+			if err := checkOpt("target "+t.Name, o); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r.Args(), nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRuleSpecArgs(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []string // nil 表示应当拒绝
+	}{
+		{"-p tcp --dport 22 -j ACCEPT", []string{"-p", "tcp", "--dport", "22", "-j", "ACCEPT"}},
+		{"-s 10.0.0.0/8 -m comment --comment \"allow lan\" -j ACCEPT",
+			[]string{"-s", "10.0.0.0/8", "-m", "comment", "--comment", "allow lan", "-j", "ACCEPT"}},
+		{"-m recent --name ssh --set", []string{"-m", "recent", "--name", "ssh", "--set"}},
+		{"-m conntrack --ctstate NEW -j LOG --log-prefix x", []string{"-m", "conntrack", "--ctstate", "NEW", "-j", "LOG", "--log-prefix", "x"}},
+
+		{"", nil},
+		{"-p tcp -j ACCEPT\n-A INPUT -j DROP", nil},
+		{"-t nat -j ACCEPT", nil},
+		{"-p tcp --table nat -j ACCEPT", nil},
+		{"-p tcp --modprobe /tmp/x -j ACCEPT", nil},
+		// getopt_long 的缩写：--tab 即 --table，--modp 即 --modprobe
+		{"-p tcp --tab nat --dport 22 -j ACCEPT", nil},
+		{"-p tcp --modp=/tmp/x -j ACCEPT", nil},
+		{"-p tcp --modprobe=/tmp/x -j ACCEPT", nil},
+		{"-m comment --comment x --ins INPUT", nil},
+		{"-j ACCEPT --pol DROP", nil},
+		{"-p tcp --proto udp -j ACCEPT", nil},
+		{"-p tcp --ju DROP", nil},
+		{"-p tcp -- -j ACCEPT", nil},
+		{"-p tcp --dport 22 -j -ACCEPT", nil},
+		{"--dport 22 -j ACCEPT", nil},
+	}
+	for _, c := range cases {
+		got, err := ruleSpecArgs(c.spec)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("ruleSpecArgs(%q) = %q, want error", c.spec, got)
+			} else if !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("ruleSpecArgs(%q): %v, want ErrInvalidInput", c.spec, err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, c.want) {
+			t.Errorf("ruleSpecArgs(%q) = %q, %v, want %q", c.spec, got, err, c.want)
+		}
+	}
+}
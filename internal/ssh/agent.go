@@ -0,0 +1,91 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"iptables-web/backend/internal/models"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// 全局 ssh-agent socket（SSH_AGENT_SOCK / SSH_AUTH_SOCK），Host.AgentSocket 可覆盖
+var agentSocket string
+
+func SetAgentSocket(path string) { agentSocket = strings.TrimSpace(path) }
+
+// AgentSocketFor：host 实际使用的 agent socket
+func AgentSocketFor(h models.Host) string {
+	return firstNonEmpty(h.AgentSocket, agentSocket)
+}
+
+// AgentAuth：通过 ssh-agent 签名登录，服务端不保存任何私钥/密码
+// 连接只在握手期间保持，握手结束由 connectFresh 调用 Close 释放
+type AgentAuth struct {
+	Socket string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (a *AgentAuth) Name() string { return "agent" }
+
+func (a *AgentAuth) Methods(h models.Host) (string, []gossh.AuthMethod, error) {
+	sock := firstNonEmpty(a.Socket, AgentSocketFor(h))
+	if sock == "" {
+		return "", nil, fmt.Errorf("ssh-agent socket not configured (set SSH_AUTH_SOCK or host agent_socket)")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return "", nil, fmt.Errorf("dial ssh-agent %s: %w", sock, err)
+	}
+	a.mu.Lock()
+	if a.conn != nil {
+		_ = a.conn.Close()
+	}
+	a.conn = conn
+	a.mu.Unlock()
+
+	ag := agent.NewClient(conn)
+	return loginUser(h), []gossh.AuthMethod{gossh.PublicKeysCallback(ag.Signers)}, nil
+}
+
+func (a *AgentAuth) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn = nil
+	return err
+}
+
+// setupAgentForwarding：连接建立后注册 auth-agent@openssh.com 通道转发
+func (c *Client) setupAgentForwarding(cli *gossh.Client) {
+	if !c.Host.AgentForward {
+		return
+	}
+	sock := AgentSocketFor(c.Host)
+	if sock == "" {
+		log.Printf("[ssh] agent forward skipped host=%s: no agent socket", c.Host.IP)
+		return
+	}
+	if err := agent.ForwardToRemote(cli, sock); err != nil {
+		log.Printf("[ssh] agent forward host=%s: %v", c.Host.IP, err)
+	}
+}
+
+// requestAgentForwarding：每个 session 需单独请求转发
+func (c *Client) requestAgentForwarding(s *gossh.Session) {
+	if !c.Host.AgentForward || AgentSocketFor(c.Host) == "" {
+		return
+	}
+	if err := agent.RequestAgentForwarding(s); err != nil {
+		log.Printf("[ssh] request agent forwarding host=%s: %v", c.Host.IP, err)
+	}
+}
@@ -38,7 +38,7 @@ func (a PasswordAuth) Methods(h models.Host) (string, []gossh.AuthMethod, error)
 	}
 }
 
-// KeyAuth：私钥登录（兼容未来）
+// KeyAuth：私钥文件登录
 type KeyAuth struct {
 	PrivateKeyPath string
 	Passphrase     string // 可选
@@ -52,23 +52,95 @@ func (a KeyAuth) Methods(h models.Host) (string, []gossh.AuthMethod, error) {
 	if err != nil {
 		return "", nil, err
 	}
-	var signer gossh.Signer
-	if strings.TrimSpace(a.Passphrase) != "" {
-		signer, err = gossh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(a.Passphrase))
-	} else {
-		signer, err = gossh.ParsePrivateKey(keyBytes)
-	}
+	signers, err := keySigners(keyBytes, a.Passphrase, "")
 	if err != nil {
 		return "", nil, err
 	}
 	user := a.UserOverride
 	if strings.TrimSpace(user) == "" {
-		// root 也可以用 key 登录
-		if normalize(h.LoginMethod) == "root" {
-			user = firstNonEmpty(h.RootUser, "root")
-		} else {
-			user = h.User
-		}
-	}
-	return user, []gossh.AuthMethod{gossh.PublicKeys(signer)}, nil
+		user = loginUser(h)
+	}
+	return user, []gossh.AuthMethod{gossh.PublicKeys(signers...)}, nil
+}
+
+// StoredKeyAuth：使用 Host 上加密保存的私钥（可附带 OpenSSH 用户证书）
+type StoredKeyAuth struct{}
+
+func (a StoredKeyAuth) Name() string { return "stored-key" }
+
+func (a StoredKeyAuth) Methods(h models.Host) (string, []gossh.AuthMethod, error) {
+	if h.PrivateKey == "" {
+		return "", nil, fmt.Errorf("host %s has no private key", h.Name)
+	}
+	keyPEM, err := crypto.Open(h.PrivateKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("decrypt private key: %w", err)
+	}
+	signers, err := keySigners([]byte(keyPEM), crypto.MustOpen(h.KeyPassphrase), h.Certificate)
+	if err != nil {
+		return "", nil, err
+	}
+	return loginUser(h), []gossh.AuthMethod{gossh.PublicKeys(signers...)}, nil
+}
+
+// AuthProvidersFor：按 host.AuthType 构建认证链
+func AuthProvidersFor(h models.Host) []AuthProvider {
+	switch normalize(h.AuthType) {
+	case "key":
+		return []AuthProvider{StoredKeyAuth{}}
+	case "agent":
+		return []AuthProvider{&AgentAuth{}}
+	default:
+		return []AuthProvider{PasswordAuth{}}
+	}
+}
+
+// ValidateKeyAuth：保存前校验私钥/口令/证书能否解析且相互匹配
+func ValidateKeyAuth(privateKey, passphrase, certificate string) error {
+	_, err := keySigners([]byte(privateKey), passphrase, certificate)
+	return err
+}
+
+// keySigners：解析私钥；有证书时证书签名者排在前面，私钥本身作为兜底
+func keySigners(keyBytes []byte, passphrase, certificate string) ([]gossh.Signer, error) {
+	var (
+		signer gossh.Signer
+		err    error
+	)
+	if strings.TrimSpace(passphrase) != "" {
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(passphrase))
+	} else {
+		signer, err = gossh.ParsePrivateKey(keyBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	if strings.TrimSpace(certificate) == "" {
+		return []gossh.Signer{signer}, nil
+	}
+
+	pub, _, _, _, err := gossh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("certificate: not an OpenSSH certificate")
+	}
+	if cert.CertType != gossh.UserCert {
+		return nil, fmt.Errorf("certificate: not a user certificate")
+	}
+	certSigner, err := gossh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate: %w", err)
+	}
+	return []gossh.Signer{certSigner, signer}, nil
+}
+
+// loginUser：root 登录方式用 root 账号，其余用普通账号
+func loginUser(h models.Host) string {
+	if normalize(h.LoginMethod) == "root" {
+		return firstNonEmpty(h.RootUser, "root")
+	}
+	return h.User
 }
@@ -20,6 +20,8 @@ const (
 
 type Task struct {
 	ID        string
+	JobID     string // 同一次批量提交的任务共享 JobID
+	Op        string // 业务操作名，仅用于展示
 	Host      models.Host
 	Command   Command
 	Status    TaskStatus
@@ -29,6 +31,7 @@ type Task struct {
 	Result    Result
 	Retry     int
 	MaxRetry  int
+	Backoff   time.Duration // 首次重试前的等待，之后按 2 倍递增
 }
 
 type RetryPolicy struct {
@@ -36,6 +39,15 @@ type RetryPolicy struct {
 	Backoff  time.Duration
 }
 
+// Apply：把重试策略写入任务
+func (r RetryPolicy) Apply(t *Task) {
+	t.MaxRetry = r.MaxRetry
+	t.Backoff = r.Backoff
+}
+
+// 单次退避上限
+const maxBackoff = 5 * time.Minute
+
 type ExecutorPool struct {
 	Workers int
 	Store   TaskStore // 可选持久化
@@ -43,6 +55,10 @@ type ExecutorPool struct {
 
 	wg    sync.WaitGroup
 	queue chan *Task
+
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc // 执行中的任务
+	canceled map[string]bool               // 已请求取消、尚未开始的任务
 }
 
 func NewExecutorPool(workers int, store TaskStore, hooks Hooks) *ExecutorPool {
@@ -50,10 +66,12 @@ func NewExecutorPool(workers int, store TaskStore, hooks Hooks) *ExecutorPool {
 		workers = 8
 	}
 	return &ExecutorPool{
-		Workers: workers,
-		Store:   store,
-		Hooks:   hooks,
-		queue:   make(chan *Task, workers*4),
+		Workers:  workers,
+		Store:    store,
+		Hooks:    hooks,
+		queue:    make(chan *Task, workers*4),
+		running:  map[string]context.CancelFunc{},
+		canceled: map[string]bool{},
 	}
 }
 
@@ -70,12 +88,46 @@ func (p *ExecutorPool) Stop() {
 }
 
 func (p *ExecutorPool) Submit(t *Task) {
-	if p.Store != nil {
-		_ = p.Store.Save(t)
+	if t.Status == "" {
+		t.Status = TaskPending
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	// 入队前已被取消的任务不能把存储里的 CANCELED 覆盖回 PENDING
+	p.mu.Lock()
+	canceled := p.canceled[t.ID]
+	p.mu.Unlock()
+	if !canceled {
+		p.save(t)
 	}
 	p.queue <- t
 }
 
+// Cancel：执行中的任务中断（远端 SIGKILL）；排队中的任务直接标记为 CANCELED
+// 返回 false 表示任务已结束或不存在
+func (p *ExecutorPool) Cancel(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cancel, ok := p.running[id]; ok {
+		p.canceled[id] = true
+		cancel()
+		return true
+	}
+	if p.Store == nil {
+		return false
+	}
+	t, err := p.Store.Get(id)
+	if err != nil || t.Status != TaskPending {
+		return false
+	}
+	p.canceled[id] = true
+	t.Status = TaskCanceled
+	t.EndedAt = time.Now()
+	_ = p.Store.Save(t)
+	return true
+}
+
 func (p *ExecutorPool) worker() {
 	defer p.wg.Done()
 	for t := range p.queue {
@@ -84,32 +136,82 @@ func (p *ExecutorPool) worker() {
 }
 
 func (p *ExecutorPool) runTask(t *Task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p.mu.Lock()
+	if p.canceled[t.ID] {
+		delete(p.canceled, t.ID)
+		p.mu.Unlock()
+		if t.Status != TaskCanceled {
+			t.Status = TaskCanceled
+			t.EndedAt = time.Now()
+			p.save(t)
+		}
+		return
+	}
+	p.running[t.ID] = cancel
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, t.ID)
+		delete(p.canceled, t.ID)
+		p.mu.Unlock()
+	}()
+
 	t.Status = TaskRunning
 	t.StartedAt = time.Now()
-	if p.Store != nil {
-		_ = p.Store.Save(t)
-	}
-	if p.Hooks.OnTask != nil {
-		p.Hooks.OnTask(*t)
-	}
+	p.save(t)
 
-	cli := New(t.Host)
-	cli.Hooks = p.Hooks // 继承 hook
-	res := cli.Exec(context.Background(), t.Command.Raw,
-		WithPTY(t.Command.PTY),
-		WithShell(t.Command.Shell),
-		WithStdin(t.Command.Stdin),
-		WithTimeout(t.Command.Timeout),
-	)
+	for {
+		// 连接来自共享连接池，hook 不挂在 Client 上，这里单独回调
+		run := func() Result {
+			return Get(t.Host).Exec(ctx, t.Command.Raw,
+				WithPTY(t.Command.PTY),
+				WithShell(t.Command.Shell),
+				WithStdin(t.Command.Stdin),
+				WithTimeout(t.Command.Timeout),
+			)
+		}
+		var res Result
+		if p.Hooks.OnExec != nil {
+			res = p.Hooks.OnExec(*t, run)
+		} else {
+			res = run()
+		}
+		if p.Hooks.OnResult != nil {
+			p.Hooks.OnResult(t.Host, t.Command, res)
+		}
+		t.Result = res
+
+		if res.Err == nil || ctx.Err() != nil || t.Retry >= t.MaxRetry || !retryable(res) {
+			break
+		}
+
+		t.Retry++
+		p.save(t)
+		select {
+		case <-time.After(backoff(t.Backoff, t.Retry)):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
 
-	t.Result = res
 	t.EndedAt = time.Now()
-	if res.Err == nil {
+	switch {
+	case ctx.Err() != nil:
+		t.Status = TaskCanceled
+	case t.Result.Err == nil:
 		t.Status = TaskSucceeded
-	} else {
+	default:
 		t.Status = TaskFailed
 	}
+	p.save(t)
+}
 
+func (p *ExecutorPool) save(t *Task) {
 	if p.Store != nil {
 		_ = p.Store.Save(t)
 	}
@@ -118,6 +220,27 @@ func (p *ExecutorPool) runTask(t *Task) {
 	}
 }
 
+// retryable：只重试命令确定没有送到目标机的失败（连接、建会话）；
+// 超时、丢了退出状态时命令可能已经生效，命令本身返回非 0 说明已执行过，重试只会重复失败或重复生效
+func retryable(res Result) bool {
+	return res.Err != nil && isNotStarted(res.Err)
+}
+
+// backoff：第 n 次重试前的等待 = base * 2^(n-1)，封顶 maxBackoff
+func backoff(base time.Duration, n int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
 func (p *ExecutorPool) ExecBatch(
 	ctx context.Context,
 	hosts []models.Host,
@@ -149,9 +272,10 @@ func (p *ExecutorPool) ExecBatch(
 			}
 			defer func() { <-sem }()
 
-			cli := New(hh)
-			cli.Hooks = p.Hooks
-			res := cli.Exec(ctx, cmd.Raw, opts...)
+			res := Get(hh).Exec(ctx, cmd.Raw, opts...)
+			if p.Hooks.OnResult != nil {
+				p.Hooks.OnResult(hh, cmd, res)
+			}
 			mu.Lock()
 			out = append(out, res)
 			mu.Unlock()
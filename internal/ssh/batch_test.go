@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		base time.Duration
+		n    int
+		want time.Duration
+	}{
+		{0, 1, 0},
+		{-time.Second, 3, 0},
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 2 * time.Second},
+		{time.Second, 4, 8 * time.Second},
+		{time.Minute, 4, maxBackoff},
+		{time.Second, 1000, maxBackoff},
+		{10 * time.Minute, 1, maxBackoff},
+	}
+	for _, c := range cases {
+		if got := backoff(c.base, c.n); got != c.want {
+			t.Errorf("backoff(%v, %d) = %v, want %v", c.base, c.n, got, c.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		res  Result
+		want bool
+	}{
+		{Result{Err: notStarted(errors.New("dial")), Code: -1}, true},
+		{Result{Err: fmt.Errorf("jump host: %w", notStarted(errors.New("dial"))), Code: -1}, true},
+		{Result{Err: context.DeadlineExceeded, Code: -1}, false},
+		{Result{Err: errors.New("wait: remote command exited without exit status"), Code: -1}, false},
+		{Result{Err: errors.New("exit 1"), Code: 1}, false},
+		{Result{Code: -1}, false},
+		{Result{}, false},
+	}
+	for _, c := range cases {
+		if got := retryable(c.res); got != c.want {
+			t.Errorf("retryable(%+v) = %v, want %v", c.res, got, c.want)
+		}
+	}
+}
+
+func TestRunTaskRetry(t *testing.T) {
+	dial := Result{Err: notStarted(errors.New("dial tcp: connection refused")), Code: -1}
+	timeout := Result{Err: context.DeadlineExceeded, Code: -1}
+	exit := Result{Err: errors.New("exit status 1"), Code: 1}
+	ok := Result{Stdout: "done"}
+
+	cases := []struct {
+		name     string
+		maxRetry int
+		results  []Result // 依次作为每次执行的结果
+		runs     int
+		retry    int
+		status   TaskStatus
+	}{
+		{"success first try", 3, []Result{ok}, 1, 0, TaskSucceeded},
+		{"transport error then success", 3, []Result{dial, dial, ok}, 3, 2, TaskSucceeded},
+		{"retries exhausted", 2, []Result{dial, dial, dial, ok}, 3, 2, TaskFailed},
+		{"no retry policy", 0, []Result{dial, ok}, 1, 0, TaskFailed},
+		{"command failure not retried", 3, []Result{exit, ok}, 1, 0, TaskFailed},
+		{"timeout not retried", 3, []Result{timeout, ok}, 1, 0, TaskFailed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runs := 0
+			var saved []Task
+			p := NewExecutorPool(1, nil, Hooks{
+				OnExec: func(Task, func() Result) Result {
+					res := c.results[runs]
+					runs++
+					return res
+				},
+				OnTask: func(task Task) { saved = append(saved, task) },
+			})
+			task := &Task{ID: "t1"}
+			RetryPolicy{MaxRetry: c.maxRetry, Backoff: time.Millisecond}.Apply(task)
+			p.runTask(task)
+
+			if runs != c.runs || task.Retry != c.retry || task.Status != c.status {
+				t.Errorf("runs=%d retry=%d status=%s, want %d %d %s", runs, task.Retry, task.Status, c.runs, c.retry, c.status)
+			}
+			if task.Result != c.results[runs-1] {
+				t.Errorf("result = %+v, want last run's %+v", task.Result, c.results[runs-1])
+			}
+			// RUNNING、每次重试、结束各保存一次
+			if len(saved) != c.retry+2 {
+				t.Errorf("saved %d times, want %d", len(saved), c.retry+2)
+			}
+		})
+	}
+}
+
+func TestRunTaskCancelDuringBackoff(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	p := NewExecutorPool(1, nil, Hooks{
+		OnExec: func(Task, func() Result) Result {
+			ran <- struct{}{}
+			return Result{Err: notStarted(errors.New("dial")), Code: -1}
+		},
+	})
+	task := &Task{ID: "t1"}
+	RetryPolicy{MaxRetry: 5, Backoff: time.Hour}.Apply(task)
+
+	done := make(chan struct{})
+	go func() {
+		p.runTask(task)
+		close(done)
+	}()
+	// 第一次执行失败后取消，任务应当从一小时的退避等待中退出
+	deadline := time.After(5 * time.Second)
+	select {
+	case <-ran:
+	case <-deadline:
+		t.Fatal("task never ran")
+	}
+	if !p.Cancel("t1") {
+		t.Fatal("Cancel = false for running task")
+	}
+	select {
+	case <-done:
+	case <-deadline:
+		t.Fatal("cancel did not interrupt backoff")
+	}
+	if task.Status != TaskCanceled {
+		t.Errorf("status = %s, want CANCELED", task.Status)
+	}
+}
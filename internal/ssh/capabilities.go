@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,6 +11,7 @@ type Capabilities struct {
 	SudoNoPass   bool
 	RequireTTY   bool
 	IptablesPath string
+	Bins         map[string]string // iptables 系列命令的路径（command -v），key 为命令名；没找到的不在其中
 	DetectedAt   time.Time
 }
 
@@ -46,6 +48,12 @@ func (cc *CapCache) Set(key string, cap Capabilities) {
 	cc.items[key] = cap
 }
 
+func (cc *CapCache) Delete(key string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.items, key)
+}
+
 // ProbeCapabilities：首次连接后探测 sudo/iptables 路径等
 func (c *Client) ProbeCapabilities(ctx context.Context) Capabilities {
 	key := c.cacheKey()
@@ -70,11 +78,11 @@ func (c *Client) ProbeCapabilities(ctx context.Context) Capabilities {
 		}
 	}
 
-	// 探测 iptables 路径（允许不同发行版）
-	r2 := c.Exec(ctx, "command -v iptables || which iptables", WithShell(true), WithTimeout(5*time.Second))
+	// 探测 iptables 系列命令的路径（不同发行版在 /sbin、/usr/sbin、/usr/local/sbin 不等）
+	r2 := c.Exec(ctx, probeBinsScript, WithShell(true), WithTimeout(5*time.Second))
 	if r2.Err == nil {
-		p := trim1stLine(r2.Stdout)
-		if p != "" {
+		cap.Bins = parseBins(r2.Stdout)
+		if p := cap.Bins["iptables"]; p != "" {
 			cap.IptablesPath = p
 		}
 	}
@@ -84,3 +92,31 @@ func (c *Client) ProbeCapabilities(ctx context.Context) Capabilities {
 	}
 	return cap
 }
+
+const probeBinsScript = `for b in iptables iptables-save iptables-restore ip6tables ip6tables-save ip6tables-restore; do
+p=$(command -v "$b") && printf '%s %s\n' "$b" "$p"
+done; true`
+
+// parseBins：probeBinsScript 的输出，每行 "命令名 路径"；只认绝对路径（command -v 对别名 / 函数会输出别的内容）
+func parseBins(out string) map[string]string {
+	bins := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		name, path, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if path = strings.TrimSpace(path); ok && strings.HasPrefix(path, "/") {
+			bins[name] = path
+		}
+	}
+	return bins
+}
+
+// iptablesBin：name 为 iptables / iptables-save / iptables-restore，v6 时换成对应的 ip6tables 命令；
+// 优先用探测到的路径，探测不到时用命令名，交给 pathWrap 设置的 PATH 查找
+func (c *Client) iptablesBin(v6 bool, name string) string {
+	if v6 {
+		name = "ip6" + strings.TrimPrefix(name, "ip")
+	}
+	if p := c.ProbeCapabilities(context.Background()).Bins[name]; p != "" {
+		return p
+	}
+	return name
+}
@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"iptables-web/backend/internal/models"
+)
+
+func TestParseBins(t *testing.T) {
+	out := "iptables /sbin/iptables\r\n" +
+		"iptables-save /usr/local/sbin/iptables-save\n" +
+		"iptables-restore alias iptables-restore='foo'\n" +
+		"ip6tables /usr/sbin/ip6tables\n" +
+		"\n"
+	want := map[string]string{
+		"iptables":      "/sbin/iptables",
+		"iptables-save": "/usr/local/sbin/iptables-save",
+		"ip6tables":     "/usr/sbin/ip6tables",
+	}
+	if got := parseBins(out); !maps.Equal(got, want) {
+		t.Errorf("parseBins = %v, want %v", got, want)
+	}
+}
+
+func TestIptablesBin(t *testing.T) {
+	c := New(models.Host{ID: 1, IP: "192.0.2.1"})
+	c.CapCache = NewCapCache(time.Hour)
+	c.CapCache.Set(c.cacheKey(), Capabilities{Bins: map[string]string{
+		"iptables-save":     "/sbin/iptables-save",
+		"ip6tables-restore": "/usr/local/sbin/ip6tables-restore",
+	}})
+	cases := []struct {
+		v6   bool
+		name string
+		want string
+	}{
+		{false, "iptables-save", "/sbin/iptables-save"},
+		{true, "iptables-restore", "/usr/local/sbin/ip6tables-restore"},
+		{false, "iptables-restore", "iptables-restore"}, // 没探测到，交给 PATH
+		{true, "iptables", "ip6tables"},
+	}
+	for _, tc := range cases {
+		if got := c.iptablesBin(tc.v6, tc.name); got != tc.want {
+			t.Errorf("iptablesBin(%v, %q) = %q, want %q", tc.v6, tc.name, got, tc.want)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 )
 
 func (c *Client) Exec(ctx context.Context, raw string, opts ...ExecOption) Result {
+	c.acquire()
+	defer c.release()
 	cmd := buildCommand(raw, opts...)
 
 	// 超时
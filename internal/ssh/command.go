@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -14,6 +15,10 @@ type Command struct {
 	Timeout time.Duration
 	Env     map[string]string
 	WorkDir string
+
+	// 按行回调（流式输出）；PTY 模式下 stderr 并入 stdout
+	OnStdout func(line string) `json:"-"`
+	OnStderr func(line string) `json:"-"`
 }
 
 type Result struct {
@@ -26,11 +31,26 @@ type Result struct {
 	Strategy string
 }
 
+// notStartedError：连接或建会话失败，命令确定没有送到目标机；与超时、丢了退出状态（Code 同为 -1）区分开
+type notStartedError struct{ error }
+
+func (e notStartedError) Unwrap() error { return e.error }
+
+func notStarted(err error) error { return notStartedError{err} }
+
+func isNotStarted(err error) bool {
+	var e notStartedError
+	return errors.As(err, &e)
+}
+
 type ExecOption func(*Command)
 
 func WithStdin(s string) ExecOption { return func(c *Command) { c.Stdin = s } }
-func WithPTY(v bool) ExecOption     { return func(c *Command) { c.PTY = v } }
-func WithShell(v bool) ExecOption   { return func(c *Command) { c.Shell = v } }
+
+// WithArgs：以 argv 形式给出命令（Exec 的 raw 需为空）
+func WithArgs(args ...string) ExecOption { return func(c *Command) { c.Args = args } }
+func WithPTY(v bool) ExecOption          { return func(c *Command) { c.PTY = v } }
+func WithShell(v bool) ExecOption        { return func(c *Command) { c.Shell = v } }
 func WithTimeout(d time.Duration) ExecOption {
 	return func(c *Command) { c.Timeout = d }
 }
@@ -43,6 +63,12 @@ func WithEnv(k, v string) ExecOption {
 	}
 }
 func WithWorkDir(d string) ExecOption { return func(c *Command) { c.WorkDir = d } }
+func WithOnStdout(fn func(line string)) ExecOption {
+	return func(c *Command) { c.OnStdout = fn }
+}
+func WithOnStderr(fn func(line string)) ExecOption {
+	return func(c *Command) { c.OnStderr = fn }
+}
 
 type ExecStrategy interface {
 	Exec(ctx context.Context, c *Client, cmd Command) Result
@@ -1,10 +1,13 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"iptables-web/backend/internal/models"
@@ -18,6 +21,7 @@ type Client struct {
 
 	AuthProviders []AuthProvider // P3：认证插件链
 	CapCache      *CapCache
+	HostKeys      HostKeyStore // 主机公钥校验（TOFU）
 
 	// 连接复用
 	mu   sync.Mutex
@@ -35,30 +39,42 @@ type Client struct {
 
 	// 审计/指标 hook（P2）
 	Hooks Hooks
+
+	// 跳板机（Host.ViaHostID 非空时按需构建）
+	Via   *Client
+	chain []uint // 下游主机 ID，用于环路检测
+
+	// 连接池（为 nil 表示独立 Client）
+	pool     *Pool
+	pooledAt time.Time
+	inflight int32
+	retired  atomic.Bool // 已被连接池移除：不再重连，最后一个命令结束后关闭（见 retire）
 }
 
 type Hooks struct {
 	OnConnect func(host models.Host, user string, err error)
 	OnResult  func(host models.Host, cmd Command, res Result)
 	OnTask    func(task Task) // 任务状态变更
+	// OnExec：包住 ExecutorPool 对任务的一次执行（每次重试各一次）；可在前后加锁、检查，
+	// 或不调用 run 直接返回失败结果（不会重试，见 retryable）
+	OnExec func(task Task, run func() Result) Result
 }
 
 func New(h models.Host) *Client {
 	return &Client{
-		Host:        h,
-		DialTimeout: 10 * time.Second,
-		CmdTimeout:  30 * time.Second,
-		KeepAlive:   30 * time.Second,
-		AuthProviders: []AuthProvider{
-			PasswordAuth{}, // 默认密码
-		},
+		Host:          h,
+		DialTimeout:   10 * time.Second,
+		CmdTimeout:    30 * time.Second,
+		KeepAlive:     30 * time.Second,
+		HostKeys:      hostKeyStore,
+		AuthProviders: AuthProvidersFor(h),
 	}
 }
 
 // getOrConnect：并发安全单飞行连接
 func (c *Client) getOrConnect() (*gossh.Client, string, error) {
 	c.mu.Lock()
-	if c.cli != nil && time.Since(c.lastUse) < 5*time.Minute {
+	if c.cli != nil && (time.Since(c.lastUse) < 5*time.Minute || c.retired.Load()) {
 		c.lastUse = time.Now()
 		cli := c.cli
 		user := c.user
@@ -66,6 +82,10 @@ func (c *Client) getOrConnect() (*gossh.Client, string, error) {
 		return cli, user, nil
 	}
 	c.mu.Unlock()
+	// 已移出连接池的 Client 再连就成了没人管的连接
+	if c.retired.Load() {
+		return nil, "", ErrClientRetired
+	}
 
 	v, err, _ := c.sf.Do("connect", func() (interface{}, error) {
 		return c.connectFresh()
@@ -95,14 +115,19 @@ func (c *Client) connectFresh() (struct {
 		}
 
 		conf := &gossh.ClientConfig{
-			User:            user,
-			Auth:            methods,
-			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
-			Timeout:         c.DialTimeout,
+			User:              user,
+			Auth:              methods,
+			HostKeyCallback:   hostKeyCallback(c.HostKeys, c.Host),
+			HostKeyAlgorithms: hostKeyAlgorithms(c.HostKeys, c.Host),
+			Timeout:           c.DialTimeout,
 		}
 
 		log.Printf("[ssh] dial host=%s user=%s auth=%s", addr, user, ap.Name())
-		cli, err := gossh.Dial("tcp", addr, conf)
+		cli, err := c.dial(addr, conf)
+		// 握手结束即可释放认证资源（如 agent 连接）
+		if cl, ok := ap.(io.Closer); ok {
+			_ = cl.Close()
+		}
 		if err == nil {
 			c.mu.Lock()
 			if c.cli != nil {
@@ -117,6 +142,7 @@ func (c *Client) connectFresh() (struct {
 			c.lastUse = time.Now()
 			c.mu.Unlock()
 
+			c.setupAgentForwarding(cli)
 			go c.keepAliveLoop(cli)
 
 			if c.Hooks.OnConnect != nil {
@@ -129,8 +155,8 @@ func (c *Client) connectFresh() (struct {
 		}
 
 		lastErr = err
-		if isTimeout(err) {
-			// 超时直接退出
+		if isTimeout(err) || isHostKeyError(err) {
+			// 超时 / 主机公钥不可信：换认证方式也没用，直接退出
 			break
 		}
 	}
@@ -161,12 +187,17 @@ func (c *Client) keepAliveLoop(cli *gossh.Client) {
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	var err error
 	if c.cli != nil {
-		err := c.cli.Close()
+		err = c.cli.Close()
 		c.cli = nil
-		return err
 	}
-	return nil
+	// 独立 Client 的跳板机连接随目标一起关闭；池化的跳板机由连接池管理
+	if c.Via != nil && c.pool == nil {
+		_ = c.Via.Close()
+		c.Via = nil
+	}
+	return err
 }
 
 func isTimeout(err error) bool {
@@ -179,6 +210,11 @@ func isTimeout(err error) bool {
 	return false
 }
 
+func isHostKeyError(err error) bool {
+	var mm *HostKeyMismatchError
+	return errors.As(err, &mm) || errors.Is(err, ErrNoHostKeyStore)
+}
+
 func (c *Client) cacheKey() string {
-	return c.Host.IP
+	return fmt.Sprintf("%d@%s:%d", c.Host.ID, c.Host.IP, portOrDefault(c.Host.Port))
 }
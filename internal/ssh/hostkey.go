@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"iptables-web/backend/internal/models"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// HostKeyStore：主机公钥持久化（由 service 层基于 SQLite 实现）
+type HostKeyStore interface {
+	// Pinned 返回已固定的公钥；尚未固定返回 nil, nil
+	Pinned(h models.Host) (gossh.PublicKey, error)
+	// Pin 首次连接（TOFU）时固定公钥
+	Pin(h models.Host, key gossh.PublicKey) error
+	// Mismatch 记录与固定值不一致的公钥，等待人工审批
+	Mismatch(h models.Host, key gossh.PublicKey) error
+}
+
+var ErrNoHostKeyStore = errors.New("host key store not configured")
+
+// HostKeyMismatchError：服务端出示的公钥与固定值不一致
+type HostKeyMismatchError struct {
+	Addr string
+	Want string // 已固定的指纹
+	Got  string // 本次出示的指纹
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: pinned %s, got %s (approve the new key or reset it via /api/hosts/:id/hostkey)",
+		e.Addr, e.Want, e.Got)
+}
+
+var hostKeyStore HostKeyStore
+
+// SetHostKeyStore：进程启动时注入；未注入时所有连接都会失败（fail closed）
+func SetHostKeyStore(s HostKeyStore) { hostKeyStore = s }
+
+// HostKeyCallback：按 host 校验公钥（TOFU + 不一致即拒绝）
+func HostKeyCallback(h models.Host) gossh.HostKeyCallback {
+	return hostKeyCallback(hostKeyStore, h)
+}
+
+func hostKeyCallback(store HostKeyStore, h models.Host) gossh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		if store == nil {
+			return ErrNoHostKeyStore
+		}
+		// 主机证书：只比对其中的公钥
+		if cert, ok := key.(*gossh.Certificate); ok {
+			key = cert.Key
+		}
+		pinned, err := store.Pinned(h)
+		if err != nil {
+			return fmt.Errorf("load host key: %w", err)
+		}
+		if pinned == nil {
+			log.Printf("[ssh] tofu pin host=%s type=%s fp=%s", hostname, key.Type(), gossh.FingerprintSHA256(key))
+			return store.Pin(h, key)
+		}
+		if bytes.Equal(pinned.Marshal(), key.Marshal()) {
+			return nil
+		}
+		if err := store.Mismatch(h, key); err != nil {
+			log.Printf("[ssh] record host key mismatch host=%s: %v", hostname, err)
+		}
+		return &HostKeyMismatchError{
+			Addr: hostname,
+			Want: gossh.FingerprintSHA256(pinned),
+			Got:  gossh.FingerprintSHA256(key),
+		}
+	}
+}
+
+// hostKeyAlgorithms：已固定公钥时，只协商该类型，避免服务端出示另一种类型的 key 被误判为不一致
+func hostKeyAlgorithms(store HostKeyStore, h models.Host) []string {
+	if store == nil {
+		return nil
+	}
+	pinned, err := store.Pinned(h)
+	if err != nil || pinned == nil {
+		return nil
+	}
+	switch pinned.Type() {
+	case gossh.KeyAlgoRSA:
+		return []string{gossh.KeyAlgoRSASHA512, gossh.KeyAlgoRSASHA256, gossh.KeyAlgoRSA}
+	default:
+		return []string{pinned.Type()}
+	}
+}
@@ -6,40 +6,77 @@ import (
 	"strings"
 )
 
-func (c *Client) IptablesSave(v6 bool) (string, error) {
-	bin := "/usr/sbin/iptables-save"
-	if v6 {
-		bin = "/usr/sbin/ip6tables-save"
-	}
-	r := c.Exec(context.Background(), bin, WithShell(true))
+// IptablesSave：args 如 "-c"（带计数器）、"-t", "filter"
+func (c *Client) IptablesSave(v6 bool, args ...string) (string, error) {
+	argv := append([]string{c.iptablesBin(v6, "iptables-save")}, args...)
+	r := c.Exec(context.Background(), "", WithArgs(argv...), WithShell(true))
 	if r.Err != nil {
-		return "", fmt.Errorf("%s: %v %s", bin, r.Err, tail(r.Stderr))
+		return "", fmt.Errorf("%s: %v %s", ShellJoin(argv), r.Err, tail(r.Stderr))
 	}
 	return r.Stdout, nil
 }
 
 func (c *Client) Iptables(v6 bool, table string, args ...string) (string, error) {
-	cap := c.ProbeCapabilities(context.Background())
-	bin := cap.IptablesPath
-	if v6 {
-		bin = strings.ReplaceAll(bin, "iptables", "ip6tables")
-	}
-	full := bin + " -t " + table + " " + strings.Join(args, " ")
-	r := c.Exec(context.Background(), full, WithShell(true))
+	argv := append([]string{c.iptablesBin(v6, "iptables"), "-t", table}, args...)
+	full := ShellJoin(argv)
+	r := c.Exec(context.Background(), "", WithArgs(argv...), WithShell(true))
 	if r.Err != nil {
 		return "", fmt.Errorf("%s: %v %s", full, r.Err, tail(r.Stderr))
 	}
 	return r.Stdout, nil
 }
 
-func (c *Client) IptablesRestore(v6 bool, content string) (string, error) {
-	bin := "/usr/sbin/iptables-restore"
-	if v6 {
-		bin = "/usr/sbin/ip6tables-restore"
-	}
-	r := c.Exec(context.Background(), bin, WithShell(true), WithStdin(content))
+// IptablesRestore：args 如 "-c"（恢复计数器）、"--noflush"、"--test"
+// 输入里出现的表整表替换（--noflush 除外），单次调用内全部成功或全部不生效
+func (c *Client) IptablesRestore(v6 bool, content string, args ...string) (string, error) {
+	argv := append([]string{c.iptablesBin(v6, "iptables-restore")}, args...)
+	r := c.Exec(context.Background(), "", WithArgs(argv...), WithShell(true), WithStdin(content))
 	if r.Err != nil {
-		return "", fmt.Errorf("%s: %v %s", bin, r.Err, tail(r.Stderr))
+		return "", fmt.Errorf("%s: %v %s", ShellJoin(argv), r.Err, tail(r.Stderr))
 	}
 	return r.Stdout, nil
 }
+
+// Peer：目标机视角下本服务的 SSH 连接（取自 sshd 设置的 SSH_CONNECTION）
+// ClientIP 为目标机看到的来源地址（经跳板机时为跳板机地址），Iface 为回程路由的出接口，取不到时为空
+type Peer struct {
+	ClientIP string
+	ServerIP string
+	Iface    string
+}
+
+// SSHPort：目标机的 SSH 端口（未设置时为 22）
+func (c *Client) SSHPort() int { return portOrDefault(c.Host.Port) }
+
+// ManagementPeer：不经 sudo / su（会清掉环境变量），直接在登录用户下读取
+func (c *Client) ManagementPeer(ctx context.Context) (Peer, error) {
+	c.acquire()
+	defer c.release()
+	cli, _, err := c.getOrConnect()
+	if err != nil {
+		return Peer{}, err
+	}
+	r := c.lowLevelRun(ctx, cli, Command{
+		Raw:   `printf '%s\n' "$SSH_CONNECTION"; ip -o route get "${SSH_CONNECTION%% *}" 2>/dev/null`,
+		Shell: true,
+	})
+	if r.Err != nil {
+		return Peer{}, fmt.Errorf("read SSH_CONNECTION: %v %s", r.Err, tail(r.Stderr))
+	}
+	lines := strings.Split(strings.TrimSpace(r.Stdout), "\n")
+	f := strings.Fields(lines[0])
+	if len(f) < 4 {
+		return Peer{}, fmt.Errorf("SSH_CONNECTION not set")
+	}
+	p := Peer{ClientIP: f[0], ServerIP: f[2]}
+	if len(lines) > 1 {
+		rf := strings.Fields(lines[1])
+		for i := 0; i+1 < len(rf); i++ {
+			if rf[i] == "dev" {
+				p.Iface = rf[i+1]
+				break
+			}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"iptables-web/backend/internal/models"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// 跳板机链最大跳数（不含目标机）
+const MaxJumpHops = 8
+
+// HostLookup：按 ID 取跳板机（由 service 层注入）
+type HostLookup func(id uint) (*models.Host, error)
+
+var hostLookup HostLookup
+
+func SetHostLookup(fn HostLookup) { hostLookup = fn }
+
+type timeoutError struct{ op string }
+
+func (e *timeoutError) Error() string   { return e.op + ": i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// dial：直连，或经由跳板机链建立 SSH 连接
+func (c *Client) dial(addr string, conf *gossh.ClientConfig) (*gossh.Client, error) {
+	if c.Host.ViaHostID == nil || *c.Host.ViaHostID == 0 {
+		return gossh.Dial("tcp", addr, conf)
+	}
+	via, err := c.viaClient()
+	if err != nil {
+		return nil, fmt.Errorf("jump host: %w", err)
+	}
+	// 经由跳板机的连接存续期间算作跳板机上的一个在用命令，跳板机被移出连接池时不会被提前关闭
+	via.acquire()
+	cli, err := c.dialVia(via, addr, conf)
+	if err != nil {
+		via.release()
+		return nil, err
+	}
+	go func() {
+		_ = cli.Wait()
+		via.release()
+	}()
+	return cli, nil
+}
+
+func (c *Client) dialVia(via *Client, addr string, conf *gossh.ClientConfig) (*gossh.Client, error) {
+	// 递归：跳板机自身可能还有上一级跳板
+	viaCli, _, err := via.getOrConnect()
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", via.Host.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.DialTimeout)
+	defer cancel()
+	conn, err := viaCli.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &timeoutError{op: fmt.Sprintf("dial %s via %s", addr, via.Host.Name)}
+		}
+		return nil, fmt.Errorf("dial %s via %s: %w", addr, via.Host.Name, err)
+	}
+	return clientOverConn(conn, addr, conf, c.DialTimeout)
+}
+
+// clientOverConn：在已有连接（跳板机 direct-tcpip 通道）上完成 SSH 握手
+// 通道连接不支持 SetDeadline，超时靠关闭连接打断握手
+func clientOverConn(conn net.Conn, addr string, conf *gossh.ClientConfig, timeout time.Duration) (*gossh.Client, error) {
+	type handshake struct {
+		conn  gossh.Conn
+		chans <-chan gossh.NewChannel
+		reqs  <-chan *gossh.Request
+		err   error
+	}
+	done := make(chan handshake, 1)
+	go func() {
+		cc, chans, reqs, err := gossh.NewClientConn(conn, addr, conf)
+		done <- handshake{cc, chans, reqs, err}
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case h := <-done:
+		if h.err != nil {
+			_ = conn.Close()
+			return nil, h.err
+		}
+		return gossh.NewClient(h.conn, h.chans, h.reqs), nil
+	case <-timer:
+		_ = conn.Close()
+		return nil, &timeoutError{op: "ssh handshake " + addr}
+	}
+}
+
+// viaClient：构建上一跳的 Client；hooks / 超时沿用当前 Client，逐跳生效
+// 池化 Client 的跳板机也从连接池取（注意不能持有 c.mu 调用 pool.Get，避免与池锁顺序相反）
+func (c *Client) viaClient() (*Client, error) {
+	c.mu.Lock()
+	if c.Via != nil && !c.Via.retired.Load() {
+		via := c.Via
+		c.mu.Unlock()
+		return via, nil
+	}
+	chain := append(append([]uint{}, c.chain...), c.Host.ID)
+	c.mu.Unlock()
+
+	if hostLookup == nil {
+		return nil, errors.New("host lookup not configured")
+	}
+	viaID := *c.Host.ViaHostID
+	if len(chain) > MaxJumpHops {
+		return nil, fmt.Errorf("too many jump hops (max %d)", MaxJumpHops)
+	}
+	for _, id := range chain {
+		if id == viaID {
+			return nil, fmt.Errorf("jump host loop at host %d", viaID)
+		}
+	}
+	h, err := hostLookup(viaID)
+	if err != nil {
+		return nil, fmt.Errorf("load jump host %d: %w", viaID, err)
+	}
+
+	var via *Client
+	if c.pool != nil {
+		via = c.pool.Get(*h)
+	} else {
+		via = New(*h)
+		via.CapCache = c.CapCache
+		via.DialTimeout = c.DialTimeout
+		via.KeepAlive = c.KeepAlive
+		via.Hooks = c.Hooks
+	}
+
+	via.mu.Lock()
+	if via.chain == nil {
+		via.chain = chain
+	}
+	via.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Via == nil || c.Via.retired.Load() {
+		c.Via = via
+	}
+	return c.Via, nil
+}
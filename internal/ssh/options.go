@@ -1,17 +1,13 @@
 package ssh
 
-import (
-	"strings"
-)
-
 func buildCommand(raw string, opts ...ExecOption) Command {
 	cmd := Command{Raw: raw}
 	for _, o := range opts {
 		o(&cmd)
 	}
-	// Args -> Raw
+	// Args -> Raw（逐个转义，参数里的空格、引号、; 不会被 shell 解释）
 	if cmd.Raw == "" && len(cmd.Args) > 0 {
-		cmd.Raw = strings.Join(cmd.Args, " ")
+		cmd.Raw = ShellJoin(cmd.Args)
 	}
 	return cmd
 }
@@ -0,0 +1,280 @@
+package ssh
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"iptables-web/backend/internal/models"
+)
+
+// PoolConfig：进程级连接池配置
+type PoolConfig struct {
+	MaxPerHost  int           // 每台主机最多保留的 SSH 连接数
+	IdleTimeout time.Duration // 空闲超过该时长的连接被回收
+	CapTTL      time.Duration // 能力探测缓存有效期
+}
+
+// Pool：按 host.ID 复用 Client（一个 Client 对应一条 SSH 连接，连接上可并发多个 session）
+type Pool struct {
+	mu    sync.Mutex
+	cfg   PoolConfig
+	hosts map[uint]*hostPool
+	caps  *CapCache
+}
+
+type hostPool struct {
+	host    models.Host // 入池时的快照；UpdatedAt 变化（凭据被编辑）即整体失效
+	clients []*Client
+	hits    uint64
+	misses  uint64
+}
+
+type HostPoolStats struct {
+	HostID    uint      `json:"host_id"`
+	Name      string    `json:"name"`
+	IP        string    `json:"ip"`
+	Clients   int       `json:"clients"`   // 池中 Client 数
+	Connected int       `json:"connected"` // 其中已建立 SSH 连接的数量
+	InFlight  int       `json:"in_flight"` // 正在执行的命令数（含经由它转发的下游连接）
+	Hits      uint64    `json:"hits"`
+	Misses    uint64    `json:"misses"`
+	LastUse   time.Time `json:"last_use"`
+}
+
+type PoolStats struct {
+	MaxPerHost  int             `json:"max_per_host"`
+	IdleTimeout string          `json:"idle_timeout"`
+	Hosts       []HostPoolStats `json:"hosts"`
+}
+
+var defaultPool = NewPool(PoolConfig{
+	MaxPerHost:  2,
+	IdleTimeout: 5 * time.Minute,
+	CapTTL:      10 * time.Minute,
+})
+
+func DefaultPool() *Pool { return defaultPool }
+
+// Get：从默认连接池取 host 对应的 Client
+func Get(h models.Host) *Client { return defaultPool.Get(h) }
+
+func NewPool(cfg PoolConfig) *Pool {
+	p := &Pool{hosts: map[uint]*hostPool{}}
+	p.Configure(cfg)
+	go p.janitor()
+	return p
+}
+
+func (p *Pool) Configure(cfg PoolConfig) {
+	if cfg.MaxPerHost <= 0 {
+		cfg.MaxPerHost = 2
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 5 * time.Minute
+	}
+	if cfg.CapTTL <= 0 {
+		cfg.CapTTL = 10 * time.Minute
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	p.caps = NewCapCache(cfg.CapTTL)
+}
+
+// Get：优先复用空闲连接；都在忙且未达上限时新建；达到上限则复用最空闲的那条
+// 未入库的 host（ID=0）不入池
+func (p *Pool) Get(h models.Host) *Client {
+	if h.ID == 0 {
+		return New(h)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hp := p.hosts[h.ID]
+	if hp != nil && !hp.host.UpdatedAt.Equal(h.UpdatedAt) {
+		log.Printf("[ssh-pool] host %d changed, dropping %d client(s)", h.ID, len(hp.clients))
+		p.dropLocked(h.ID)
+		hp = nil
+	}
+	if hp == nil {
+		hp = &hostPool{host: h}
+		p.hosts[h.ID] = hp
+	}
+
+	var best *Client
+	for _, c := range hp.clients {
+		if best == nil || c.InFlight() < best.InFlight() {
+			best = c
+		}
+	}
+	if best != nil && (best.InFlight() == 0 || len(hp.clients) >= p.cfg.MaxPerHost) {
+		hp.hits++
+		best.checkout()
+		return best
+	}
+
+	c := New(h)
+	c.CapCache = p.caps
+	c.pool = p
+	c.checkout()
+	hp.clients = append(hp.clients, c)
+	hp.misses++
+	return c
+}
+
+// Invalidate：关闭并移除主机的全部连接，连同以它为跳板的主机
+func (p *Pool) Invalidate(hostIDs ...uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range hostIDs {
+		p.invalidateLocked(id, map[uint]bool{})
+	}
+}
+
+func (p *Pool) invalidateLocked(id uint, seen map[uint]bool) {
+	if seen[id] {
+		return
+	}
+	seen[id] = true
+	p.dropLocked(id)
+	for hid, hp := range p.hosts {
+		if hp.host.ViaHostID != nil && *hp.host.ViaHostID == id {
+			p.invalidateLocked(hid, seen)
+		}
+	}
+}
+
+func (p *Pool) dropLocked(id uint) {
+	hp := p.hosts[id]
+	if hp == nil {
+		return
+	}
+	for _, c := range hp.clients {
+		p.caps.Delete(c.cacheKey())
+		c.retire()
+	}
+	delete(p.hosts, id)
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := PoolStats{
+		MaxPerHost:  p.cfg.MaxPerHost,
+		IdleTimeout: p.cfg.IdleTimeout.String(),
+		Hosts:       make([]HostPoolStats, 0, len(p.hosts)),
+	}
+	for id, hp := range p.hosts {
+		st := HostPoolStats{
+			HostID: id, Name: hp.host.Name, IP: hp.host.IP,
+			Clients: len(hp.clients), Hits: hp.hits, Misses: hp.misses,
+		}
+		for _, c := range hp.clients {
+			connected, last := c.connState()
+			if connected {
+				st.Connected++
+			}
+			st.InFlight += c.InFlight()
+			if last.After(st.LastUse) {
+				st.LastUse = last
+			}
+		}
+		out.Hosts = append(out.Hosts, st)
+	}
+	sort.Slice(out.Hosts, func(i, j int) bool { return out.Hosts[i].HostID < out.Hosts[j].HostID })
+	return out
+}
+
+// janitor：定期回收空闲连接
+func (p *Pool) janitor() {
+	tk := time.NewTicker(30 * time.Second)
+	defer tk.Stop()
+	for range tk.C {
+		p.evictIdle()
+	}
+}
+
+func (p *Pool) evictIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 仍有下游连接经由它转发的跳板机不能回收
+	busyVia := map[uint]bool{}
+	for _, hp := range p.hosts {
+		if hp.host.ViaHostID == nil {
+			continue
+		}
+		for _, c := range hp.clients {
+			if connected, _ := c.connState(); connected {
+				busyVia[*hp.host.ViaHostID] = true
+				break
+			}
+		}
+	}
+
+	for id, hp := range p.hosts {
+		if busyVia[id] {
+			continue
+		}
+		kept := hp.clients[:0]
+		for _, c := range hp.clients {
+			_, last := c.connState()
+			if c.InFlight() == 0 && time.Since(last) > p.cfg.IdleTimeout {
+				c.retire()
+				continue
+			}
+			kept = append(kept, c)
+		}
+		hp.clients = kept
+		if len(hp.clients) == 0 {
+			delete(p.hosts, id)
+		}
+	}
+}
+
+// ---- Client 侧的使用计数 ----
+
+// ErrClientRetired：Client 已被连接池移除（主机被编辑或空闲回收），不再建立新连接；重新从池中取即可
+var ErrClientRetired = errors.New("ssh client retired from pool")
+
+func (c *Client) acquire() { atomic.AddInt32(&c.inflight, 1) }
+
+// release：已退役的 Client 在最后一个命令结束时关闭
+func (c *Client) release() {
+	if atomic.AddInt32(&c.inflight, -1) == 0 && c.retired.Load() {
+		go c.Close()
+	}
+}
+
+// retire：移出连接池；还有命令在执行（包括经由它转发的下游连接）时不打断，由 release 关闭
+func (c *Client) retire() {
+	c.retired.Store(true)
+	if c.InFlight() == 0 {
+		go c.Close() // 不在池锁内等待网络关闭
+	}
+}
+
+// InFlight：正在执行的命令数
+func (c *Client) InFlight() int { return int(atomic.LoadInt32(&c.inflight)) }
+
+// checkout：记录出池时间，避免刚取出、尚未执行命令的 Client 被当作空闲回收
+func (c *Client) checkout() {
+	c.mu.Lock()
+	c.pooledAt = time.Now()
+	c.mu.Unlock()
+}
+
+// connState：是否已连接 + 最近使用时间（取出池与执行命令二者较晚者）
+func (c *Client) connState() (bool, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := c.lastUse
+	if c.pooledAt.After(last) {
+		last = c.pooledAt
+	}
+	return c.cli != nil, last
+}
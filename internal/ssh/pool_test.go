@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"iptables-web/backend/internal/models"
+)
+
+func TestPoolRetiresDroppedClients(t *testing.T) {
+	p := NewPool(PoolConfig{MaxPerHost: 2, IdleTimeout: time.Minute})
+	h := models.Host{ID: 1, Name: "a", IP: "192.0.2.1"}
+	h.UpdatedAt = time.Unix(100, 0)
+
+	busy := p.Get(h)
+	busy.acquire() // 模拟执行中的命令
+	idle := p.Get(h)
+	if idle == busy {
+		t.Fatal("expected a second client while the first is busy")
+	}
+
+	h.UpdatedAt = time.Unix(200, 0) // 主机被编辑
+	fresh := p.Get(h)
+	if fresh == busy || fresh == idle {
+		t.Fatal("Get returned a client from before the host changed")
+	}
+	for name, c := range map[string]*Client{"busy": busy, "idle": idle} {
+		if !c.retired.Load() {
+			t.Errorf("%s client not retired", name)
+		}
+		if _, _, err := c.getOrConnect(); !errors.Is(err, ErrClientRetired) {
+			t.Errorf("%s client reconnect: err = %v, want ErrClientRetired", name, err)
+		}
+	}
+	if fresh.retired.Load() {
+		t.Error("fresh client retired")
+	}
+	busy.release()
+	if st := p.Stats(); len(st.Hosts) != 1 || st.Hosts[0].Clients != 1 {
+		t.Errorf("stats = %+v, want one host with one client", st.Hosts)
+	}
+}
+
+func TestPoolEvictIdleRetires(t *testing.T) {
+	p := NewPool(PoolConfig{MaxPerHost: 2, IdleTimeout: time.Minute})
+	h := models.Host{ID: 1, Name: "a", IP: "192.0.2.1"}
+
+	busy := p.Get(h)
+	busy.acquire()
+	defer busy.release()
+	c := p.Get(h)
+	busy.pooledAt = time.Now().Add(-time.Hour)
+	c.pooledAt = time.Now().Add(-time.Hour)
+
+	p.evictIdle()
+	if !c.retired.Load() {
+		t.Error("idle client not retired")
+	}
+	if _, _, err := c.getOrConnect(); !errors.Is(err, ErrClientRetired) {
+		t.Errorf("evicted client reconnect: err = %v, want ErrClientRetired", err)
+	}
+	if busy.retired.Load() {
+		t.Error("busy client retired")
+	}
+	if got := p.Get(h); got == c {
+		t.Error("Get returned the evicted client")
+	}
+}
@@ -1,13 +1,13 @@
 package ssh
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	gossh "golang.org/x/crypto/ssh"
@@ -25,14 +25,25 @@ func (c *Client) lowLevelRun(ctx context.Context, cli *gossh.Client, cmd Command
 			s, err = cli2.NewSession()
 		}
 		if err != nil {
-			return Result{HostIP: c.Host.IP, Err: err, Code: -1}
+			return Result{HostIP: c.Host.IP, Err: notStarted(err), Code: -1}
 		}
 	}
 	defer s.Close()
+	c.requestAgentForwarding(s)
 
 	var out, errb bytes.Buffer
 	s.Stdout = &out
 	s.Stderr = &errb
+	if cmd.OnStdout != nil {
+		lw := &lineWriter{cb: cmd.OnStdout}
+		defer lw.Flush()
+		s.Stdout = io.MultiWriter(&out, lw)
+	}
+	if cmd.OnStderr != nil {
+		lw := &lineWriter{cb: cmd.OnStderr}
+		defer lw.Flush()
+		s.Stderr = io.MultiWriter(&errb, lw)
+	}
 
 	runCmd := cmd.Raw
 	if cmd.Shell {
@@ -52,7 +63,7 @@ func (c *Client) lowLevelRun(ctx context.Context, cli *gossh.Client, cmd Command
 	// PTY
 	if cmd.PTY {
 		if err := s.RequestPty("xterm", 120, 32, gossh.TerminalModes{gossh.ECHO: 0}); err != nil {
-			return Result{HostIP: c.Host.IP, Err: fmt.Errorf("request pty: %w", err), Code: -1}
+			return Result{HostIP: c.Host.IP, Err: notStarted(fmt.Errorf("request pty: %w", err)), Code: -1}
 		}
 		in, _ := s.StdinPipe()
 		if cmd.Stdin != "" {
@@ -89,6 +100,7 @@ func (c *Client) lowLevelRun(ctx context.Context, cli *gossh.Client, cmd Command
 }
 
 // ExecStream：流式输出（P4）
+// 与 Exec 走同一套提权策略，只是额外按行回调；ctx 取消时远端进程收到 SIGKILL
 func (c *Client) ExecStream(
 	ctx context.Context,
 	raw string,
@@ -96,56 +108,38 @@ func (c *Client) ExecStream(
 	onStderr func(line string),
 	opts ...ExecOption,
 ) Result {
-	cmd := buildCommand(raw, opts...)
-	cli, _, err := c.getOrConnect()
-	if err != nil {
-		return Result{HostIP: c.Host.IP, Err: err, Code: -1}
-	}
-
-	start := time.Now()
-	s, err := cli.NewSession()
-	if err != nil {
-		return Result{HostIP: c.Host.IP, Err: err, Code: -1}
-	}
-	defer s.Close()
-
-	stdoutPipe, _ := s.StdoutPipe()
-	stderrPipe, _ := s.StderrPipe()
-
-	runCmd := cmd.Raw
-	if cmd.Shell {
-		runCmd = pathWrap(runCmd)
-	}
-
-	go scanLines(stdoutPipe, onStdout)
-	go scanLines(stderrPipe, onStderr)
-
-	done := make(chan error, 1)
-	go func() { done <- s.Run(runCmd) }()
+	opts = append(opts, WithOnStdout(onStdout), WithOnStderr(onStderr))
+	return c.Exec(ctx, raw, opts...)
+}
 
-	var e error
-	select {
-	case <-ctx.Done():
-		_ = s.Signal(gossh.SIGKILL)
-		e = ctx.Err()
-	case e = <-done:
-	}
+// lineWriter：把写入的字节流切成行回调，末尾不完整的行在 Flush 时送出
+type lineWriter struct {
+	mu  sync.Mutex
+	cb  func(string)
+	buf []byte
+}
 
-	return Result{
-		HostIP: c.Host.IP,
-		Err:    e,
-		Code:   exitCode(e),
-		Spent:  time.Since(start),
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.cb(strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
 	}
+	return len(p), nil
 }
 
-func scanLines(r io.Reader, cb func(string)) {
-	if cb == nil || r == nil {
-		return
-	}
-	sc := bufio.NewScanner(r)
-	for sc.Scan() {
-		cb(sc.Text())
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.cb(strings.TrimRight(string(w.buf), "\r"))
+		w.buf = nil
 	}
 }
 
@@ -16,7 +16,7 @@ func (s RootStrategy) Name() string { return "root" }
 func (s RootStrategy) Exec(ctx context.Context, c *Client, cmd Command) Result {
 	cli, _, err := c.getOrConnect()
 	if err != nil {
-		return Result{HostIP: c.Host.IP, Err: err, Code: -1, Strategy: s.Name()}
+		return Result{HostIP: c.Host.IP, Err: notStarted(err), Code: -1, Strategy: s.Name()}
 	}
 	res := c.lowLevelRun(ctx, cli, cmd)
 	res.Strategy = s.Name()
@@ -29,7 +29,7 @@ func (s SudoStrategy) Name() string { return "sudo" }
 func (s SudoStrategy) Exec(ctx context.Context, c *Client, cmd Command) Result {
 	cli, _, err := c.getOrConnect()
 	if err != nil {
-		return Result{HostIP: c.Host.IP, Err: err, Code: -1, Strategy: s.Name()}
+		return Result{HostIP: c.Host.IP, Err: notStarted(err), Code: -1, Strategy: s.Name()}
 	}
 
 	cap := c.ProbeCapabilities(ctx)
@@ -37,9 +37,14 @@ func (s SudoStrategy) Exec(ctx context.Context, c *Client, cmd Command) Result {
 	// 1) sudo -n（如果 cap 说NoPass就优先）
 	c1 := cmd
 	c1.Raw = "sudo -n " + cmd.Raw
+	// 预计要回退到 sudo -S 时先不流式输出，免得把 "password is required" 推给调用方；不回退再补发
+	if !cap.SudoNoPass {
+		c1.OnStdout, c1.OnStderr = nil, nil
+	}
 	r1 := c.lowLevelRun(ctx, cli, c1)
 	r1.Strategy = s.Name()
 	if r1.Err == nil {
+		replayLines(cmd, c1, r1)
 		return r1
 	}
 
@@ -49,25 +54,18 @@ func (s SudoStrategy) Exec(ctx context.Context, c *Client, cmd Command) Result {
 	}
 
 	if !needsSudoPassword(r1.Stderr) && !looksLikeRequireTTY(r1.Stderr) && !looksLikeSudoReadFromTTY(r1.Stderr) {
+		replayLines(cmd, c1, r1)
 		return r1
 	}
 	log.Printf("[ssh] sudo -n fallback host=%s stderr=%q", c.Host.IP, shortForLog(r1.Stderr))
 
-	// 2) sudo -S
-	userPass := crypto.MustOpen(c.Host.Password)
-	c2 := cmd
-	c2.Raw = "sudo -S -p '' " + cmd.Raw
-	if cmd.Stdin != "" {
-		c2.Stdin = cmd.Stdin + "\n"
-	}
-	c2.Stdin += userPass + "\n"
-
-	// 需要TTY就走PTY
-	if cmd.PTY || cap.RequireTTY || looksLikeRequireTTY(r1.Stderr) || looksLikeSudoReadFromTTY(r1.Stderr) {
-		c2.PTY = true
+	// 2) sudo -S（sudo 无密码、只是要求 TTY 时不送密码，否则密码行会被当成命令的输入）
+	pass := ""
+	if !cap.SudoNoPass {
+		pass = crypto.MustOpen(c.Host.Password)
 	}
-
-	r2 := c.lowLevelRun(ctx, cli, c2)
+	tty := cap.RequireTTY || looksLikeRequireTTY(r1.Stderr) || looksLikeSudoReadFromTTY(r1.Stderr)
+	r2 := c.lowLevelRun(ctx, cli, sudoPasswordCommand(cmd, pass, tty))
 	r2.Strategy = s.Name()
 	return r2
 }
@@ -78,27 +76,67 @@ func (s UserSuStrategy) Name() string { return "user-su" }
 func (s UserSuStrategy) Exec(ctx context.Context, c *Client, cmd Command) Result {
 	cli, _, err := c.getOrConnect()
 	if err != nil {
-		return Result{HostIP: c.Host.IP, Err: err, Code: -1, Strategy: s.Name()}
+		return Result{HostIP: c.Host.IP, Err: notStarted(err), Code: -1, Strategy: s.Name()}
 	}
 
 	rootUser := firstNonEmpty(c.Host.RootUser, "root")
 	rootPass := crypto.MustOpen(c.Host.RootPass)
 
+	res := c.lowLevelRun(ctx, cli, suCommand(cmd, rootUser, rootPass))
+	res.Strategy = s.Name()
+	return res
+}
+
+// sudoPasswordCommand：sudo -S 执行 cmd；pass 为空表示不需要密码
+// -k 忽略缓存的凭据，保证 sudo 一定会读走第一行密码，不会把它留给命令
+func sudoPasswordCommand(cmd Command, pass string, tty bool) Command {
+	w := cmd
+	if pass == "" {
+		w.Raw = "sudo -S -p '' " + cmd.Raw
+	} else {
+		w.Raw = "sudo -k -S -p '' " + cmd.Raw
+		w.Stdin = passwordFirst(pass, cmd.Stdin)
+	}
+	// 需要TTY就走PTY
+	w.PTY = cmd.PTY || tty
+	return w
+}
+
+// suCommand：以 su - rootUser -c 执行 cmd
+func suCommand(cmd Command, rootUser, rootPass string) Command {
 	w := cmd
 	w.PTY = true // su 基本需要PTY
 	raw := cmd.Raw
 	if cmd.Shell {
 		raw = pathWrap(raw)
 	}
-	w.Raw = fmt.Sprintf(`su - %s -c %q`, rootUser, raw)
-	if cmd.Stdin != "" {
-		w.Stdin = cmd.Stdin + "\n"
+	w.Raw = fmt.Sprintf(`su - %s -c %s`, shellEscape(rootUser), shellEscape(raw))
+	w.Stdin = passwordFirst(rootPass, cmd.Stdin)
+	return w
+}
+
+// passwordFirst：sudo -S / su 只从 stdin 读一行密码，命令自己的输入（如 iptables-restore 的规则）必须排在密码之后
+func passwordFirst(pass, stdin string) string {
+	return pass + "\n" + stdin
+}
+
+// replayLines：run 执行时屏蔽了回调，结果确定要返回后再按行补发给 orig 的回调
+func replayLines(orig, run Command, res Result) {
+	if orig.OnStdout != nil && run.OnStdout == nil {
+		emitLines(res.Stdout, orig.OnStdout)
 	}
-	w.Stdin += rootPass + "\n"
+	if orig.OnStderr != nil && run.OnStderr == nil {
+		emitLines(res.Stderr, orig.OnStderr)
+	}
+}
 
-	res := c.lowLevelRun(ctx, cli, w)
-	res.Strategy = s.Name()
-	return res
+func emitLines(s string, cb func(string)) {
+	if s == "" {
+		return
+	}
+	w := &lineWriter{cb: cb}
+	_, _ = w.Write([]byte(s))
+	w.Flush()
 }
 
 func StrategyByHost(c *Client) ExecStrategy {
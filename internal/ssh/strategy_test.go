@@ -0,0 +1,40 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordCommands(t *testing.T) {
+	const rules = "*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"
+	restore := Command{Raw: "/usr/sbin/iptables-restore", Shell: true, Stdin: rules}
+	list := Command{Raw: "iptables -S", Shell: true}
+
+	cases := []struct {
+		name   string
+		got    Command
+		prefix string
+		stdin  string
+		pty    bool
+	}{
+		{"sudo with input", sudoPasswordCommand(restore, "s3cret", false), "sudo -k -S -p '' ", "s3cret\n" + rules, false},
+		{"sudo without input", sudoPasswordCommand(list, "s3cret", false), "sudo -k -S -p '' ", "s3cret\n", false},
+		{"sudo requiretty", sudoPasswordCommand(restore, "s3cret", true), "sudo -k -S -p '' ", "s3cret\n" + rules, true},
+		{"sudo nopasswd requiretty", sudoPasswordCommand(restore, "", true), "sudo -S -p '' ", rules, true},
+		{"su with input", suCommand(restore, "root", "r00t"), "su - 'root' -c ", "r00t\n" + rules, true},
+		{"su without input", suCommand(list, "root", "r00t"), "su - 'root' -c ", "r00t\n", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if !strings.HasPrefix(c.got.Raw, c.prefix) {
+				t.Errorf("Raw = %q, want prefix %q", c.got.Raw, c.prefix)
+			}
+			if c.got.Stdin != c.stdin {
+				t.Errorf("Stdin = %q, want %q", c.got.Stdin, c.stdin)
+			}
+			if c.got.PTY != c.pty {
+				t.Errorf("PTY = %v, want %v", c.got.PTY, c.pty)
+			}
+		})
+	}
+}
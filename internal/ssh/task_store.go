@@ -2,13 +2,55 @@ package ssh
 
 import (
 	"errors"
+	"sort"
 	"sync"
+	"time"
 )
 
 type TaskStore interface {
 	Save(t *Task) error
 	Get(id string) (*Task, error)
 	List() ([]*Task, error)
+	Query(f TaskFilter) ([]*Task, error)
+}
+
+// TaskFilter：零值字段不参与过滤；结果按 CreatedAt 倒序
+type TaskFilter struct {
+	HostID uint
+	JobIDs []string
+	Status []TaskStatus
+	Since  time.Time // CreatedAt >= Since
+	Until  time.Time // CreatedAt < Until
+	Limit  int
+}
+
+// Match：供内存实现逐条过滤
+func (f TaskFilter) Match(t *Task) bool {
+	if f.HostID != 0 && t.Host.ID != f.HostID {
+		return false
+	}
+	if len(f.JobIDs) > 0 && !contains(f.JobIDs, t.JobID) {
+		return false
+	}
+	if len(f.Status) > 0 && !contains(f.Status, t.Status) {
+		return false
+	}
+	if !f.Since.IsZero() && t.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !t.CreatedAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+func contains[T comparable](xs []T, v T) bool {
+	for _, x := range xs {
+		if x == v {
+			return true
+		}
+	}
+	return false
 }
 
 type MemoryTaskStore struct {
@@ -50,9 +92,21 @@ func (s *MemoryTaskStore) List() ([]*Task, error) {
 	return out, nil
 }
 
-/*
-SQLiteStore 示例（可选）：
-- 使用 database/sql + sqlite driver
-- 表 schema: tasks(id TEXT PRIMARY KEY, status TEXT, host_json TEXT, cmd_json TEXT, result_json TEXT, ts...)
-因为你提过未来 PG/MySQL，也建议只实现 TaskStore 接口即可切换。
-*/
+func (s *MemoryTaskStore) Query(f TaskFilter) ([]*Task, error) {
+	s.mu.RLock()
+	out := make([]*Task, 0)
+	for _, t := range s.m {
+		if f.Match(t) {
+			cp := *t
+			out = append(out, &cp)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+// 持久化实现见 db.TaskStore（SQLite / GORM），换 PG/MySQL 也只需实现 TaskStore 接口
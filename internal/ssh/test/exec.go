@@ -10,6 +10,7 @@ import (
 
 	"iptables-web/backend/internal/crypto"
 	"iptables-web/backend/internal/models"
+	sshx "iptables-web/backend/internal/ssh"
 
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -24,7 +25,7 @@ func (c *Client) dial(user, pass string) (*gossh.Client, error) {
 	conf := &gossh.ClientConfig{
 		User:            user,
 		Auth:            []gossh.AuthMethod{gossh.Password(pass)},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // TODO: 生产环境改为 known_hosts 校验
+		HostKeyCallback: sshx.HostKeyCallback(c.Host),
 		Timeout:         10 * time.Second,
 	}
 	addr := fmt.Sprintf("%s:%d", c.Host.IP, portOrDefault(c.Host.Port))
@@ -2,7 +2,11 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Txn struct {
@@ -13,7 +17,7 @@ type Txn struct {
 }
 
 func (c *Client) BeginIptablesTxn(ctx context.Context, v6 bool) (*Txn, error) {
-	bak, err := c.IptablesSave(v6)
+	bak, err := c.IptablesSave(v6, "-c")
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +32,7 @@ func (t *Txn) Rollback(ctx context.Context) error {
 	if !t.active {
 		return nil
 	}
-	_, err := t.c.IptablesRestore(t.v6, t.backup)
+	_, err := t.c.IptablesRestore(t.v6, t.backup, "-c")
 	return err
 }
 
@@ -44,3 +48,81 @@ func (t *Txn) ExecInTxn(ctx context.Context, raw string, opts ...ExecOption) (Re
 	}
 	return res, nil
 }
+
+// ErrRollbackFired：回滚进程已不存在（已执行或被手动结束），无法再取消
+var ErrRollbackFired = errors.New("scheduled rollback already ran")
+
+// ScheduledRollback：目标机上与 SSH 会话脱离的 "sleep N; iptables-restore -c < File"
+// 本服务与主机断开（甚至本服务重启）后照样会执行，只有 CancelRollback 能取消
+type ScheduledRollback struct {
+	PID  int    // setsid 新建的会话 / 进程组 ID
+	File string // 目标机上的备份文件
+	V6   bool
+}
+
+// 以 sh -c 的一条命令执行，sudo / su 时整段都在 root 下运行
+// $1 = 秒数，$2 = iptables-restore 路径；stdin 为备份内容
+const scheduleRollbackScript = `f=$(mktemp /tmp/iptables-web-rollback.XXXXXX) || exit 1
+cat > "$f" || { rm -f "$f"; exit 1; }
+command -v setsid >/dev/null 2>&1 || { rm -f "$f"; echo "setsid not found" >&2; exit 1; }
+setsid sh -c 'sleep "$1" && "$2" -c < "$3"; rm -f "$3"' rollback "$1" "$2" "$f" </dev/null >/dev/null 2>&1 &
+echo "$! $f"`
+
+// $1 = 进程组 ID，$2 = 备份文件；进程组已不存在时退出码 3
+const cancelRollbackScript = `kill -s TERM -- "-$1" 2>/dev/null || exit 3
+rm -f "$2"`
+
+// $1 = 进程组 ID，$2 = 备份文件，$3 = iptables-restore 路径
+const runRollbackScript = `kill -s TERM -- "-$1" 2>/dev/null || exit 3
+"$3" -c < "$2" || exit 1
+rm -f "$2"`
+
+// ScheduleRollback：把 backup 写到目标机临时文件，after 之后在目标机上自行恢复
+func (t *Txn) ScheduleRollback(ctx context.Context, after time.Duration) (ScheduledRollback, error) {
+	secs := int(after.Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	restore := t.c.iptablesBin(t.v6, "iptables-restore")
+	r := t.c.Exec(ctx, "", WithArgs("sh", "-c", scheduleRollbackScript, "rollback", strconv.Itoa(secs), restore),
+		WithShell(true), WithStdin(t.backup))
+	if r.Err != nil {
+		return ScheduledRollback{}, fmt.Errorf("schedule rollback: %v %s", r.Err, tail(r.Stderr))
+	}
+	pid, file, _ := strings.Cut(strings.TrimSpace(lastLine(r.Stdout)), " ")
+	n, err := strconv.Atoi(pid)
+	if err != nil || n <= 1 || file == "" {
+		return ScheduledRollback{}, fmt.Errorf("schedule rollback: unexpected output %q", tail(r.Stdout))
+	}
+	return ScheduledRollback{PID: n, File: file, V6: t.v6}, nil
+}
+
+// CancelRollback：结束回滚进程组并删除备份文件（确认变更）
+func (c *Client) CancelRollback(ctx context.Context, rb ScheduledRollback) error {
+	return c.rollbackCmd(ctx, cancelRollbackScript, strconv.Itoa(rb.PID), rb.File)
+}
+
+// RunRollback：不再等待，立即用备份恢复
+func (c *Client) RunRollback(ctx context.Context, rb ScheduledRollback) error {
+	return c.rollbackCmd(ctx, runRollbackScript, strconv.Itoa(rb.PID), rb.File, c.iptablesBin(rb.V6, "iptables-restore"))
+}
+
+func (c *Client) rollbackCmd(ctx context.Context, script string, args ...string) error {
+	argv := append([]string{"sh", "-c", script, "rollback"}, args...)
+	r := c.Exec(ctx, "", WithArgs(argv...), WithShell(true))
+	if r.Err != nil {
+		if r.Code == 3 {
+			return ErrRollbackFired
+		}
+		return fmt.Errorf("%v %s", r.Err, tail(r.Stderr))
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
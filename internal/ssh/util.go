@@ -2,12 +2,14 @@ package ssh
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 )
 
+// pathWrap：内层命令整体单引号转义，$PATH 由内层 sh 展开
 func pathWrap(cmd string) string {
-	return fmt.Sprintf("sh -lc 'PATH=/usr/sbin:/sbin:/usr/local/sbin:$PATH; %s'", cmd)
+	return "sh -lc " + shellEscape("PATH=/usr/sbin:/sbin:/usr/local/sbin:$PATH; "+cmd)
 }
 
 func envWrap(env map[string]string, cmd string) string {
@@ -28,6 +30,22 @@ func shellEscape(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
 }
 
+// 不需要加引号的参数
+var reShellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellJoin：把 argv 拼成一条 sh 命令，每个参数按需单引号转义
+func ShellJoin(args []string) string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		if reShellSafe.MatchString(a) {
+			out[i] = a
+		} else {
+			out[i] = shellEscape(a)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
 func shortForLog(s string) string {
 	if len(s) > 200 {
 		return s[:200] + "...(truncated)"